@@ -0,0 +1,84 @@
+package async
+
+import (
+	"context"
+	"errors"
+)
+
+// Func is the blocking form of a call, the one adapters start from.
+type Func[In, Out any] func(ctx context.Context, in In) (Out, error)
+
+// AsyncFunc is the Future returning form of a Func.
+type AsyncFunc[In, Out any] func(ctx context.Context, in In) *Future[Out]
+
+// StreamFunc maps a channel of inputs to a Stream of outputs.
+type StreamFunc[In, Out any] func(ctx context.Context, in <-chan In) *Stream[Out]
+
+// Async runs every call of fn in its own goroutine.
+func Async[In, Out any](fn Func[In, Out]) AsyncFunc[In, Out] {
+	return func(ctx context.Context, in In) *Future[Out] {
+		return Go(ctx, func(ctx context.Context) (Out, error) {
+			return fn(ctx, in)
+		})
+	}
+}
+
+// Sync waits for the Future of every call of fn.
+func Sync[In, Out any](fn AsyncFunc[In, Out]) Func[In, Out] {
+	return func(ctx context.Context, in In) (Out, error) {
+		return fn(ctx, in).Await(ctx)
+	}
+}
+
+// Map calls fn for every input received, one at a time, and streams
+// the results and errors in input order. The stream ends when the
+// input channel is closed.
+func Map[In, Out any](fn Func[In, Out]) StreamFunc[In, Out] {
+	return func(ctx context.Context, inputs <-chan In) *Stream[Out] {
+		return NewStream(ctx, func(ctx context.Context, e Emitter[Out]) error {
+			for {
+				var in In
+				var ok bool
+				select {
+				case in, ok = <-inputs:
+					if !ok {
+						return nil
+					}
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				out, err := fn(ctx, in)
+				if err != nil {
+					err = e.Fail(err)
+				} else {
+					err = e.Send(out)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		})
+	}
+}
+
+// Unmap feeds the inputs to fn and collects the whole stream.
+func Unmap[In, Out any](fn StreamFunc[In, Out]) func(ctx context.Context, inputs ...In) ([]Out, []error) {
+	return func(ctx context.Context, inputs ...In) ([]Out, []error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel() // stops feeding if the stream ends early
+		outs, errs := fn(ctx, FromSlice(ctx, inputs)).Collect()
+		if err := ctx.Err(); err != nil && !containsErr(errs, err) {
+			errs = append(errs, err)
+		}
+		return outs, errs
+	}
+}
+
+func containsErr(errs []error, target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func localeHello(ctx context.Context, lang string) (string, error) {
+	return generateHello("Alice", lang)
+}
+
+func TestAsyncSync(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	hello := Sync(Async(Func[string, string](localeHello)))
+	for _, lang := range []string{"en", "xx"} {
+		expectedMsg, expectedErr := generateHello("Alice", lang)
+		msg, err := hello(context.Background(), lang)
+		if msg != expectedMsg || !errEquals(err, expectedErr) {
+			t.Errorf("%s: got %q, %v, want %q, %v", lang, msg, err, expectedMsg, expectedErr)
+		}
+	}
+
+	slow := Sync(Async(func(ctx context.Context, lang string) (string, error) {
+		time.Sleep(time.Millisecond * 50)
+		return localeHello(ctx, lang)
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if _, err := slow(ctx, "en"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want deadline exceeded", err)
+	}
+}
+
+func TestMapUnmap(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	multi := Unmap(Map(Func[string, string](localeHello)))
+	for _, langs := range [][]string{{"hu", "en", "xx"}, {}, {"yy", "es", "fr"}} {
+		t.Run(strings.Join(langs, ","), func(t *testing.T) {
+			test := createTestCase("Alice", langs...)
+			greetings, errs := multi(context.Background(), langs...)
+			test.checkResults(t, greetings, errs)
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, errs := multi(ctx, "en", "fr")
+	if !containsErr(errs, context.Canceled) {
+		t.Errorf("errors = %v, want canceled", errs)
+	}
+}
@@ -1,79 +1,70 @@
-package main
+package async
 
 import (
 	"context"
 	"time"
+
+	"github.com/bukodi/go-playground/async/catalog"
 )
 
 type AsyncGreeterImpl struct {
 	delay time.Duration
+	// pool runs the greetings of all the calls. Without one every call
+	// greets in its own goroutine and streams one language at a time.
+	pool *Pool
+	// Catalog has the greetings, Greetings if not set.
+	Catalog *catalog.Catalog
+}
+
+// NewAsyncGreeter returns an AsyncGreeter answering after delay,
+// greeting up to parallel names or languages at a time over all calls.
+func NewAsyncGreeter(delay time.Duration, parallel int) *AsyncGreeterImpl {
+	return &AsyncGreeterImpl{delay: delay, pool: NewPool(parallel, 0)}
 }
 
 var _ AsyncGreeter = &AsyncGreeterImpl{}
 
 func (a AsyncGreeterImpl) SayHello(ctx context.Context, name string) <-chan string {
-	greetingCh := make(chan string)
-	go func() {
-		defer close(greetingCh)
-		select {
-		case <-ctx.Done():
-			return
-		case <-time.After(a.delay):
-		}
-		msg, _ := generateHello(name, "en")
-		greetingCh <- msg
-	}()
-	return greetingCh
+	return a.submit(ctx, name, "en").Chan()
 }
 
 func (a AsyncGreeterImpl) SayLocaleHello(ctx context.Context, name string, lang string) (<-chan string, <-chan error) {
-	greetingCh := make(chan string)
-	errCh := make(chan error)
-	go func() {
-		defer close(greetingCh)
-		defer close(errCh)
+	return a.submit(ctx, name, lang).Chans()
+}
 
-		select {
-		case <-ctx.Done():
-			errCh <- ctx.Err()
-			return
-		case <-time.After(a.delay):
-		}
+func (a AsyncGreeterImpl) SayMultiLangHello(ctx context.Context, name string, langCh <-chan string) (greetingsCh <-chan string, err <-chan error) {
+	hello := Func[string, string](func(ctx context.Context, lang string) (string, error) {
+		return a.hello(ctx, name, lang)
+	})
+	p := a.pool
+	if p == nil {
+		p = NewPool(1, 0)
+	}
+	return FanOut(p, hello)(ctx, langCh).Chans()
+}
 
-		msg, err := generateHello(name, lang)
-		if err != nil {
-			errCh <- err
-		} else {
-			greetingCh <- msg
-		}
-	}()
-	return greetingCh, errCh
+// submit greets on the pool. The call waits for a free worker in a
+// goroutine of its own, so the caller gets the channels at once.
+func (a AsyncGreeterImpl) submit(ctx context.Context, name string, lang string) *Future[string] {
+	hello := func(ctx context.Context) (string, error) {
+		return a.hello(ctx, name, lang)
+	}
+	if a.pool == nil {
+		return Go(ctx, hello)
+	}
+	return Go(ctx, func(ctx context.Context) (string, error) {
+		return Submit(ctx, a.pool, hello).Result()
+	})
 }
 
-func (a AsyncGreeterImpl) SayMultiLangHello(ctx context.Context, name string, langCh <-chan string) (greetingsCh <-chan string, err <-chan error) {
-	greetingCh := make(chan string)
-	errCh := make(chan error)
-	go func() {
-		defer close(greetingCh)
-		defer close(errCh)
-	loop:
-		for {
-			select {
-			case <-ctx.Done():
-				errCh <- ctx.Err()
-				break loop
-			case lang, ok := <-langCh:
-				if !ok {
-					break loop
-				}
-				msg, err := generateHello(name, lang)
-				if err != nil {
-					errCh <- err
-				} else {
-					greetingCh <- msg
-				}
-			}
-		}
-	}()
-	return greetingCh, errCh
+// hello greets after the delay, unless ctx is done first.
+func (a AsyncGreeterImpl) hello(ctx context.Context, name string, lang string) (string, error) {
+	timer := time.NewTimer(a.delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-timer.C:
+	}
+	return greet(a.Catalog, name, lang)
 }
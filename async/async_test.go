@@ -1,4 +1,4 @@
-package main
+package async
 
 import (
 	"context"
@@ -10,6 +10,8 @@ import (
 
 var asyncImpl AsyncGreeter = AsyncGreeterImpl{delay: time.Millisecond * 100}
 var wrappedSync AsyncGreeter = WrapToAsyncGreeter(SyncGreeterImpl{delay: time.Millisecond * 100})
+var parallelImpl AsyncGreeter = NewAsyncGreeter(time.Millisecond*100, 3)
+var wrappedParallel AsyncGreeter = WrapToParallelAsyncGreeter(SyncGreeterImpl{delay: time.Millisecond * 100}, NewPool(3, 0))
 
 func TestAsyncSayHello(t *testing.T)       { testAsyncSayHello(t, asyncImpl) }
 func TestWrappedSyncSayHello(t *testing.T) { testAsyncSayHello(t, wrappedSync) }
@@ -75,6 +77,10 @@ func testAsyncSayLocaleHello(t *testing.T, impl AsyncGreeter) {
 
 func TestAsyncSayMultiLangHello(t *testing.T)       { testAsyncSayMultiLangHello(t, asyncImpl) }
 func TestWrappedSyncSayMultiLangHello(t *testing.T) { testAsyncSayMultiLangHello(t, wrappedSync) }
+func TestParallelSayMultiLangHello(t *testing.T)    { testAsyncSayMultiLangHello(t, parallelImpl) }
+func TestWrappedParallelSayMultiLangHello(t *testing.T) {
+	testAsyncSayMultiLangHello(t, wrappedParallel)
+}
 
 func testAsyncSayMultiLangHello(t *testing.T, impl AsyncGreeter) {
 	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
@@ -115,3 +121,51 @@ func testAsyncSayMultiLangHello(t *testing.T, impl AsyncGreeter) {
 	//checkGoroutineLeakage(t, init)
 
 }
+
+func TestParallelSayMultiLangHelloDuration(t *testing.T) {
+	for name, impl := range map[string]AsyncGreeter{"parallel": parallelImpl, "wrapped parallel": wrappedParallel} {
+		t.Run(name, func(t *testing.T) {
+			defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+			test := createTestCase("Alice", "en", "xx", "fr", "hu", "es", "yy")
+			start := time.Now()
+			greetings, errs := WrapToSyncGreeter(context.Background(), impl).SayMultiLangHello("Alice", test.langs...)
+			// six languages three at a time, two rounds of the delay
+			if elapsed := time.Since(start); elapsed > time.Millisecond*280 {
+				t.Errorf("took %v, want about 200ms", elapsed)
+			}
+			if len(greetings) != len(test.greetings) || len(errs) != len(test.errs) {
+				t.Errorf("got %v, %v, want %v, %v", greetings, errs, test.greetings, test.errs)
+			}
+		})
+	}
+}
+
+func TestParallelLimitAcrossCalls(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	impl := NewAsyncGreeter(time.Millisecond*100, 2)
+	start := time.Now()
+	var chans []<-chan string
+	for i := 0; i < 2; i++ {
+		chans = append(chans, impl.SayHello(ctx, "Alice"))
+		msgCh, _ := impl.SayLocaleHello(ctx, "Alice", "hu")
+		chans = append(chans, msgCh)
+	}
+	langCh := make(chan string, 2)
+	langCh <- "en"
+	langCh <- "fr"
+	close(langCh)
+	msgCh, _ := impl.SayMultiLangHello(ctx, "Alice", langCh)
+	for _, ch := range chans {
+		<-ch
+	}
+	for range msgCh {
+	}
+	// six greetings two at a time, three rounds of the delay
+	if elapsed := time.Since(start); elapsed < time.Millisecond*290 {
+		t.Errorf("took %v, want about 300ms", elapsed)
+	}
+}
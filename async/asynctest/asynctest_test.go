@@ -0,0 +1,36 @@
+package asynctest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bukodi/go-playground/async"
+	"github.com/bukodi/go-playground/async/asynctest"
+)
+
+const latency = 10 * time.Millisecond
+
+func TestAsyncGreeter(t *testing.T) {
+	asynctest.TestGreeter(t, async.NewAsyncGreeter(latency, 1), latency)
+}
+
+func TestParallelAsyncGreeter(t *testing.T) {
+	asynctest.TestGreeter(t, async.NewAsyncGreeter(latency, 2), latency)
+}
+
+func TestWrappedSyncGreeter(t *testing.T) {
+	asynctest.TestGreeter(t, async.WrapToAsyncGreeter(async.SyncGreeterImpl{}), latency)
+}
+
+func TestWrappedParallelGreeter(t *testing.T) {
+	asynctest.TestGreeter(t, async.WrapToParallelAsyncGreeter(async.SyncGreeterImpl{}, async.NewPool(2, 0)), latency)
+}
+
+func TestGuardedGreeter(t *testing.T) {
+	policy := async.Chain(
+		&async.Breaker{},
+		&async.Retry{Initial: time.Millisecond, Timeout: 4 * latency},
+		&async.Hedge{Delay: 2 * latency},
+	)
+	asynctest.TestGreeter(t, async.GuardGreeter(async.NewAsyncGreeter(latency, 1), policy), latency)
+}
@@ -0,0 +1,123 @@
+package asynctest
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Grace is how long goroutines started by a scenario may take to end
+// once it is over.
+var Grace = time.Second
+
+type goroutine struct {
+	id    int
+	state string // such as "chan send" or "select"
+	stack string
+}
+
+// blocked tells whether the goroutine waits to send on a channel
+// nobody receives from.
+func (g goroutine) blocked() bool {
+	return strings.HasPrefix(g.state, "chan send")
+}
+
+// goroutines returns the running goroutines by id.
+func goroutines() map[int]goroutine {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	all := make(map[int]goroutine)
+	for _, stack := range strings.Split(strings.TrimSpace(string(buf)), "\n\n") {
+		var g goroutine
+		header := strings.SplitN(stack, "\n", 2)[0] // goroutine 7 [chan send]:
+		if _, err := fmt.Sscanf(header, "goroutine %d [", &g.id); err != nil {
+			continue
+		}
+		if i, j := strings.Index(header, "["), strings.LastIndex(header, "]"); i >= 0 && j > i {
+			g.state = header[i+1 : j]
+		}
+		g.stack = stack
+		all[g.id] = g
+	}
+	return all
+}
+
+// leakedSince waits up to grace for the goroutines started since
+// before to end and returns those still running.
+func leakedSince(before map[int]goroutine, grace time.Duration) []goroutine {
+	deadline := time.Now().Add(grace)
+	for {
+		var leaked []goroutine
+		for id, g := range goroutines() {
+			if _, ok := before[id]; !ok {
+				leaked = append(leaked, g)
+			}
+		}
+		if len(leaked) == 0 || time.Now().After(deadline) {
+			sort.Slice(leaked, func(i, j int) bool { return leaked[i].id < leaked[j].id })
+			return leaked
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// report describes the leaked goroutines with their stacks, the ones
+// blocked on a channel send first.
+func report(leaked []goroutine) string {
+	var b strings.Builder
+	var sends int
+	for _, g := range leaked {
+		if g.blocked() {
+			sends++
+		}
+	}
+	fmt.Fprintf(&b, "goroutine leak: %d goroutines left running", len(leaked))
+	if sends > 0 {
+		fmt.Fprintf(&b, ", %d blocked on a channel send nobody receives", sends)
+	}
+	sort.SliceStable(leaked, func(i, j int) bool { return leaked[i].blocked() && !leaked[j].blocked() })
+	for _, g := range leaked {
+		fmt.Fprintf(&b, "\n\n%s", g.stack)
+	}
+	return b.String()
+}
+
+// CheckGoroutines records the running goroutines and returns a function
+// failing t, with their stacks, if goroutines started since are still
+// running after Grace. Use it as
+//
+//	defer asynctest.CheckGoroutines(t)()
+//
+// Tests using it must not run in parallel with others.
+func CheckGoroutines(t testing.TB) func() {
+	before := goroutines()
+	return func() {
+		t.Helper()
+		if leaked := leakedSince(before, Grace); len(leaked) > 0 {
+			t.Errorf("%s", report(leaked))
+		}
+	}
+}
+
+// stacksSince returns the stacks of the goroutines started since
+// before, for reports of calls that did not complete.
+func stacksSince(before map[int]goroutine) string {
+	var stacks []string
+	for id, g := range goroutines() {
+		if _, ok := before[id]; !ok {
+			stacks = append(stacks, g.stack)
+		}
+	}
+	sort.Strings(stacks)
+	return strings.Join(stacks, "\n\n")
+}
@@ -0,0 +1,30 @@
+package asynctest
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLeakedSince(t *testing.T) {
+	before := goroutines()
+	if leaked := leakedSince(before, 0); len(leaked) != 0 {
+		t.Fatalf("leak without new goroutines:\n%s", report(leaked))
+	}
+
+	ch := make(chan int)
+	go func() { ch <- 1 }() // nobody receives
+	leaked := leakedSince(before, time.Millisecond*20)
+	if len(leaked) != 1 || !leaked[0].blocked() {
+		t.Fatalf("got %v, want the blocked sender", leaked)
+	}
+	if msg := report(leaked); !strings.Contains(msg, "1 blocked on a channel send") || !strings.Contains(msg, "TestLeakedSince") {
+		t.Errorf("report lacks the blocked sender:\n%s", msg)
+	}
+
+	go func() { time.Sleep(time.Millisecond * 20) }()
+	<-ch
+	if leaked := leakedSince(before, Grace); len(leaked) != 0 {
+		t.Errorf("goroutines ending in time reported:\n%s", report(leaked))
+	}
+}
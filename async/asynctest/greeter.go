@@ -0,0 +1,51 @@
+package asynctest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bukodi/go-playground/async"
+)
+
+// reference gives the outcome every AsyncGreeter must deliver.
+var reference async.Greeter = async.SyncGreeterImpl{}
+
+// TestGreeter runs every method of impl under the interleavings of
+// calls taking about latency. Streams are fed their input as they are
+// received, stopping once the context ended.
+func TestGreeter(t *testing.T, impl async.AsyncGreeter, latency time.Duration) {
+	interleavings := Interleavings(latency)
+
+	t.Run("SayHello", func(t *testing.T) {
+		Run(t, interleavings, func(ctx context.Context) (<-chan string, <-chan error) {
+			return impl.SayHello(ctx, "Alice"), nil
+		}, Want[string]{Vals: []string{reference.SayHello("Alice")}})
+	})
+
+	for _, lang := range []string{"hu", "xx"} {
+		lang := lang
+		t.Run("SayLocaleHello "+lang, func(t *testing.T) {
+			var want Want[string]
+			if greeting, err := reference.SayLocaleHello("Alice", lang); err != nil {
+				want.Errs = []error{err}
+			} else {
+				want.Vals = []string{greeting}
+			}
+			Run(t, interleavings, func(ctx context.Context) (<-chan string, <-chan error) {
+				return impl.SayLocaleHello(ctx, "Alice", lang)
+			}, want)
+		})
+	}
+
+	for _, langs := range [][]string{{"en", "xx", "fr"}, {}} {
+		langs := langs
+		t.Run("SayMultiLangHello "+strings.Join(langs, ","), func(t *testing.T) {
+			greetings, errs := reference.SayMultiLangHello("Alice", langs...)
+			Run(t, interleavings, func(ctx context.Context) (<-chan string, <-chan error) {
+				return impl.SayMultiLangHello(ctx, "Alice", async.FromSlice(ctx, langs))
+			}, Want[string]{Vals: greetings, Errs: errs, Stream: true})
+		})
+	}
+}
@@ -0,0 +1,207 @@
+// Package asynctest runs asynchronous calls under many cancel and
+// timeout interleavings and fails on calls that do not complete and on
+// goroutines left behind, such as senders blocked on a channel nobody
+// receives from any more. TestGreeter runs it against an AsyncGreeter.
+package asynctest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Timeout is how long a call may take to complete once its context
+// ended, before the scenario fails as a deadlock.
+var Timeout = time.Second
+
+// Receive is how much of the outcome of a call the caller receives.
+type Receive int
+
+const (
+	// All receives until the call completed.
+	All Receive = iota
+	// First receives one value or error, then goes away.
+	First
+	// None never receives.
+	None
+)
+
+func (r Receive) String() string {
+	return [...]string{"all", "first", "none"}[r]
+}
+
+// Interleaving is when the context of a call ends, relative to the
+// call, and how much of its outcome the caller receives. A caller
+// receiving less stays until the context ends; the context is always
+// cancelled once the scenario is over.
+type Interleaving struct {
+	// After is how long after the call the context ends; negative if
+	// it ended before the call.
+	After time.Duration
+	// Deadline ends the context by a deadline instead of cancel.
+	Deadline bool
+	// Forever keeps the context until the scenario is over, After
+	// later for callers receiving less than all.
+	Forever bool
+	Receive Receive
+}
+
+func (il Interleaving) String() string {
+	var end string
+	switch {
+	case il.Forever:
+		end = fmt.Sprintf("forever %v", il.After)
+	case il.After < 0 && il.Deadline:
+		end = "expired"
+	case il.After < 0:
+		end = "cancelled"
+	case il.Deadline:
+		end = fmt.Sprintf("deadline %v", il.After)
+	default:
+		end = fmt.Sprintf("cancel %v", il.After)
+	}
+	return end + ", receive " + il.Receive.String()
+}
+
+// Interleavings returns the interleavings to run calls under: the
+// context ending before, during and after calls taking about latency,
+// each receiving all, the first or none of the outcome.
+func Interleavings(latency time.Duration) []Interleaving {
+	ends := []Interleaving{{After: 2 * latency, Forever: true}}
+	for _, after := range []time.Duration{-1, 0, latency / 4, latency / 2, latency, 2 * latency} {
+		ends = append(ends, Interleaving{After: after}, Interleaving{After: after, Deadline: true})
+	}
+	var all []Interleaving
+	for _, end := range ends {
+		for _, r := range []Receive{All, First, None} {
+			end.Receive = r
+			all = append(all, end)
+		}
+	}
+	return all
+}
+
+// Call starts an asynchronous call with ctx and returns the channels
+// of its outcome; errCh is nil for calls without errors. A stream ends
+// once both channels are closed; any other call once it delivered a
+// value or an error, or closed the value channel.
+type Call[T any] func(ctx context.Context) (valCh <-chan T, errCh <-chan error)
+
+// Want is the outcome of a call whose context does not end, in any
+// order. Errors are compared by message.
+type Want[T comparable] struct {
+	Vals   []T
+	Errs   []error
+	Stream bool
+}
+
+// Run runs the call under every interleaving, each in a subtest. It
+// fails if the call does not complete in time, delivers anything but
+// the wanted values and errors or the context error, or leaves
+// goroutines running once the context ended.
+func Run[T comparable](t *testing.T, interleavings []Interleaving, call Call[T], want Want[T]) {
+	t.Helper()
+	for _, il := range interleavings {
+		il := il
+		t.Run(il.String(), func(t *testing.T) {
+			defer CheckGoroutines(t)()
+			runOne(t, il, call, want)
+		})
+	}
+}
+
+func runOne[T comparable](t *testing.T, il Interleaving, call Call[T], want Want[T]) {
+	before := goroutines()
+	start := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	switch {
+	case il.Forever:
+	case il.Deadline:
+		ctx, cancel = context.WithTimeout(ctx, il.After)
+		defer cancel()
+	case il.After < 0:
+		cancel()
+	default:
+		stop := time.AfterFunc(il.After, cancel)
+		defer stop.Stop()
+	}
+
+	valCh, errCh := call(ctx)
+	var vals []T
+	var errs []error
+	timeout := time.NewTimer(Timeout)
+	defer timeout.Stop()
+	for valCh != nil || errCh != nil {
+		received := len(vals) + len(errs)
+		if il.Receive == None || il.Receive == First && received > 0 || !want.Stream && received > 0 {
+			break
+		}
+		select {
+		case val, ok := <-valCh:
+			if !ok {
+				valCh = nil
+				if !want.Stream {
+					errCh = nil
+				}
+				continue
+			}
+			vals = append(vals, val)
+		case err, ok := <-errCh:
+			if !ok {
+				errCh = nil
+				continue
+			}
+			errs = append(errs, err)
+		case <-timeout.C:
+			t.Fatalf("deadlock: the call did not complete in %v, received %v, %v\n%s",
+				Timeout, vals, errs, stacksSince(before))
+		}
+	}
+	if il.After > 0 {
+		time.Sleep(time.Until(start.Add(il.After)))
+	}
+	cancel()
+
+	check(t, il, vals, errs, want)
+}
+
+// check compares the outcome received with the wanted one.
+func check[T comparable](t *testing.T, il Interleaving, vals []T, errs []error, want Want[T]) {
+	t.Helper()
+	wantVals := make(map[T]int)
+	for _, val := range want.Vals {
+		wantVals[val]++
+	}
+	wantErrs := make(map[string]int)
+	for _, err := range want.Errs {
+		wantErrs[err.Error()]++
+	}
+	for _, val := range vals {
+		if wantVals[val] == 0 {
+			t.Errorf("unexpected value %v", val)
+		}
+		wantVals[val]--
+	}
+	var ctxErrs int
+	for _, err := range errs {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			ctxErrs++
+			continue
+		}
+		if wantErrs[err.Error()] == 0 {
+			t.Errorf("unexpected error %v", err)
+		}
+		wantErrs[err.Error()]--
+	}
+	if il.Forever && il.Receive == All {
+		if ctxErrs > 0 {
+			t.Errorf("context error without the context ending: %v", errs)
+		}
+		if len(vals) != len(want.Vals) || len(errs) != len(want.Errs) {
+			t.Errorf("got %v, %v, want %v, %v", vals, errs, want.Vals, want.Errs)
+		}
+	}
+}
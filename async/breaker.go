@@ -0,0 +1,164 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrOpen is the error of calls rejected by an open Breaker.
+var ErrOpen = errors.New("async: circuit breaker open")
+
+// BreakerState is the state of a Breaker.
+type BreakerState int
+
+const (
+	// Closed lets every call through.
+	Closed BreakerState = iota
+	// Open rejects every call until the cooldown passed.
+	Open
+	// HalfOpen lets a single probe through, rejecting the others.
+	HalfOpen
+)
+
+func (s BreakerState) String() string {
+	return [...]string{"closed", "open", "half-open"}[s]
+}
+
+// Breaker stops making calls to a failing backend: after Failures
+// transient failures in a row it opens and rejects calls with ErrOpen
+// at once, so callers do not queue up behind a slow backend. Once the
+// cooldown passed it lets one probe through, closing again if the
+// probe succeeds and reopening if it fails.
+type Breaker struct {
+	Name     string        // label of the metrics
+	Failures int           // failures in a row opening the breaker, 5 if not set
+	Cooldown time.Duration // time until a probe, 1s if not set
+	// Transient tells which errors count as failures, IsTransient if
+	// not set; other errors are the caller's fault, not the backend's.
+	Transient func(err error) bool
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int // in a row
+	openedAt time.Time
+	stats    BreakerStats
+}
+
+// BreakerStats counts what a Breaker did.
+type BreakerStats struct {
+	State    BreakerState
+	Calls    int // calls let through, probes included
+	Rejected int // calls rejected with ErrOpen
+	Opened   int // times the breaker opened
+	Probes   int // calls let through half-open
+}
+
+var _ Policy = &Breaker{}
+
+func (b *Breaker) Do(ctx context.Context, call func(ctx context.Context) (any, error)) (any, error) {
+	probe, err := b.admit()
+	if err != nil {
+		return nil, err
+	}
+	val, err := call(ctx)
+	b.record(ctx, probe, err)
+	return val, err
+}
+
+// admit lets the call through or rejects it, and tells whether it is
+// the probe.
+func (b *Breaker) admit() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cooldown := b.Cooldown
+	if cooldown <= 0 {
+		cooldown = time.Second
+	}
+	switch {
+	case b.state == Open && time.Since(b.openedAt) >= cooldown:
+		b.state = HalfOpen
+		b.stats.Probes++
+		probe = true
+	case b.state != Closed:
+		b.stats.Rejected++
+		return false, ErrOpen
+	}
+	b.stats.Calls++
+	return probe, nil
+}
+
+func (b *Breaker) record(ctx context.Context, probe bool, err error) {
+	transient := b.Transient
+	if transient == nil {
+		transient = IsTransient
+	}
+	limit := b.Failures
+	if limit < 1 {
+		limit = 5
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// the caller went away, that tells nothing about the backend
+		if probe {
+			b.state = Open
+		}
+	case err != nil && transient(err):
+		b.failures++
+		if probe || b.failures >= limit {
+			b.state = Open
+			b.openedAt = time.Now()
+			b.stats.Opened++
+		}
+	default:
+		b.failures = 0
+		b.state = Closed
+	}
+}
+
+// State returns the state of the breaker.
+func (b *Breaker) State() BreakerState {
+	return b.Stats().State
+}
+
+// Stats returns what the policy did so far.
+func (b *Breaker) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.stats
+	s.State = b.state
+	return s
+}
+
+var (
+	breakerStateDesc = prometheus.NewDesc("async_breaker_state",
+		"State of the circuit breaker: 0 closed, 1 open, 2 half-open.", []string{"policy"}, nil)
+	breakerCallsDesc = prometheus.NewDesc("async_breaker_calls_total",
+		"Number of calls let through the circuit breaker.", []string{"policy"}, nil)
+	breakerRejectedDesc = prometheus.NewDesc("async_breaker_rejected_total",
+		"Number of calls rejected by the open circuit breaker.", []string{"policy"}, nil)
+	breakerOpenedDesc = prometheus.NewDesc("async_breaker_opened_total",
+		"Number of times the circuit breaker opened.", []string{"policy"}, nil)
+	breakerProbesDesc = prometheus.NewDesc("async_breaker_probes_total",
+		"Number of probes let through the half-open circuit breaker.", []string{"policy"}, nil)
+)
+
+func (b *Breaker) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{breakerStateDesc, breakerCallsDesc, breakerRejectedDesc, breakerOpenedDesc, breakerProbesDesc} {
+		ch <- d
+	}
+}
+
+func (b *Breaker) Collect(ch chan<- prometheus.Metric) {
+	s := b.Stats()
+	ch <- prometheus.MustNewConstMetric(breakerStateDesc, prometheus.GaugeValue, float64(s.State), b.Name)
+	ch <- prometheus.MustNewConstMetric(breakerCallsDesc, prometheus.CounterValue, float64(s.Calls), b.Name)
+	ch <- prometheus.MustNewConstMetric(breakerRejectedDesc, prometheus.CounterValue, float64(s.Rejected), b.Name)
+	ch <- prometheus.MustNewConstMetric(breakerOpenedDesc, prometheus.CounterValue, float64(s.Opened), b.Name)
+	ch <- prometheus.MustNewConstMetric(breakerProbesDesc, prometheus.CounterValue, float64(s.Probes), b.Name)
+}
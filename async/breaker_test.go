@@ -0,0 +1,84 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := &Breaker{Failures: 2, Cooldown: time.Millisecond * 20}
+	busy := Transient(errors.New("busy"))
+	do := func(err error) error {
+		_, got := Guard(context.Background(), b, func(ctx context.Context) (int, error) {
+			return 0, err
+		})
+		return got
+	}
+
+	// errors of the caller do not count
+	do(errors.New("unsupported lang"))
+	do(busy)
+	do(errors.New("unsupported lang"))
+	do(busy)
+	if b.State() != Closed {
+		t.Fatalf("opened without failures in a row")
+	}
+	do(busy)
+	if b.State() != Open {
+		t.Fatalf("state %v after failures in a row, want open", b.State())
+	}
+	if err := do(nil); err != ErrOpen {
+		t.Errorf("got %v, want %v", err, ErrOpen)
+	}
+
+	// a failing probe reopens
+	time.Sleep(time.Millisecond * 25)
+	if err := do(busy); err != busy || b.State() != Open {
+		t.Errorf("probe got %v, state %v, want reopened", err, b.State())
+	}
+	if err := do(nil); err != ErrOpen {
+		t.Errorf("got %v, want %v after the cooldown restarted", err, ErrOpen)
+	}
+
+	// a succeeding probe closes, other calls are rejected meanwhile
+	time.Sleep(time.Millisecond * 25)
+	probing := make(chan struct{})
+	release := make(chan struct{})
+	go Guard(context.Background(), b, func(ctx context.Context) (int, error) {
+		close(probing)
+		<-release
+		return 0, nil
+	})
+	<-probing
+	if b.State() != HalfOpen {
+		t.Errorf("state %v while probing, want half-open", b.State())
+	}
+	if err := do(nil); err != ErrOpen {
+		t.Errorf("got %v while probing, want %v", err, ErrOpen)
+	}
+	close(release)
+	for b.State() == HalfOpen {
+		time.Sleep(time.Millisecond)
+	}
+	if err := do(nil); err != nil || b.State() != Closed {
+		t.Errorf("got %v, state %v after the probe succeeded", err, b.State())
+	}
+	want := BreakerStats{State: Closed, Calls: 8, Rejected: 3, Opened: 2, Probes: 2}
+	if s := b.Stats(); s != want {
+		t.Errorf("got %+v, want %+v", s, want)
+	}
+}
+
+func TestBreakerCallerGone(t *testing.T) {
+	b := &Breaker{Failures: 1}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	Guard(ctx, b, func(ctx context.Context) (int, error) {
+		return 0, ctx.Err()
+	})
+	if b.State() != Closed {
+		t.Errorf("opened by a cancelled caller")
+	}
+}
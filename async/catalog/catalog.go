@@ -0,0 +1,190 @@
+// Package catalog formats messages from translation files, one file
+// per language named after its BCP-47 tag: hu.json, en-GB.yaml or
+// es.po. A language falls back to its parents and then to the fallback
+// language of the catalogue, so a message missing from hu-HU comes
+// from hu, or else from en. Messages may vary by the gender and by the
+// plural form of their arguments, and a catalogue opened from a
+// directory reloads itself when the files change.
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
+)
+
+// ErrUnsupportedLang is the error of formatting for a language that
+// neither the catalogue nor its parents have translations for.
+var ErrUnsupportedLang = errors.New("unsupported lang")
+
+// ErrNoMessage is the error of formatting a message that no language
+// of the fallback chain has.
+var ErrNoMessage = errors.New("catalog: no message")
+
+// Gender selects among the variants of a message; the variant "other"
+// is used for the zero Gender and for genders without a variant.
+type Gender string
+
+const (
+	Male   Gender = "male"
+	Female Gender = "female"
+)
+
+// Args are the arguments of a message, replacing the {name} and
+// {count} placeholders of its text. Count selects the plural form and
+// Gender the gender variant.
+type Args struct {
+	Name   string
+	Count  int
+	Gender Gender
+}
+
+// Catalog holds the messages of every language it was loaded with. It
+// is safe for concurrent use, also while reloading.
+type Catalog struct {
+	fsys     fs.FS
+	dir      string // the directory fsys reads, if opened from one
+	fallback language.Tag
+
+	mu    sync.RWMutex
+	langs map[language.Tag]messages
+}
+
+type messages map[string]*message
+
+// New loads the translation files in the root of fsys. The fallback
+// language must be among them.
+func New(fsys fs.FS, fallback string) (*Catalog, error) {
+	tag, err := language.Parse(fallback)
+	if err != nil {
+		return nil, fmt.Errorf("catalog: fallback language: %w", err)
+	}
+	c := &Catalog{fsys: fsys, fallback: tag}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Open loads the translation files in dir; Watch then reloads them
+// when they change.
+func Open(dir string, fallback string) (*Catalog, error) {
+	c, err := New(os.DirFS(dir), fallback)
+	if err != nil {
+		return nil, err
+	}
+	c.dir = dir
+	return c, nil
+}
+
+// Reload loads the translation files again. On failure the catalogue
+// keeps the messages it had.
+func (c *Catalog) Reload() error {
+	entries, err := fs.ReadDir(c.fsys, ".")
+	if err != nil {
+		return err
+	}
+	langs := make(map[language.Tag]messages)
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+		decode := decoders[ext]
+		if entry.IsDir() || decode == nil {
+			continue
+		}
+		tag, err := language.Parse(strings.TrimSuffix(entry.Name(), ext))
+		if err != nil {
+			return fmt.Errorf("catalog: %s: %w", entry.Name(), err)
+		}
+		data, err := fs.ReadFile(c.fsys, entry.Name())
+		if err != nil {
+			return err
+		}
+		msgs, err := decode(data, tag)
+		if err != nil {
+			return fmt.Errorf("catalog: %s: %w", entry.Name(), err)
+		}
+		if langs[tag] == nil {
+			langs[tag] = make(messages)
+		}
+		for key, m := range msgs {
+			if langs[tag][key] != nil {
+				return fmt.Errorf("catalog: %s: %s is translated twice for %s", entry.Name(), key, tag)
+			}
+			langs[tag][key] = m
+		}
+	}
+	if langs[c.fallback] == nil {
+		return fmt.Errorf("catalog: no translations for the fallback language %s", c.fallback)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.langs = langs
+	return nil
+}
+
+// Languages returns the tags of the languages with translations.
+func (c *Catalog) Languages() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var tags []string
+	for tag := range c.langs {
+		tags = append(tags, tag.String())
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Format returns the message key in the language lang, or in the first
+// language of its fallback chain that has it.
+func (c *Catalog) Format(lang string, key string, args Args) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	chain := c.chain(lang)
+	if chain == nil {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedLang, lang)
+	}
+	for _, tag := range chain {
+		if m := c.langs[tag][key]; m != nil {
+			return m.format(args), nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrNoMessage, key)
+}
+
+// chain returns the languages lang falls back to, those with
+// translations among lang and its parents followed by the fallback
+// language; nil if there are none of the former.
+func (c *Catalog) chain(lang string) []language.Tag {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return nil
+	}
+	var chain []language.Tag
+	for ; !tag.IsRoot(); tag = tag.Parent() {
+		if c.langs[tag] != nil {
+			chain = append(chain, tag)
+		}
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+	for _, t := range chain {
+		if t == c.fallback {
+			return chain
+		}
+	}
+	return append(chain, c.fallback)
+}
+
+// replace fills in the placeholders of text.
+func (a Args) replace(text string) string {
+	return strings.NewReplacer("{name}", a.Name, "{count}", strconv.Itoa(a.Count)).Replace(text)
+}
@@ -0,0 +1,195 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	c, err := Open("testdata", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(c.Languages(), " "); got != "en hu hu-HU pl" {
+		t.Errorf("Languages() = %s", got)
+	}
+	for _, tc := range []struct {
+		lang, key string
+		args      Args
+		want      string
+	}{
+		{"en", "hello", Args{Name: "Alice"}, "Hello Alice!"},
+		{"en-GB", "hello", Args{Name: "Alice"}, "Hello Alice!"},
+		{"hu", "hello", Args{Name: "Alice"}, "Szia Alice!"},
+		{"hu-HU", "hello", Args{Name: "Alice"}, "Szervusz Alice!"},
+		{"HU_hu", "hello", Args{Name: "Alice"}, "Szervusz Alice!"},
+		{"hu-HU", "visitors", Args{Count: 3}, "3 látogató"},
+		{"hu-HU", "bye", Args{Name: "Alice"}, "Bye Alice!"},
+		{"en", "visitors", Args{Count: 1}, "1 visitor"},
+		{"en", "visitors", Args{Count: 0}, "0 visitors"},
+		{"en", "welcome", Args{Name: "Alice", Gender: Female}, "Welcome, Ms Alice!"},
+		{"en", "welcome", Args{Name: "Bob", Gender: Male}, "Welcome, Mr Bob!"},
+		{"en", "welcome", Args{Name: "Kim"}, "Welcome, Kim!"},
+		{"pl", "hello", Args{Name: "Alice"}, "Cześć Alice!"},
+		{"pl", "bye", Args{Name: "Alice"}, "Bye Alice!"}, // untranslated
+		{"pl", "visitors", Args{Count: 1}, "1 gość"},
+		{"pl", "visitors", Args{Count: 3}, "3 goście"},
+		{"pl", "visitors", Args{Count: 12}, "12 gości"},
+		{"pl", "visitors", Args{Count: 22}, "22 goście"},
+		{"pl", "welcome", Args{Name: "Ewa", Gender: Female}, "Witaj, pani Ewa!"},
+		{"pl", "welcome", Args{Name: "Jan", Gender: Male}, "Witaj, panie Jan!"},
+		{"pl", "welcome", Args{Name: "Kim"}, "Witaj, Kim!"},
+	} {
+		if got, err := c.Format(tc.lang, tc.key, tc.args); got != tc.want || err != nil {
+			t.Errorf("Format(%s, %s) = %q, %v, want %q", tc.lang, tc.key, got, err, tc.want)
+		}
+	}
+
+	for _, lang := range []string{"de", "xx", "", "12"} {
+		_, err := c.Format(lang, "hello", Args{})
+		if !errors.Is(err, ErrUnsupportedLang) || err.Error() != "unsupported lang: "+lang {
+			t.Errorf("Format(%q) error = %v", lang, err)
+		}
+	}
+	if _, err := c.Format("hu", "missing", Args{}); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("Format(missing) error = %v", err)
+	}
+}
+
+func TestInvalidFiles(t *testing.T) {
+	for file, content := range map[string]string{
+		"en.json":       `{"hello": 1}`,
+		"en.yaml":       "hello:\n  few: x\n  some: y\n",
+		"en.po":         "msgid \"hello\"\n",
+		"xx-yy-zz.json": `{}`,
+		"de.json":       `{}`, // no fallback
+		"en.yml":        "welcome:\n  male: Mr\n",
+	} {
+		fsys := fstest.MapFS{file: {Data: []byte(content)}}
+		if file != "de.json" {
+			fsys["de.json"] = &fstest.MapFile{Data: []byte(`{}`)}
+		}
+		if _, err := New(fsys, "en"); err == nil {
+			t.Errorf("%s loaded from %q", file, content)
+		}
+	}
+	fsys := fstest.MapFS{
+		"en.json": {Data: []byte(`{"hello": "Hello"}`)},
+		"en.po":   {Data: []byte("msgid \"hello\"\nmsgstr \"Hi\"\n")},
+	}
+	if _, err := New(fsys, "en"); err == nil {
+		t.Errorf("message translated twice loaded")
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	for expr, want := range map[string][]int{ // for n = 0, 1, 2, 5, 11, 22, 101
+		"0":       {0, 0, 0, 0, 0, 0, 0},
+		"n != 1":  {1, 0, 1, 1, 1, 1, 1},
+		"(n > 1)": {0, 0, 1, 1, 1, 1, 1},
+		"n%10==1 && n%100!=11 ? 0 : n != 0 ? 1 : 2":  {2, 0, 1, 1, 1, 1, 0},
+		"n==1 ? 0 : n==2 ? 1 : (n>2 && n<7) ? 2 : 3": {3, 0, 1, 2, 3, 3, 3},
+		"!(n - 1) + n / 0":                           {0, 1, 0, 0, 0, 0, 0},
+	} {
+		rule, err := parseRule(expr)
+		if err != nil {
+			t.Errorf("parseRule(%q): %v", expr, err)
+			continue
+		}
+		for i, n := range []int{0, 1, 2, 5, 11, 22, 101} {
+			if got := rule(n); got != want[i] {
+				t.Errorf("%s for n = %d is %d, want %d", expr, n, got, want[i])
+			}
+		}
+	}
+	for _, expr := range []string{"", "n ==", "(n", "n ? 1", "x", "n 1"} {
+		if _, err := parseRule(expr); err == nil {
+			t.Errorf("parseRule(%q) accepted", expr)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	defer func(delay time.Duration) { ReloadDelay = delay }(ReloadDelay)
+	ReloadDelay = 10 * time.Millisecond
+	dir := t.TempDir()
+	write := func(file, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("en.json", `{"hello": "Hello {name}!"}`)
+	c, err := Open(dir, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reloads := make(chan error)
+	watched := make(chan error)
+	go func() {
+		watched <- c.Watch(ctx, func(err error) { reloads <- err })
+	}()
+	defer func() {
+		cancel()
+		if err := <-watched; err != nil {
+			t.Errorf("Watch() = %v", err)
+		}
+	}()
+	reload := func() error {
+		t.Helper()
+		select {
+		case err := <-reloads:
+			return err
+		case <-time.After(time.Second):
+			t.Fatal("not reloaded")
+			return nil
+		}
+	}
+	// lets the watcher start before changing the files
+	for {
+		write("en.json", `{"hello": "Hello {name}!"}`)
+		select {
+		case err := <-reloads:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(ReloadDelay * 5):
+			continue
+		}
+		break
+	}
+
+	write("de.json", `{"hello": "Hallo {name}!"}`)
+	if err := reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.Format("de-AT", "hello", Args{Name: "Alice"}); got != "Hallo Alice!" || err != nil {
+		t.Errorf("Format(de-AT) = %q, %v after adding de", got, err)
+	}
+
+	write("de.json", `{"hello": `)
+	if err := reload(); err == nil {
+		t.Errorf("broken file reloaded")
+	}
+	if got, _ := c.Format("de", "hello", Args{Name: "Alice"}); got != "Hallo Alice!" {
+		t.Errorf("Format(de) = %q after a failed reload", got)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "de.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Format("de", "hello", Args{}); !errors.Is(err, ErrUnsupportedLang) {
+		t.Errorf("Format(de) error = %v after removing de", err)
+	}
+}
@@ -0,0 +1,151 @@
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v2"
+)
+
+// message is a translation: a text, or its plural forms, and the
+// variants of those for other genders.
+type message struct {
+	text    string
+	plurals []string // indexed by rule, a missing form falls back to the first
+	rule    func(n int) int
+	genders map[Gender]*message
+}
+
+func (m *message) format(args Args) string {
+	if v := m.genders[args.Gender]; v != nil {
+		m = v
+	}
+	text := m.text
+	if len(m.plurals) > 0 {
+		text = m.plurals[0]
+		if i := m.rule(args.Count); i > 0 && i < len(m.plurals) && m.plurals[i] != "" {
+			text = m.plurals[i]
+		}
+	}
+	return args.replace(text)
+}
+
+// decoders decode translation files by their extension.
+var decoders = map[string]func(data []byte, tag language.Tag) (messages, error){
+	".json": decodeJSON,
+	".yaml": decodeYAML,
+	".yml":  decodeYAML,
+	".po":   decodePO,
+}
+
+// In JSON and YAML files every message is a text, or an object of the
+// CLDR plural forms of the text, or one of gender variants:
+//
+//	hello: "Szia {name}!"
+//	visitors:
+//	  one: "{count} visitor"
+//	  other: "{count} visitors"
+//	welcome:
+//	  female: "Welcome, Ms {name}!"
+//	  other: "Welcome, {name}!"
+//
+// Gender variants may have plural forms in turn.
+
+func decodeJSON(data []byte, tag language.Tag) (messages, error) {
+	var file map[string]interface{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	return decodeMessages(file, tag)
+}
+
+func decodeYAML(data []byte, tag language.Tag) (messages, error) {
+	var file map[string]interface{}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	return decodeMessages(file, tag)
+}
+
+func decodeMessages(file map[string]interface{}, tag language.Tag) (messages, error) {
+	msgs := make(messages)
+	for key, v := range file {
+		m, err := decodeMessage(v, tag, true)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		msgs[key] = m
+	}
+	return msgs, nil
+}
+
+// pluralForms are the names of the CLDR plural forms.
+var pluralForms = map[string]plural.Form{
+	"other": plural.Other,
+	"zero":  plural.Zero,
+	"one":   plural.One,
+	"two":   plural.Two,
+	"few":   plural.Few,
+	"many":  plural.Many,
+}
+
+func decodeMessage(v interface{}, tag language.Tag, genders bool) (*message, error) {
+	var variants map[string]interface{}
+	switch v := v.(type) {
+	case string:
+		return &message{text: v}, nil
+	case map[string]interface{}:
+		variants = v
+	case map[interface{}]interface{}: // from YAML
+		variants = make(map[string]interface{})
+		for k, val := range v {
+			variants[fmt.Sprint(k)] = val
+		}
+	default:
+		return nil, fmt.Errorf("%v is neither a text nor variants of one", v)
+	}
+	if genders && (variants[string(Male)] != nil || variants[string(Female)] != nil) {
+		m := &message{genders: make(map[Gender]*message)}
+		for k, val := range variants {
+			variant, err := decodeMessage(val, tag, false)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			switch Gender(k) {
+			case Male, Female:
+				m.genders[Gender(k)] = variant
+			case "other":
+				m.text, m.plurals, m.rule = variant.text, variant.plurals, variant.rule
+			default:
+				return nil, fmt.Errorf("unknown gender %q", k)
+			}
+		}
+		if variants["other"] == nil {
+			return nil, fmt.Errorf("no variant for other genders")
+		}
+		return m, nil
+	}
+	m := &message{
+		plurals: make([]string, len(pluralForms)),
+		rule: func(n int) int {
+			if n < 0 {
+				n = -n
+			}
+			return int(plural.Cardinal.MatchPlural(tag, n, 0, 0, 0, 0))
+		},
+	}
+	for k, val := range variants {
+		form, ok := pluralForms[k]
+		if !ok {
+			return nil, fmt.Errorf("unknown plural form %q", k)
+		}
+		text, ok := val.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: %v is not a text", k, val)
+		}
+		m.plurals[form] = text
+	}
+	return m, nil
+}
@@ -0,0 +1,175 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// In gettext files the msgid is the key of the message, msgstr[n] its
+// plural forms as numbered by the Plural-Forms header, and msgctxt
+// "male" or "female" marks a gender variant. Untranslated messages are
+// left to the fallback languages.
+
+type poEntry struct {
+	ctxt, id string
+	plural   bool
+	strs     []string
+}
+
+func decodePO(data []byte, tag language.Tag) (messages, error) {
+	entries, err := parsePO(data)
+	if err != nil {
+		return nil, err
+	}
+	rule := func(n int) int {
+		if n != 1 {
+			return 1
+		}
+		return 0
+	}
+	for _, e := range entries {
+		if e.id == "" && e.ctxt == "" {
+			r, err := headerRule(e.strs[0])
+			if err != nil {
+				return nil, err
+			}
+			if r != nil {
+				rule = r
+			}
+		}
+	}
+	msgs := make(messages)
+	for _, e := range entries {
+		if e.id == "" || !e.translated() {
+			continue
+		}
+		variant := &message{}
+		if e.plural {
+			variant.plurals, variant.rule = e.strs, rule
+		} else {
+			variant.text = e.strs[0]
+		}
+		m := msgs[e.id]
+		if m == nil {
+			m = &message{}
+			msgs[e.id] = m
+		}
+		switch Gender(e.ctxt) {
+		case "":
+			m.text, m.plurals, m.rule = variant.text, variant.plurals, variant.rule
+		case Male, Female:
+			if m.genders == nil {
+				m.genders = make(map[Gender]*message)
+			}
+			m.genders[Gender(e.ctxt)] = variant
+		default:
+			return nil, fmt.Errorf("%s: unknown gender %q", e.id, e.ctxt)
+		}
+	}
+	for key, m := range msgs {
+		if m.text == "" && m.plurals == nil {
+			return nil, fmt.Errorf("%s: no variant for other genders", key)
+		}
+	}
+	return msgs, nil
+}
+
+func (e *poEntry) translated() bool {
+	for _, s := range e.strs {
+		if s != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePO returns the entries of a gettext file.
+func parsePO(data []byte) ([]*poEntry, error) {
+	var (
+		entries []*poEntry
+		e       *poEntry
+		field   *string // continued by lines of strings
+	)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		keyword, quoted := line, ""
+		if i := strings.IndexByte(line, '"'); i >= 0 {
+			keyword, quoted = strings.TrimSpace(line[:i]), line[i:]
+		}
+		s, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid string %s", lineNo, quoted)
+		}
+		switch {
+		case keyword == "":
+			if field == nil {
+				return nil, fmt.Errorf("line %d: string outside an entry", lineNo)
+			}
+			*field += s
+			continue
+		case keyword == "msgctxt" || keyword == "msgid":
+			if e == nil || len(e.strs) > 0 {
+				e = &poEntry{}
+				entries = append(entries, e)
+			}
+			field = &e.id
+			if keyword == "msgctxt" {
+				field = &e.ctxt
+			}
+		case keyword == "msgid_plural" && e != nil:
+			e.plural = true
+			field = new(string) // the source text is not needed
+		case keyword == "msgstr" && e != nil:
+			e.strs = append(e.strs, "")
+			field = &e.strs[0]
+		case strings.HasPrefix(keyword, "msgstr[") && e != nil:
+			n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(keyword, "msgstr["), "]"))
+			if err != nil || n != len(e.strs) {
+				return nil, fmt.Errorf("line %d: unexpected %s", lineNo, keyword)
+			}
+			e.strs = append(e.strs, "")
+			field = &e.strs[n]
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %s", lineNo, keyword)
+		}
+		*field = s
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if len(e.strs) == 0 {
+			return nil, fmt.Errorf("%s: no msgstr", e.id)
+		}
+	}
+	return entries, nil
+}
+
+// headerRule returns the plural rule of the Plural-Forms header, nil
+// if there is none:
+//
+//	Plural-Forms: nplurals=2; plural=(n != 1);
+func headerRule(header string) (func(n int) int, error) {
+	for _, line := range strings.Split(header, "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "Plural-Forms") {
+			continue
+		}
+		for _, part := range strings.Split(value, ";") {
+			if name, expr, ok := strings.Cut(part, "="); ok && strings.TrimSpace(name) == "plural" {
+				return parseRule(expr)
+			}
+		}
+		return nil, fmt.Errorf("no plural rule in %q", line)
+	}
+	return nil, nil
+}
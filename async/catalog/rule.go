@@ -0,0 +1,191 @@
+package catalog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseRule compiles the plural expression of a gettext header, the C
+// subset of n, integers, parentheses, the arithmetic, comparison and
+// logical operators and the conditional operator.
+func parseRule(expr string) (func(n int) int, error) {
+	p := &ruleParser{src: expr}
+	p.next()
+	eval, err := p.conditional()
+	if err == nil && p.tok != "" {
+		err = fmt.Errorf("unexpected %q", p.tok)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("plural rule %q: %w", strings.TrimSpace(expr), err)
+	}
+	return eval, nil
+}
+
+type ruleParser struct {
+	src string
+	tok string // the current token, empty at the end
+}
+
+// operators are the tokens of more than one character.
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||"}
+
+func (p *ruleParser) next() {
+	p.src = strings.TrimSpace(p.src)
+	n := 0
+	switch {
+	case p.src == "":
+	case p.src[0] >= '0' && p.src[0] <= '9':
+		for n < len(p.src) && p.src[n] >= '0' && p.src[n] <= '9' {
+			n++
+		}
+	default:
+		n = 1
+		for _, op := range operators {
+			if strings.HasPrefix(p.src, op) {
+				n = len(op)
+			}
+		}
+	}
+	p.tok, p.src = p.src[:n], p.src[n:]
+}
+
+type evalFunc = func(n int) int
+
+func (p *ruleParser) conditional() (evalFunc, error) {
+	cond, err := p.binary(0)
+	if err != nil || p.tok != "?" {
+		return cond, err
+	}
+	p.next()
+	then, err := p.conditional()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != ":" {
+		return nil, fmt.Errorf("missing : of ?")
+	}
+	p.next()
+	otherwise, err := p.conditional()
+	if err != nil {
+		return nil, err
+	}
+	return func(n int) int {
+		if cond(n) != 0 {
+			return then(n)
+		}
+		return otherwise(n)
+	}, nil
+}
+
+// precedence lists the binary operators from the loosest binding.
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", ">", "<=", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *ruleParser) binary(level int) (evalFunc, error) {
+	if level == len(precedence) {
+		return p.unary()
+	}
+	x, err := p.binary(level + 1)
+	for err == nil && contains(precedence[level], p.tok) {
+		op := p.tok
+		p.next()
+		var y evalFunc
+		if y, err = p.binary(level + 1); err == nil {
+			x = apply(op, x, y)
+		}
+	}
+	return x, err
+}
+
+func (p *ruleParser) unary() (evalFunc, error) {
+	switch tok := p.tok; {
+	case tok == "!":
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(n int) int { return bool2int(x(n) == 0) }, nil
+	case tok == "(":
+		p.next()
+		x, err := p.conditional()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.next()
+		return x, nil
+	case tok == "n":
+		p.next()
+		return func(n int) int { return n }, nil
+	case tok != "" && tok[0] >= '0' && tok[0] <= '9':
+		p.next()
+		v, err := strconv.Atoi(tok)
+		return func(int) int { return v }, err
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end")
+	}
+	return nil, fmt.Errorf("unexpected %q", p.tok)
+}
+
+func apply(op string, x, y evalFunc) evalFunc {
+	return func(n int) int {
+		a, b := x(n), y(n)
+		switch op {
+		case "||":
+			return bool2int(a != 0 || b != 0)
+		case "&&":
+			return bool2int(a != 0 && b != 0)
+		case "==":
+			return bool2int(a == b)
+		case "!=":
+			return bool2int(a != b)
+		case "<":
+			return bool2int(a < b)
+		case ">":
+			return bool2int(a > b)
+		case "<=":
+			return bool2int(a <= b)
+		case ">=":
+			return bool2int(a >= b)
+		case "+":
+			return a + b
+		case "-":
+			return a - b
+		case "*":
+			return a * b
+		}
+		if b == 0 {
+			return 0
+		}
+		if op == "/" {
+			return a / b
+		}
+		return a % b
+	}
+}
+
+func bool2int(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
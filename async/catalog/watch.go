@@ -0,0 +1,56 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ReloadDelay is how long Watch waits after a change for the next
+// one, so a file saved in several writes is loaded once.
+var ReloadDelay = 100 * time.Millisecond
+
+// Watch reloads the catalogue when the files of its directory change,
+// until ctx is done. onReload, if set, is called with the result of
+// every reload; a failed one keeps the messages loaded before.
+func (c *Catalog) Watch(ctx context.Context, onReload func(err error)) error {
+	if c.dir == "" {
+		return errors.New("catalog: not opened from a directory")
+	}
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+	if err := fw.Add(c.dir); err != nil {
+		return err
+	}
+	settle := time.NewTimer(time.Hour)
+	settle.Stop()
+	defer settle.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-fw.Events:
+			if !ok {
+				return nil
+			}
+			settle.Reset(ReloadDelay)
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return nil
+			}
+			if onReload != nil {
+				onReload(err)
+			}
+		case <-settle.C:
+			err := c.Reload()
+			if onReload != nil {
+				onReload(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// Package example shows the asyncgen output for every supported
+// method shape; its generated test runs with the others.
+package example
+
+import (
+	"context"
+	"time"
+)
+
+//go:generate go run .. -type Store
+
+// Entry is a stored value.
+type Entry struct {
+	Key     string
+	Value   []byte
+	Created time.Time
+}
+
+// Store is a key-value store.
+type Store interface {
+	// Put stores the value under key.
+	Put(ctx context.Context, key string, value []byte) error
+	// Get returns the value stored under key.
+	Get(key string) ([]byte, error)
+	// Len returns the number of keys.
+	Len() int
+	// Keys lists the keys starting with any of the prefixes.
+	Keys(prefixes ...string) []string
+	// Delete removes the keys and returns the ones removed.
+	Delete(keys ...string) (removed []string, errs []error)
+	// Scan lists the entries created since from.
+	Scan(from time.Time) ([]Entry, error)
+	// Flush writes everything to disk.
+	Flush()
+}
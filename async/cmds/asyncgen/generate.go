@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+)
+
+// singular names the channel of a stream after its slice.
+func singular(name string) string {
+	switch {
+	case len(name) > 3 && strings.HasSuffix(name, "ies"):
+		return name[:len(name)-3] + "y"
+	case len(name) > 3 && (strings.HasSuffix(name, "xes") || strings.HasSuffix(name, "sses") ||
+		strings.HasSuffix(name, "ches") || strings.HasSuffix(name, "shes")):
+		return name[:len(name)-2]
+	case len(name) > 1 && strings.HasSuffix(name, "s"):
+		return name[:len(name)-1]
+	}
+	return name
+}
+
+func join(parts ...[]string) string {
+	var all []string
+	for _, p := range parts {
+		all = append(all, p...)
+	}
+	return strings.Join(all, ", ")
+}
+
+func (m *method) paramNames() []string {
+	var names []string
+	for _, p := range m.Params {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// syncParams is the parameter list of the synchronous method.
+func (m *method) syncParams() string {
+	var params []string
+	if m.Ctx != "" {
+		params = append(params, m.Ctx+" context.Context")
+	}
+	for _, p := range m.Params {
+		params = append(params, p.Name+" "+p.Type)
+	}
+	if m.Variadic != nil {
+		params = append(params, m.Variadic.Name+" ..."+m.Variadic.Type)
+	}
+	return strings.Join(params, ", ")
+}
+
+// syncResults is the result list of the synchronous method.
+func (m *method) syncResults() string {
+	switch m.Kind {
+	case errOnly:
+		return "error"
+	case value:
+		return m.Result
+	case valueErr:
+		return "(" + m.Result + ", error)"
+	case stream:
+		return "[]" + m.Result
+	case streamErrs:
+		return "([]" + m.Result + ", []error)"
+	case streamErr:
+		return "([]" + m.Result + ", error)"
+	}
+	return ""
+}
+
+func (m *method) inputCh() string {
+	return singular(m.Variadic.Name) + "Ch"
+}
+
+// asyncParams is the parameter list of the asynchronous method.
+func (m *method) asyncParams() string {
+	params := []string{"ctx context.Context"}
+	for _, p := range m.Params {
+		params = append(params, p.Name+" "+p.Type)
+	}
+	if m.Variadic != nil {
+		params = append(params, m.inputCh()+" <-chan "+m.Variadic.Type)
+	}
+	return strings.Join(params, ", ")
+}
+
+// asyncResults is the result list of the asynchronous method, named
+// after the synchronous results if those are named.
+func (m *method) asyncResults() string {
+	var valType string
+	switch m.Kind {
+	case none:
+		valType = "<-chan struct{}"
+	case errOnly:
+		if m.ResultName != "" {
+			return "(errCh <-chan error)"
+		}
+		return "<-chan error"
+	default:
+		valType = "<-chan " + m.Result
+	}
+	withErr := m.Kind == valueErr || m.Kind == streamErrs || m.Kind == streamErr
+	if m.ResultName == "" {
+		if withErr {
+			return "(" + valType + ", <-chan error)"
+		}
+		return valType
+	}
+	name := m.ResultName + "Ch"
+	if m.Kind.isStream() {
+		name = singular(m.ResultName) + "Ch"
+	}
+	if withErr {
+		return "(" + name + " " + valType + ", errCh <-chan error)"
+	}
+	return "(" + name + " " + valType + ")"
+}
+
+// writeHeader writes the package clause and the imports, the standard
+// library ones first.
+func writeHeader(b *bytes.Buffer, args, pkg string, imports []string) {
+	fmt.Fprintf(b, "// Code generated by asyncgen %s. DO NOT EDIT.\n\n", args)
+	fmt.Fprintf(b, "package %s\n\nimport (\n", pkg)
+	var std, other []string
+	for _, imp := range imports {
+		p := imp[strings.Index(imp, `"`):]
+		if strings.Contains(strings.SplitN(p, "/", 2)[0], ".") {
+			other = append(other, imp)
+		} else {
+			std = append(std, imp)
+		}
+	}
+	for _, imp := range std {
+		fmt.Fprintf(b, "\t%s\n", imp)
+	}
+	if len(std) > 0 && len(other) > 0 {
+		b.WriteString("\n")
+	}
+	for _, imp := range other {
+		fmt.Fprintf(b, "\t%s\n", imp)
+	}
+	b.WriteString(")\n")
+}
+
+// generate writes the asynchronous interface and both wrappers.
+func generate(it *iface) ([]byte, error) {
+	var b bytes.Buffer
+	imports := []string{`"context"`}
+	if it.Lib != "" {
+		imports = append(imports, `"`+libPath+`"`)
+	}
+	writeHeader(&b, "-type "+it.Name, it.Package, append(imports, it.Imports...))
+	q := it.Lib
+
+	fmt.Fprintf(&b, "\n// Async%[1]s is the context-aware asynchronous form of %[1]s.\n", it.Name)
+	fmt.Fprintf(&b, "type Async%s interface {\n", it.Name)
+	for i, m := range it.Methods {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		for _, line := range m.Doc {
+			fmt.Fprintf(&b, "\t%s\n", line)
+		}
+		fmt.Fprintf(&b, "\t%s(%s) %s\n", m.Name, m.asyncParams(), m.asyncResults())
+	}
+	b.WriteString("}\n")
+
+	fmt.Fprintf(&b, `
+// WrapToAsync%[1]s serves an Async%[1]s with a %[1]s, running every
+// call in its own goroutine.
+func WrapToAsync%[1]s(impl %[1]s) Async%[1]s {
+	return &syncToAsync%[1]s{impl: impl}
+}
+
+var _ Async%[1]s = &syncToAsync%[1]s{}
+
+type syncToAsync%[1]s struct {
+	impl %[1]s
+}
+`, it.Name)
+	for _, m := range it.Methods {
+		fmt.Fprintf(&b, "\nfunc (w syncToAsync%s) %s(%s) %s {\n", it.Name, m.Name, m.asyncParams(), m.asyncResults())
+		writeSyncToAsync(&b, q, m)
+		b.WriteString("}\n")
+	}
+
+	fmt.Fprintf(&b, `
+// WrapToSync%[1]s serves a %[1]s with an Async%[1]s, waiting for the
+// outcome of every call unless ctx is done first.
+func WrapToSync%[1]s(ctx context.Context, impl Async%[1]s) %[1]s {
+	return &asyncToSync%[1]s{ctx: ctx, impl: impl}
+}
+
+var _ %[1]s = &asyncToSync%[1]s{}
+
+type asyncToSync%[1]s struct {
+	impl Async%[1]s
+	ctx  context.Context
+}
+`, it.Name)
+	for _, m := range it.Methods {
+		fmt.Fprintf(&b, "\nfunc (w asyncToSync%s) %s(%s) %s {\n", it.Name, m.Name, m.syncParams(), m.syncResults())
+		writeAsyncToSync(&b, q, m)
+		b.WriteString("}\n")
+	}
+	return formatSource(b.Bytes())
+}
+
+func formatSource(src []byte) ([]byte, error) {
+	formatted, err := format.Source(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid generated code: %w\n%s", err, src)
+	}
+	return formatted, nil
+}
+
+// writeSyncToAsync writes the body of an asynchronous method calling
+// the synchronous one.
+func writeSyncToAsync(b *bytes.Buffer, q string, m *method) {
+	var ctxArg, variadicArg []string
+	if m.Ctx != "" {
+		ctxArg = []string{"ctx"}
+	}
+	if m.Variadic != nil {
+		variadicArg = []string{m.Variadic.Name + "..."}
+	}
+	call := fmt.Sprintf("w.impl.%s(%s)", m.Name, join(ctxArg, m.paramNames(), variadicArg))
+
+	if !m.Kind.isStream() {
+		resultType := m.Result
+		if m.Kind == none || m.Kind == errOnly {
+			resultType = "struct{}"
+		}
+		fmt.Fprintf(b, "\treturn %sGo(ctx, func(ctx context.Context) (%s, error) {\n", q, resultType)
+		if m.Variadic != nil {
+			fmt.Fprintf(b, "\t\t%s, err := %sDrain(ctx, %s)\n", m.Variadic.Name, q, m.inputCh())
+			fmt.Fprintf(b, "\t\tif err != nil {\n\t\t\treturn *new(%s), err\n\t\t}\n", resultType)
+		}
+		switch m.Kind {
+		case none:
+			fmt.Fprintf(b, "\t\t%s\n\t\treturn struct{}{}, nil\n\t}).Chan()\n", call)
+		case value:
+			fmt.Fprintf(b, "\t\treturn %s, nil\n\t}).Chan()\n", call)
+		case errOnly:
+			fmt.Fprintf(b, "\t\treturn struct{}{}, %s\n\t}).Err()\n", call)
+		case valueErr:
+			fmt.Fprintf(b, "\t\treturn %s\n\t}).Chans()\n", call)
+		}
+		return
+	}
+
+	if m.Kind == stream {
+		b.WriteString("\tvalCh, _ := ")
+	} else {
+		b.WriteString("\treturn ")
+	}
+	fmt.Fprintf(b, "%sNewStream(ctx, func(ctx context.Context, e %sEmitter[%s]) error {\n", q, q, m.Result)
+	if m.Variadic != nil {
+		fmt.Fprintf(b, "\t\t%s, err := %sDrain(ctx, %s)\n", m.Variadic.Name, q, m.inputCh())
+		b.WriteString("\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n")
+	}
+	send := "\t\tfor _, val := range vals {\n\t\t\tif err := e.Send(val); err != nil {\n\t\t\t\treturn err\n\t\t\t}\n\t\t}\n"
+	switch m.Kind {
+	case stream:
+		fmt.Fprintf(b, "\t\tvals := %s\n%s\t\treturn nil\n\t}).Chans()\n\treturn valCh\n", call, send)
+	case streamErrs:
+		fmt.Fprintf(b, "\t\tvals, errs := %s\n", call)
+		b.WriteString("\t\tfor _, err := range errs {\n\t\t\tif err == nil {\n\t\t\t\tcontinue\n\t\t\t}\n")
+		b.WriteString("\t\t\tif err := e.Fail(err); err != nil {\n\t\t\t\treturn err\n\t\t\t}\n\t\t}\n")
+		fmt.Fprintf(b, "%s\t\treturn nil\n\t}).Chans()\n", send)
+	case streamErr:
+		fmt.Fprintf(b, "\t\tvals, err := %s\n%s\t\treturn err\n\t}).Chans()\n", call, send)
+	}
+}
+
+// writeAsyncToSync writes the body of a synchronous method calling
+// the asynchronous one.
+func writeAsyncToSync(b *bytes.Buffer, q string, m *method) {
+	ctx := "w.ctx"
+	if m.Ctx != "" {
+		ctx = m.Ctx
+	}
+	var inputArg []string
+	if m.Variadic != nil {
+		// stops feeding the input once the call is over
+		fmt.Fprintf(b, "\tctx, cancel := context.WithCancel(%s)\n\tdefer cancel()\n", ctx)
+		ctx = "ctx"
+		inputArg = []string{fmt.Sprintf("%sFromSlice(ctx, %s)", q, m.Variadic.Name)}
+	}
+	call := fmt.Sprintf("w.impl.%s(%s)", m.Name, join([]string{ctx}, m.paramNames(), inputArg))
+	switch m.Kind {
+	case none:
+		fmt.Fprintf(b, "\t%sFutureOf(%s, %s, nil).Result()\n", q, ctx, call)
+	case value:
+		fmt.Fprintf(b, "\tval, _ := %sFutureOf(%s, %s, nil).Result()\n\treturn val\n", q, ctx, call)
+	case errOnly:
+		fmt.Fprintf(b, "\t_, err := %sFutureOf[struct{}](%s, nil, %s).Result()\n\treturn err\n", q, ctx, call)
+	case valueErr:
+		fmt.Fprintf(b, "\tvalCh, errCh := %s\n\treturn %sFutureOf(%s, valCh, errCh).Result()\n", call, q, ctx)
+	case stream:
+		fmt.Fprintf(b, "\tvals, _ := %sStreamOf(%s, %s, nil).Collect()\n\treturn vals\n", q, ctx, call)
+	case streamErrs:
+		fmt.Fprintf(b, "\tvalCh, errCh := %s\n\treturn %sStreamOf(%s, valCh, errCh).Collect()\n", call, q, ctx)
+	case streamErr:
+		fmt.Fprintf(b, "\tvalCh, errCh := %s\n\tvals, errs := %sStreamOf(%s, valCh, errCh).Collect()\n", call, q, ctx)
+		b.WriteString("\tif len(errs) > 0 {\n\t\treturn vals, errs[0]\n\t}\n\treturn vals, nil\n")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGeneratedUpToDate regenerates the checked-in files and fails if
+// they differ, so changes to the generator are not forgotten.
+func TestGeneratedUpToDate(t *testing.T) {
+	for _, tc := range []struct{ dir, typ string }{
+		{"../..", "Greeter"},
+		{"example", "Store"},
+	} {
+		it, err := parseInterface(tc.dir, tc.typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src, err := generate(it)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testSrc, err := generateTest(it)
+		if err != nil {
+			t.Fatal(err)
+		}
+		base := filepath.Join(tc.dir, strings.ToLower(tc.typ))
+		for file, want := range map[string][]byte{
+			base + "_async.go":      src,
+			base + "_async_test.go": testSrc,
+		} {
+			got, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s is out of date, run go generate", file)
+			}
+		}
+	}
+}
+
+func TestGeneratedRPCUpToDate(t *testing.T) {
+	it, err := parseInterface("../..", "Greeter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := "../../../rpc/greeter_rpc.go"
+	target, err := newRPCTarget(it, "../..", filepath.Dir(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := generateRPC(it, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s is out of date, run go generate", output)
+	}
+}
+
+func TestUnsupportedResults(t *testing.T) {
+	dir := t.TempDir()
+	src := "package p\n\ntype Bad interface {\n\tM() (int, string)\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "p.go"), []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseInterface(dir, "Bad"); err == nil {
+		t.Errorf("parseInterface accepted (int, string) results")
+	}
+	if _, err := parseInterface(dir, "Missing"); err == nil {
+		t.Errorf("parseInterface found a missing interface")
+	}
+}
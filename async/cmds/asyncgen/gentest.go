@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// inputCount is how many values the test feeds to input channels.
+const inputCount = 3
+
+// zeroArgs returns the zero value of every parameter but the context
+// and the variadic one.
+func (m *method) zeroArgs() []string {
+	var args []string
+	for _, p := range m.Params {
+		args = append(args, "*new("+p.Type+")")
+	}
+	return args
+}
+
+// stubResults is the return statement of the stub, one element per
+// input for streams.
+func (m *method) stubResults() string {
+	n := "1"
+	if m.Variadic != nil {
+		n = "len(" + m.Variadic.Name + ")"
+	}
+	switch m.Kind {
+	case value:
+		return "return *new(" + m.Result + ")"
+	case errOnly:
+		return "return nil"
+	case valueErr:
+		return "return *new(" + m.Result + "), nil"
+	case stream:
+		return "return make([]" + m.Result + ", " + n + ")"
+	case streamErrs, streamErr:
+		return "return make([]" + m.Result + ", " + n + "), nil"
+	}
+	return ""
+}
+
+// receive is the code receiving the whole outcome of the asynchronous
+// call stored in valCh and errCh.
+func (m *method) receive() string {
+	switch m.Kind {
+	case none, value:
+		return "<-valCh"
+	case errOnly:
+		return "<-errCh"
+	case valueErr:
+		return "select {\ncase <-valCh:\ncase <-errCh:\n}"
+	case stream:
+		return "for range valCh {\n}"
+	}
+	return `for valCh != nil || errCh != nil {
+	select {
+	case _, ok := <-valCh:
+		if !ok {
+			valCh = nil
+		}
+	case _, ok := <-errCh:
+		if !ok {
+			errCh = nil
+		}
+	}
+}`
+}
+
+// outcome is the left hand side assigning the results of the
+// asynchronous call.
+func (m *method) outcome() string {
+	switch m.Kind {
+	case errOnly:
+		return "errCh"
+	case valueErr, streamErrs, streamErr:
+		return "valCh, errCh"
+	}
+	return "valCh"
+}
+
+// generateTest writes a test running every method through both
+// wrappers around a stub, failing on calls that do not complete and
+// on goroutines left behind, in the style of deadlock_test.go.
+func generateTest(it *iface) ([]byte, error) {
+	var b bytes.Buffer
+	imports := []string{`"context"`, `"runtime"`, `"testing"`, `"time"`}
+	writeHeader(&b, "-type "+it.Name, it.Package, append(imports, it.Imports...))
+	name := it.Name
+
+	fmt.Fprintf(&b, "\n// stub%[1]s answers every call of %[1]s at once with zero values,\n// one per input for streams.\ntype stub%[1]s struct{}\n", name)
+	for _, m := range it.Methods {
+		fmt.Fprintf(&b, "\nfunc (stub%s) %s(%s) %s {\n\t%s\n}\n", name, m.Name, m.syncParams(), m.syncResults(), m.stubResults())
+	}
+
+	fmt.Fprintf(&b, "\nfunc Test%sAsyncDeadlock(t *testing.T) {\n", name)
+	fmt.Fprintf(&b, "\tdefer check%sGoroutines(t, runtime.NumGoroutine())\n\n", name)
+	fmt.Fprintf(&b, "\timpl := WrapToAsync%s(stub%s{})\n", name, name)
+	for _, m := range it.Methods {
+		var input []string
+		if m.Variadic != nil {
+			input = []string{"inCh"}
+		}
+		args := join([]string{"ctx"}, m.zeroArgs(), input)
+
+		fmt.Fprintf(&b, "\n\tt.Run(%q, func(t *testing.T) {\n", m.Name)
+		b.WriteString("\t\tctx, cancel := context.WithCancel(context.Background())\n\t\tdefer cancel()\n")
+		if m.Variadic != nil {
+			fmt.Fprintf(&b, "\t\tinCh := make(chan %s)\n", m.Variadic.Type)
+		}
+		fmt.Fprintf(&b, "\t\t%s := impl.%s(%s)\n", m.outcome(), m.Name, args)
+		b.WriteString("\t\tdone := make(chan struct{})\n\t\tgo func() {\n\t\t\tdefer close(done)\n")
+		fmt.Fprintf(&b, "\t\t\t%s\n\t\t}()\n", indent(m.receive(), "\t\t\t"))
+		if m.Variadic != nil {
+			fmt.Fprintf(&b, "\t\tfor i := 0; i < %d; i++ {\n\t\t\tselect {\n", inputCount)
+			fmt.Fprintf(&b, "\t\t\tcase inCh <- *new(%s):\n", m.Variadic.Type)
+			fmt.Fprintf(&b, "\t\t\tcase <-time.After(time.Second):\n\t\t\t\tt.Fatalf(\"deadlock: %s stopped receiving its input\\n%%s\", stacks%s())\n", m.Name, name)
+			b.WriteString("\t\t\t}\n\t\t}\n")
+			b.WriteString("\t\t// the call only completes once its input is closed\n\t\tclose(inCh)\n")
+		}
+		fmt.Fprintf(&b, "\t\twait%s(t, done, %q)\n\t})\n", name, m.Name)
+
+		fmt.Fprintf(&b, "\n\tt.Run(%q, func(t *testing.T) {\n", m.Name+" abandoned")
+		b.WriteString("\t\tctx, cancel := context.WithCancel(context.Background())\n")
+		if m.Variadic != nil {
+			fmt.Fprintf(&b, "\t\tinCh := make(chan %s)\n", m.Variadic.Type)
+		}
+		fmt.Fprintf(&b, "\t\timpl.%s(%s)\n", m.Name, args)
+		b.WriteString("\t\t// neither receiving nor closing the input, the goroutines must\n\t\t// still end\n\t\tcancel()\n\t})\n")
+
+		var ctxArg, inputs []string
+		if m.Ctx != "" {
+			ctxArg = []string{"context.Background()"}
+		}
+		if m.Variadic != nil {
+			for i := 0; i < inputCount; i++ {
+				inputs = append(inputs, "*new("+m.Variadic.Type+")")
+			}
+		}
+		fmt.Fprintf(&b, "\n\tt.Run(%q, func(t *testing.T) {\n", m.Name+" sync")
+		fmt.Fprintf(&b, "\t\tsyncImpl := WrapToSync%s(context.Background(), impl)\n", name)
+		b.WriteString("\t\tdone := make(chan struct{})\n\t\tgo func() {\n\t\t\tdefer close(done)\n")
+		fmt.Fprintf(&b, "\t\t\tsyncImpl.%s(%s)\n\t\t}()\n", m.Name, join(ctxArg, m.zeroArgs(), inputs))
+		fmt.Fprintf(&b, "\t\twait%s(t, done, %q)\n\t})\n", name, m.Name)
+	}
+	b.WriteString("}\n")
+
+	fmt.Fprintf(&b, `
+// wait%[1]s fails the test if the call did not complete in time.
+func wait%[1]s(t *testing.T, done <-chan struct{}, call string) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("deadlock: %%s did not complete\n%%s", call, stacks%[1]s())
+	}
+}
+
+// check%[1]sGoroutines fails the test if goroutines started since
+// before are still running.
+func check%[1]sGoroutines(t *testing.T, before int) {
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Errorf("goroutine leak: %%d goroutines left running\n%%s", runtime.NumGoroutine()-before, stacks%[1]s())
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func stacks%[1]s() string {
+	buf := make([]byte, 1<<20)
+	return string(buf[:runtime.Stack(buf, true)])
+}
+`, name)
+	return formatSource(b.Bytes())
+}
+
+func indent(code, prefix string) string {
+	return strings.ReplaceAll(code, "\n", "\n"+prefix)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+  asyncgen command
+
+  usage:
+
+    //go:generate go run github.com/bukodi/go-playground/async/cmds/asyncgen -type Greeter
+
+  Reads the synchronous interface from the Go files of the current
+  directory and writes, next to them, {type}_async.go with
+
+    Async{Type}           the context-aware asynchronous interface
+    WrapToAsync{Type}     serving an Async{Type} with a {Type}
+    WrapToSync{Type}      serving a {Type} with an Async{Type}
+
+  and {type}_async_test.go with a deadlock and goroutine leak test of
+  both wrappers. With -rpc it writes {type}_rpc.go instead, into the
+  current directory, with
+
+    New{Type}Client       an Async{Type} making its calls with the rpc package
+    Register{Type}        serving those calls with an Async{Type}
+
+    //go:generate go run github.com/bukodi/go-playground/async/cmds/asyncgen -type Greeter -dir ../async -rpc
+
+  Every method gets a context first, unless it already takes one. A
+  variadic parameter becomes an input channel; a slice result becomes
+  a stream, delivered on a value channel and, for []error or error
+  results, an error channel. Other results become a value channel, an
+  error channel or both. The wrappers are built on the async package.
+  Over rpc, methods with an input channel are client streaming calls,
+  methods returning a stream server streaming ones, and with both
+  bidirectional streaming calls.
+
+*/
+
+func main() {
+	var fatalErr error
+	defer func() {
+		if fatalErr != nil {
+			flag.PrintDefaults()
+			log.Fatalln(fatalErr)
+		}
+	}()
+	var (
+		typeName = flag.String("type", "", "name of the synchronous interface")
+		dir      = flag.String("dir", ".", "directory of the package declaring the interface")
+		output   = flag.String("output", "", "output file, the test is written next to it (default {type}_async.go)")
+		noTest   = flag.Bool("notest", false, "do not write the deadlock test")
+		rpc      = flag.Bool("rpc", false, "write an rpc client and server registration instead (default output {type}_rpc.go)")
+	)
+	flag.Parse()
+	if *typeName == "" {
+		fatalErr = errors.New("must specify -type")
+		return
+	}
+	if *output == "" && *rpc {
+		*output = strings.ToLower(*typeName) + "_rpc.go"
+	} else if *output == "" {
+		*output = filepath.Join(*dir, strings.ToLower(*typeName)+"_async.go")
+	}
+	iface, err := parseInterface(*dir, *typeName)
+	if err != nil {
+		fatalErr = err
+		return
+	}
+	if *rpc {
+		fatalErr = writeRPC(iface, *dir, *output)
+		return
+	}
+	src, err := generate(iface)
+	if err != nil {
+		fatalErr = err
+		return
+	}
+	if fatalErr = ioutil.WriteFile(*output, src, 0666); fatalErr != nil {
+		return
+	}
+	testFile := strings.TrimSuffix(*output, ".go") + "_test.go"
+	if *noTest {
+		return
+	}
+	if src, err = generateTest(iface); err != nil {
+		fatalErr = err
+		return
+	}
+	if fatalErr = ioutil.WriteFile(testFile, src, 0666); fatalErr != nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "asyncgen: wrote %s and %s\n", *output, testFile)
+}
+
+func writeRPC(iface *iface, dir, output string) error {
+	target, err := newRPCTarget(iface, dir, filepath.Dir(output))
+	if err != nil {
+		return err
+	}
+	src, err := generateRPC(iface, target)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(output, src, 0666); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "asyncgen: wrote %s\n", output)
+	return nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// libPath is the import path of the async package the wrappers are
+// built on.
+const libPath = "github.com/bukodi/go-playground/async"
+
+// resultKind tells how the results of a synchronous method are
+// delivered asynchronously.
+type resultKind int
+
+const (
+	none       resultKind = iota // ()
+	value                        // (T)
+	errOnly                      // (error)
+	valueErr                     // (T, error)
+	stream                       // ([]T)
+	streamErrs                   // ([]T, []error)
+	streamErr                    // ([]T, error)
+)
+
+func (k resultKind) isStream() bool {
+	return k >= stream
+}
+
+type param struct {
+	Name  string
+	Type  string
+	QType string // Type qualified for use outside the package
+}
+
+type method struct {
+	Name     string
+	Doc      []string // comment lines, with the slashes
+	Ctx      string   // name of the context parameter, if the method has one
+	Params   []param  // the other parameters, without the variadic one
+	Variadic *param   // Type is the element type
+	Kind     resultKind
+	Result   string // type of the value, or of the stream elements
+	QResult  string // Result qualified for use outside the package
+	// ResultName is the name of the first result, if named.
+	ResultName string
+}
+
+type iface struct {
+	Name    string
+	Package string
+	Lib     string   // qualifier of the async package, empty inside it
+	Imports []string // import specs used by the method signatures
+	Methods []*method
+}
+
+// parseInterface finds the named interface among the Go files of dir.
+func parseInterface(dir, name string) (*iface, error) {
+	fset := token.NewFileSet()
+	notTest := func(info os.FileInfo) bool { return !strings.HasSuffix(info.Name(), "_test.go") }
+	pkgs, err := parser.ParseDir(fset, dir, notTest, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					ts := spec.(*ast.TypeSpec)
+					if ts.Name.Name != name {
+						continue
+					}
+					it, ok := ts.Type.(*ast.InterfaceType)
+					if !ok {
+						return nil, fmt.Errorf("%s is not an interface", name)
+					}
+					return newIface(fset, file, name, it)
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("interface %s not found in %s", name, dir)
+}
+
+func newIface(fset *token.FileSet, file *ast.File, name string, it *ast.InterfaceType) (*iface, error) {
+	i := &iface{Name: name, Package: file.Name.Name}
+	if i.Package != path.Base(libPath) {
+		i.Lib = path.Base(libPath) + "."
+	}
+	used := make(map[string]bool)
+	typeString := func(expr ast.Expr, qualified bool) string {
+		var local []*ast.Ident // type names declared in the package
+		ast.Inspect(expr, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SelectorExpr:
+				if pkg, ok := n.X.(*ast.Ident); ok {
+					used[pkg.Name] = true
+				}
+				return false
+			case *ast.Ident:
+				if types.Universe.Lookup(n.Name) == nil {
+					local = append(local, n)
+				}
+			}
+			return true
+		})
+		if qualified {
+			for _, id := range local {
+				id.Name = i.Package + "." + id.Name
+				defer func(id *ast.Ident) { id.Name = strings.TrimPrefix(id.Name, i.Package+".") }(id)
+			}
+		}
+		var buf bytes.Buffer
+		printer.Fprint(&buf, fset, expr)
+		return buf.String()
+	}
+	for _, field := range it.Methods.List {
+		if len(field.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded interfaces are not supported", name)
+		}
+		m, err := newMethod(field, typeString)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", name, field.Names[0].Name, err)
+		}
+		i.Methods = append(i.Methods, m)
+	}
+	delete(used, "context") // always imported
+	for _, spec := range file.Imports {
+		p, _ := strconv.Unquote(spec.Path.Value)
+		pkg := path.Base(p)
+		if spec.Name != nil {
+			pkg = spec.Name.Name
+		}
+		if used[pkg] {
+			imp := spec.Path.Value
+			if spec.Name != nil {
+				imp = spec.Name.Name + " " + imp
+			}
+			i.Imports = append(i.Imports, imp)
+		}
+	}
+	sort.Strings(i.Imports)
+	return i, nil
+}
+
+func newMethod(field *ast.Field, typeString func(expr ast.Expr, qualified bool) string) (*method, error) {
+	m := &method{Name: field.Names[0].Name}
+	if field.Doc != nil {
+		for _, c := range field.Doc.List {
+			m.Doc = append(m.Doc, c.Text)
+		}
+	}
+	ft := field.Type.(*ast.FuncType)
+	n := 0
+	for _, f := range ft.Params.List {
+		names := f.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{ast.NewIdent(fmt.Sprintf("p%d", n))}
+		}
+		for _, id := range names {
+			n++
+			if ellipsis, ok := f.Type.(*ast.Ellipsis); ok {
+				m.Variadic = &param{Name: id.Name, Type: typeString(ellipsis.Elt, false), QType: typeString(ellipsis.Elt, true)}
+				continue
+			}
+			p := param{Name: id.Name, Type: typeString(f.Type, false), QType: typeString(f.Type, true)}
+			if n == 1 && p.Type == "context.Context" {
+				m.Ctx = p.Name
+				continue
+			}
+			m.Params = append(m.Params, p)
+		}
+	}
+
+	type result struct {
+		typ, qtyp   string
+		elem, qelem string // element type of slices, except []byte
+	}
+	var results []result
+	if ft.Results != nil {
+		for _, f := range ft.Results.List {
+			r := result{typ: typeString(f.Type, false), qtyp: typeString(f.Type, true)}
+			if arr, ok := f.Type.(*ast.ArrayType); ok && arr.Len == nil {
+				if elem := typeString(arr.Elt, false); elem != "byte" {
+					r.elem, r.qelem = elem, typeString(arr.Elt, true)
+				}
+			}
+			for i := 0; i < len(f.Names) || i == 0; i++ {
+				results = append(results, r)
+			}
+			if len(f.Names) > 0 && m.ResultName == "" {
+				m.ResultName = f.Names[0].Name
+			}
+		}
+	}
+	switch {
+	case len(results) == 0:
+		m.Kind = none
+	case len(results) == 1 && results[0].typ == "error":
+		m.Kind = errOnly
+	case len(results) == 1 && results[0].elem != "":
+		m.Kind, m.Result, m.QResult = stream, results[0].elem, results[0].qelem
+	case len(results) == 1:
+		m.Kind, m.Result, m.QResult = value, results[0].typ, results[0].qtyp
+	case len(results) == 2 && results[0].elem != "" && results[1].typ == "[]error":
+		m.Kind, m.Result, m.QResult = streamErrs, results[0].elem, results[0].qelem
+	case len(results) == 2 && results[0].elem != "" && results[1].typ == "error":
+		m.Kind, m.Result, m.QResult = streamErr, results[0].elem, results[0].qelem
+	case len(results) == 2 && results[1].typ == "error":
+		m.Kind, m.Result, m.QResult = valueErr, results[0].typ, results[0].qtyp
+	default:
+		return nil, fmt.Errorf("unsupported results, must be (T), (T, error), ([]T), ([]T, []error) or ([]T, error)")
+	}
+	return m, nil
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// rpcPath is the import path of the rpc package the client and the
+// server are built on.
+const rpcPath = "github.com/bukodi/go-playground/rpc"
+
+// rpcTarget is the package the client and the server are written to.
+type rpcTarget struct {
+	Package string
+	Src     string // qualifier of the interface's package, empty inside it
+	Lib     string // qualifier of the async package
+	RPC     string // qualifier of the rpc package
+	Imports []string
+}
+
+func newRPCTarget(it *iface, srcDir, outDir string) (*rpcTarget, error) {
+	t := &rpcTarget{Package: packageName(outDir), Lib: "async.", RPC: "rpc."}
+	imports := []string{`"context"`}
+	if t.Package != it.Package {
+		srcPath, err := importPath(srcDir)
+		if err != nil {
+			return nil, err
+		}
+		t.Src = it.Package + "."
+		imports = append(imports, `"`+srcPath+`"`)
+	}
+	if t.Package == path.Base(libPath) {
+		t.Lib = ""
+	} else if t.Src != "async." {
+		imports = append(imports, `"`+libPath+`"`)
+	}
+	if t.Package == path.Base(rpcPath) {
+		t.RPC = ""
+	} else {
+		imports = append(imports, `"`+rpcPath+`"`)
+	}
+	t.Imports = append(imports, it.Imports...)
+	return t, nil
+}
+
+// packageName is the package of the Go files in dir, or the name of
+// the directory if there are none.
+func packageName(dir string) string {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == "package" {
+				f.Close()
+				return fields[1]
+			}
+		}
+		f.Close()
+	}
+	abs, _ := filepath.Abs(dir)
+	return filepath.Base(abs)
+}
+
+// importPath finds the import path of dir from the go.mod above it.
+func importPath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for root := abs; ; root = filepath.Dir(root) {
+		data, err := ioutil.ReadFile(filepath.Join(root, "go.mod"))
+		if err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "module" {
+					rel, _ := filepath.Rel(root, abs)
+					return path.Join(strings.Trim(fields[1], `"`), filepath.ToSlash(rel)), nil
+				}
+			}
+		}
+		if filepath.Dir(root) == root {
+			return "", errors.New("no go.mod found above " + abs)
+		}
+	}
+}
+
+func exported(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// argsType names the struct carrying the arguments of a call.
+func (t *rpcTarget) argsType(it *iface, m *method) string {
+	return strings.ToLower(it.Name[:1]) + it.Name[1:] + m.Name + "Args"
+}
+
+// resultType is the type of the result of a call, struct{} if there is
+// none.
+func (m *method) resultType() string {
+	if m.Kind == none || m.Kind == errOnly {
+		return "struct{}"
+	}
+	return m.QResult
+}
+
+// qualifiedParams is asyncParams with the types qualified.
+func (m *method) qualifiedParams() string {
+	params := []string{"ctx context.Context"}
+	for _, p := range m.Params {
+		params = append(params, p.Name+" "+p.QType)
+	}
+	if m.Variadic != nil {
+		params = append(params, m.inputCh()+" <-chan "+m.Variadic.QType)
+	}
+	return strings.Join(params, ", ")
+}
+
+// qualifiedResults is asyncResults with the types qualified.
+func (m *method) qualifiedResults() string {
+	results := m.asyncResults()
+	if m.Result != "" && m.Result != m.QResult {
+		results = strings.Replace(results, "<-chan "+m.Result, "<-chan "+m.QResult, 1)
+	}
+	return results
+}
+
+// generateRPC writes a client implementing the asynchronous interface
+// with calls of the rpc package, and the registration of their
+// handlers serving them with an implementation.
+func generateRPC(it *iface, t *rpcTarget) ([]byte, error) {
+	var b bytes.Buffer
+	writeHeader(&b, "-type "+it.Name+" -rpc", t.Package, t.Imports)
+	asyncIface, q, lib := t.Src+"Async"+it.Name, t.RPC, t.Lib
+	client := strings.ToLower(it.Name[:1]) + it.Name[1:] + "Client"
+
+	for _, m := range it.Methods {
+		fmt.Fprintf(&b, "\n// %s carries the arguments of %s.%s.\ntype %[1]s struct {\n", t.argsType(it, m), it.Name, m.Name)
+		for _, p := range m.Params {
+			fmt.Fprintf(&b, "\t%s %s `json:%q`\n", exported(p.Name), p.QType, p.Name)
+		}
+		b.WriteString("}\n")
+	}
+
+	fmt.Fprintf(&b, `
+// New%[1]sClient returns an %[2]s making its calls on c, to a
+// server serving them with Register%[1]s.
+func New%[1]sClient(c *%[3]sClient) %[2]s {
+	return &%[4]s{c: c}
+}
+
+var _ %[2]s = &%[4]s{}
+
+type %[4]s struct {
+	c *%[3]sClient
+}
+`, it.Name, asyncIface, q, client)
+	for _, m := range it.Methods {
+		fmt.Fprintf(&b, "\nfunc (cl %s) %s(%s) %s {\n", client, m.Name, m.qualifiedParams(), m.qualifiedResults())
+		writeRPCCall(&b, t, it, m)
+		b.WriteString("}\n")
+	}
+
+	fmt.Fprintf(&b, `
+// Register%[1]s serves the calls of a client made by New%[1]sClient
+// with impl.
+func Register%[1]s(srv *%[2]sServer, impl %[3]s) {
+`, it.Name, q, asyncIface)
+	for i, m := range it.Methods {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		writeRPCHandler(&b, t, it, m, lib)
+	}
+	b.WriteString("}\n")
+	return formatSource(b.Bytes())
+}
+
+// args is the literal of the arguments of a call, from the parameters
+// or, with a prefix, from the fields of the arguments.
+func (t *rpcTarget) args(it *iface, m *method) string {
+	var fields []string
+	for _, p := range m.Params {
+		fields = append(fields, exported(p.Name)+": "+p.Name)
+	}
+	return t.argsType(it, m) + "{" + strings.Join(fields, ", ") + "}"
+}
+
+func writeRPCCall(b *bytes.Buffer, t *rpcTarget, it *iface, m *method) {
+	q, lib := t.RPC, t.Lib
+	name := fmt.Sprintf("%q", it.Name+"."+m.Name)
+	args := t.args(it, m)
+	if !m.Kind.isStream() {
+		var call string
+		if m.Variadic != nil {
+			call = fmt.Sprintf("%sClientStream[%s, %s, %s](ctx, cl.c, %s, %s, %s)",
+				q, t.argsType(it, m), m.Variadic.QType, m.resultType(), name, args, m.inputCh())
+		} else {
+			call = fmt.Sprintf("%sCall[%s, %s](ctx, cl.c, %s, %s)", q, t.argsType(it, m), m.resultType(), name, args)
+		}
+		fmt.Fprintf(b, "\treturn %sGo(ctx, func(ctx context.Context) (%s, error) {\n\t\treturn %s\n\t})", lib, m.resultType(), call)
+		switch m.Kind {
+		case none, value:
+			b.WriteString(".Chan()\n")
+		case errOnly:
+			b.WriteString(".Err()\n")
+		case valueErr:
+			b.WriteString(".Chans()\n")
+		}
+		return
+	}
+	var call string
+	if m.Variadic != nil {
+		call = fmt.Sprintf("%sBidi[%s, %s, %s](ctx, cl.c, %s, %s, %s)",
+			q, t.argsType(it, m), m.Variadic.QType, m.QResult, name, args, m.inputCh())
+	} else {
+		call = fmt.Sprintf("%sServerStream[%s, %s](ctx, cl.c, %s, %s)", q, t.argsType(it, m), m.QResult, name, args)
+	}
+	if m.Kind == stream {
+		fmt.Fprintf(b, "\tvalCh, _ := %s.Chans()\n\treturn valCh\n", call)
+	} else {
+		fmt.Fprintf(b, "\treturn %s.Chans()\n", call)
+	}
+}
+
+func writeRPCHandler(b *bytes.Buffer, t *rpcTarget, it *iface, m *method, lib string) {
+	q := t.RPC
+	name := fmt.Sprintf("%q", it.Name+"."+m.Name)
+	callArgs := []string{"ctx"}
+	for _, p := range m.Params {
+		callArgs = append(callArgs, "args."+exported(p.Name))
+	}
+	params := "ctx context.Context, args " + t.argsType(it, m)
+	if m.Variadic != nil {
+		callArgs = append(callArgs, m.inputCh())
+		params += ", " + m.inputCh() + " <-chan " + m.Variadic.QType
+	}
+	call := fmt.Sprintf("impl.%s(%s)", m.Name, strings.Join(callArgs, ", "))
+
+	if m.Kind.isStream() {
+		handle := "HandleServerStream"
+		if m.Variadic != nil {
+			handle = "HandleBidi"
+		}
+		fmt.Fprintf(b, "\t%s%s(srv, %s, func(%s) *%sStream[%s] {\n", q, handle, name, params, lib, m.QResult)
+		if m.Kind == stream {
+			fmt.Fprintf(b, "\t\treturn %sStreamOf(ctx, %s, nil)\n", lib, call)
+		} else {
+			fmt.Fprintf(b, "\t\tvalCh, errCh := %s\n\t\treturn %sStreamOf(ctx, valCh, errCh)\n", call, lib)
+		}
+		b.WriteString("\t})\n")
+		return
+	}
+	handle := "HandleUnary"
+	if m.Variadic != nil {
+		handle = "HandleClientStream"
+	}
+	fmt.Fprintf(b, "\t%s%s(srv, %s, func(%s) (%s, error) {\n", q, handle, name, params, m.resultType())
+	switch m.Kind {
+	case none, value:
+		fmt.Fprintf(b, "\t\treturn %sFutureOf(ctx, %s, nil).Result()\n", lib, call)
+	case errOnly:
+		fmt.Fprintf(b, "\t\treturn %sFutureOf[struct{}](ctx, nil, %s).Result()\n", lib, call)
+	case valueErr:
+		fmt.Fprintf(b, "\t\tvalCh, errCh := %s\n\t\treturn %sFutureOf(ctx, valCh, errCh).Result()\n", call, lib)
+	}
+	b.WriteString("\t})\n")
+}
@@ -0,0 +1,124 @@
+package async
+
+import (
+	"context"
+	"sync"
+)
+
+// FanOut calls fn on the pool for every input received and streams the
+// results and errors as the calls complete. At most p.Size() calls of
+// the stream are in flight at a time; the stream ends once the input
+// channel is closed and every call completed.
+func FanOut[In, Out any](p *Pool, fn Func[In, Out]) StreamFunc[In, Out] {
+	return func(ctx context.Context, inputs <-chan In) *Stream[Out] {
+		return NewStream(ctx, func(ctx context.Context, e Emitter[Out]) error {
+			inFlight := make(chan struct{}, p.Size())
+			var wg sync.WaitGroup
+			defer wg.Wait() // the emitter is only valid until produce returns
+			for {
+				in, ok, err := receive(ctx, inputs)
+				if !ok {
+					return err
+				}
+				select {
+				case inFlight <- struct{}{}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				f := submit(ctx, p, fn, in)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-inFlight }()
+					emit(e, f)
+				}()
+			}
+		})
+	}
+}
+
+// FanOutOrdered is FanOut streaming the results in input order. A slow
+// call holds back the results after it, but not the calls.
+func FanOutOrdered[In, Out any](p *Pool, fn Func[In, Out]) StreamFunc[In, Out] {
+	return func(ctx context.Context, inputs <-chan In) *Stream[Out] {
+		return NewStream(ctx, func(ctx context.Context, e Emitter[Out]) error {
+			pending := make(chan *Future[Out], p.Size())
+			fed := make(chan error, 1)
+			go func() {
+				defer close(pending)
+				for {
+					in, ok, err := receive(ctx, inputs)
+					if !ok {
+						fed <- err
+						return
+					}
+					select {
+					case pending <- submit(ctx, p, fn, in):
+					case <-ctx.Done():
+						fed <- ctx.Err()
+						return
+					}
+				}
+			}()
+			for f := range pending {
+				if err := emit(e, f); err != nil {
+					return err
+				}
+			}
+			return <-fed
+		})
+	}
+}
+
+// Merge streams the values and errors of all the streams as they
+// arrive. Stopping the merged stream stops them all.
+func Merge[T any](ctx context.Context, streams ...*Stream[T]) *Stream[T] {
+	return NewStream(ctx, func(ctx context.Context, e Emitter[T]) error {
+		var wg sync.WaitGroup
+		errs := make(chan error, len(streams))
+		for _, s := range streams {
+			wg.Add(1)
+			go func(s *Stream[T]) {
+				defer wg.Done()
+				defer s.Stop()
+				valCh, errCh := s.Chans()
+				errs <- forward(ctx, e, valCh, errCh)
+			}(s)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// receive returns the next input. It returns false once the channel
+// is closed or, with the error, once ctx is done.
+func receive[T any](ctx context.Context, inputs <-chan T) (T, bool, error) {
+	select {
+	case in, ok := <-inputs:
+		return in, ok, nil
+	case <-ctx.Done():
+		var zero T
+		return zero, false, ctx.Err()
+	}
+}
+
+func submit[In, Out any](ctx context.Context, p *Pool, fn Func[In, Out], in In) *Future[Out] {
+	return Submit(ctx, p, func(ctx context.Context) (Out, error) {
+		return fn(ctx, in)
+	})
+}
+
+// emit sends the outcome of f as a value or an error of the stream.
+func emit[T any](e Emitter[T], f *Future[T]) error {
+	val, err := f.Result()
+	if err != nil {
+		return e.Fail(err)
+	}
+	return e.Send(val)
+}
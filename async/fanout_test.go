@@ -0,0 +1,116 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowHello greets in reverse order of the languages: the first one
+// takes the longest.
+func slowHello(langs []string) Func[string, string] {
+	return func(ctx context.Context, lang string) (string, error) {
+		for i, l := range langs {
+			if l == lang {
+				time.Sleep(time.Millisecond * time.Duration(10*(len(langs)-i)))
+			}
+		}
+		return generateHello("Alice", lang)
+	}
+}
+
+func TestFanOutOrdered(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	for _, langs := range [][]string{{"hu", "en", "xx", "fr", "es"}, {}, {"yy"}} {
+		t.Run(strings.Join(langs, ","), func(t *testing.T) {
+			test := createTestCase("Alice", langs...)
+			multi := Unmap(FanOutOrdered(NewPool(3, 0), slowHello(langs)))
+			greetings, errs := multi(context.Background(), langs...)
+			test.checkResults(t, greetings, errs)
+		})
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	langs := []string{"hu", "en", "xx", "fr", "es"}
+	test := createTestCase("Alice", langs...)
+	multi := Unmap(FanOut(NewPool(len(langs), 0), slowHello(langs)))
+	start := time.Now()
+	greetings, errs := multi(context.Background(), langs...)
+	if elapsed := time.Since(start); elapsed > time.Millisecond*80 {
+		t.Errorf("calls did not run in parallel: %v", elapsed)
+	}
+	if greetings[0] != "Hola Alice" {
+		t.Errorf("got %v, want the fastest greeting first", greetings)
+	}
+	sort.Strings(greetings)
+	sort.Strings(test.greetings)
+	test.checkResults(t, greetings, errs)
+}
+
+func TestFanOutStop(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	for name, fanOut := range map[string]func(*Pool, Func[int, int]) StreamFunc[int, int]{
+		"unordered": FanOut[int, int],
+		"ordered":   FanOutOrdered[int, int],
+	} {
+		t.Run(name, func(t *testing.T) {
+			inputs := make(chan int)
+			double := func(ctx context.Context, in int) (int, error) { return in * 2, nil }
+			s := fanOut(NewPool(2, 0), double)(context.Background(), inputs)
+			inputs <- 1
+			inputs <- 2
+			s.Stop() // neither the inputs closed nor the results received
+			vals, errs := s.Collect()
+			if len(vals) > 2 || len(errs) > 1 {
+				t.Errorf("got %v, %v after Stop()", vals, errs)
+			}
+		})
+	}
+}
+
+func TestFanOutDeadline(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	hang := func(ctx context.Context, lang string) (string, error) {
+		if lang == "xx" {
+			time.Sleep(time.Millisecond * 100) // ignores ctx
+		}
+		return generateHello("Alice", lang)
+	}
+	multi := Unmap(FanOutOrdered(NewPool(2, time.Millisecond*20), hang))
+	greetings, errs := multi(context.Background(), "en", "xx", "hu")
+	if strings.Join(greetings, ",") != "Hello Alice!,Szia Alice!" {
+		t.Errorf("got %v", greetings)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], context.DeadlineExceeded) {
+		t.Errorf("got %v, want deadline exceeded", errs)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	ctx := context.Background()
+	vals, errs := Merge(ctx, NewStream(ctx, countTo(4)), NewStream(ctx, countTo(3))).Collect()
+	sort.Ints(vals)
+	if got := len(vals); got != 5 || vals[0] != 1 || vals[4] != 4 {
+		t.Errorf("got %v, want 1 1 2 2 4", vals)
+	}
+	if len(errs) != 2 {
+		t.Errorf("got %v, want two fizz errors", errs)
+	}
+
+	s := Merge(ctx, NewStream(ctx, countTo(1000)), NewStream(ctx, countTo(1000)))
+	<-s.values
+	s.Stop()
+	s.Collect()
+}
@@ -0,0 +1,184 @@
+// Package async turns blocking functions into channel based ones and
+// back, so a service interface gets both facades without hand written
+// select loops. Greeter and AsyncGreeter are built on it.
+package async
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrNoResult is the error of a Future whose channels were closed
+// without delivering an outcome.
+var ErrNoResult = errors.New("async: no result")
+
+// Future is the outcome of an asynchronous call: a value or an error,
+// available once Done is closed.
+type Future[T any] struct {
+	once sync.Once
+	done chan struct{}
+	val  T
+	err  error
+	// gone is the Done channel of the context of the call, when Chans
+	// stops waiting for a receiver.
+	gone <-chan struct{}
+}
+
+func newFuture[T any]() *Future[T] {
+	return &Future[T]{done: make(chan struct{})}
+}
+
+// Resolved returns a Future that already holds the value or error.
+func Resolved[T any](val T, err error) *Future[T] {
+	f := newFuture[T]()
+	f.resolve(val, err)
+	return f
+}
+
+// Go calls fn in a new goroutine and returns the Future of its result.
+// If ctx is done first the Future fails with ctx.Err() at once; fn is
+// expected to return soon after, but its result is dropped.
+func Go[T any](ctx context.Context, fn func(ctx context.Context) (T, error)) *Future[T] {
+	f := newFuture[T]()
+	f.gone = ctx.Done()
+	go func() {
+		f.resolve(fn(ctx))
+	}()
+	f.watch(ctx)
+	return f
+}
+
+// watch fails f with ctx.Err() if ctx is done before f is resolved.
+func (f *Future[T]) watch(ctx context.Context) {
+	if ctx.Done() == nil {
+		return
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			var zero T
+			f.resolve(zero, ctx.Err())
+		case <-f.done:
+		}
+	}()
+}
+
+// resolve sets the outcome, unless it was already set.
+func (f *Future[T]) resolve(val T, err error) {
+	f.once.Do(func() {
+		f.val, f.err = val, err
+		close(f.done)
+	})
+}
+
+// Done is closed once the outcome is available.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result waits for the outcome.
+func (f *Future[T]) Result() (T, error) {
+	<-f.done
+	return f.val, f.err
+}
+
+// Await waits for the outcome or for ctx to be done, whichever comes
+// first.
+func (f *Future[T]) Await(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.val, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Chan returns a channel that receives the value and is then closed.
+// On failure it is closed without a value.
+func (f *Future[T]) Chan() <-chan T {
+	ch := make(chan T, 1)
+	go func() {
+		defer close(ch)
+		if val, err := f.Result(); err == nil {
+			ch <- val
+		}
+	}()
+	return ch
+}
+
+// Err returns a channel that receives the error, nil on success, and
+// is then closed.
+func (f *Future[T]) Err() <-chan error {
+	ch := make(chan error, 1)
+	go func() {
+		defer close(ch)
+		_, err := f.Result()
+		ch <- err
+	}()
+	return ch
+}
+
+// Chans returns a value and an error channel, like the hand written
+// wrappers: the outcome is sent on one of them, then both are closed,
+// so a select over both receives the outcome and ranging over either
+// ends. The send waits for a receiver until the context of the call is
+// done; the channels of a Resolved Future must be received from.
+func (f *Future[T]) Chans() (<-chan T, <-chan error) {
+	valCh := make(chan T)
+	errCh := make(chan error)
+	go func() {
+		defer close(valCh)
+		defer close(errCh)
+		if val, err := f.Result(); err != nil {
+			send(errCh, err, f.gone)
+		} else {
+			send(valCh, val, f.gone)
+		}
+	}()
+	return valCh, errCh
+}
+
+// send sends v on ch, unless gone is closed before a receiver comes.
+// A receiver already waiting gets v even if gone is closed, like the
+// context error of a cancelled call.
+func send[T any](ch chan<- T, v T, gone <-chan struct{}) {
+	select {
+	case ch <- v:
+		return
+	default:
+	}
+	select {
+	case ch <- v:
+	case <-gone:
+	}
+}
+
+// FutureOf returns the Future of a call reporting its outcome on a
+// value and an error channel, the form returned by Chans. A value
+// channel closed without a value, as Chan does on failure, waits for
+// the error channel; a nil error, as sent by Err on success, completes
+// the Future with the zero value.
+func FutureOf[T any](ctx context.Context, valCh <-chan T, errCh <-chan error) *Future[T] {
+	return Go(ctx, func(ctx context.Context) (T, error) {
+		var zero T
+		for valCh != nil || errCh != nil {
+			select {
+			case val, ok := <-valCh:
+				if ok {
+					return val, nil
+				}
+				valCh = nil
+			case err, ok := <-errCh:
+				if ok {
+					return zero, err
+				}
+				errCh = nil
+			case <-ctx.Done():
+				return zero, ctx.Err()
+			}
+		}
+		return zero, ErrNoResult
+	})
+}
@@ -0,0 +1,127 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestFutureResult(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	f := Go(context.Background(), func(ctx context.Context) (string, error) {
+		return generateHello("Alice", "hu")
+	})
+	msg, err := f.Result()
+	if err != nil || msg != "Szia Alice!" {
+		t.Errorf("Result() = %q, %v", msg, err)
+	}
+	if msg, err := f.Result(); err != nil || msg != "Szia Alice!" {
+		t.Errorf("second Result() = %q, %v", msg, err)
+	}
+}
+
+func TestFutureCancel(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	start := time.Now()
+	f := Go(ctx, func(ctx context.Context) (string, error) {
+		time.Sleep(time.Millisecond * 100) // ignores ctx, like a sync call
+		return "late", nil
+	})
+	_, err := f.Result()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Result() error = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*80 {
+		t.Errorf("Result() waited for the call: %v", elapsed)
+	}
+}
+
+func TestFutureAwait(t *testing.T) {
+	f := newFuture[int]()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.Await(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Await() error = %v, want canceled", err)
+	}
+	f.resolve(1, nil)
+	f.resolve(2, errors.New("ignored"))
+	if val, err := f.Await(context.Background()); val != 1 || err != nil {
+		t.Errorf("Await() = %v, %v, want the first outcome", val, err)
+	}
+}
+
+func TestFutureChans(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	failure := errors.New("failure")
+	for _, want := range []error{nil, failure} {
+		valCh, errCh := Resolved("value", want).Chans()
+		select {
+		case val := <-valCh:
+			if want != nil || val != "value" {
+				t.Errorf("received value %q, want error %v", val, want)
+			}
+		case err := <-errCh:
+			if err != want {
+				t.Errorf("received error %v, want %v", err, want)
+			}
+		}
+		// both channels are closed after the outcome
+		for err := range errCh {
+			t.Errorf("received error %v after the outcome", err)
+		}
+		for val := range valCh {
+			t.Errorf("received value %q after the outcome", val)
+		}
+	}
+
+	// the channels of a call can be abandoned once its context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	Go(ctx, func(ctx context.Context) (string, error) { return "value", nil }).Chans()
+	Go(ctx, func(ctx context.Context) (string, error) { return "", failure }).Chans()
+	cancel()
+
+	if _, ok := <-Resolved("", failure).Chan(); ok {
+		t.Errorf("Chan() delivered the value of a failed call")
+	}
+
+	valCh, errCh := Resolved("v", nil).Chans()
+	val, err := FutureOf(context.Background(), valCh, errCh).Result()
+	if val != "v" || err != nil {
+		t.Errorf("FutureOf(value) = %q, %v", val, err)
+	}
+	valCh, errCh = Resolved("", failure).Chans()
+	_, err = FutureOf(context.Background(), valCh, errCh).Result()
+	if err != failure {
+		t.Errorf("FutureOf(error) error = %v, want %v", err, failure)
+	}
+	_, err = FutureOf(context.Background(), Resolved("", failure).Chan(), nil).Result()
+	if err != ErrNoResult {
+		t.Errorf("FutureOf(closed) error = %v, want %v", err, ErrNoResult)
+	}
+}
+
+func TestFutureErr(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	failure := errors.New("failure")
+	for _, want := range []error{nil, failure} {
+		errCh := Resolved(struct{}{}, want).Err()
+		if err := <-errCh; err != want {
+			t.Errorf("Err() received %v, want %v", err, want)
+		}
+		if _, ok := <-errCh; ok {
+			t.Errorf("Err() channel not closed")
+		}
+		_, err := FutureOf[struct{}](context.Background(), nil, Resolved(struct{}{}, want).Err()).Result()
+		if err != want {
+			t.Errorf("FutureOf(Err()) error = %v, want %v", err, want)
+		}
+	}
+}
@@ -1,21 +1,41 @@
-package main
+package async
 
 import (
-	"fmt"
-	"github.com/pkg/errors"
+	"embed"
+	"io/fs"
+
+	"github.com/bukodi/go-playground/async/catalog"
 )
 
+// locales holds the translations of the greetings, one file per
+// language; adding a file adds a language.
+//
+//go:embed locales
+var locales embed.FS
+
+// Greetings is the catalogue of the greeters without one of their own.
+var Greetings = mustLoadGreetings()
+
+func mustLoadGreetings() *catalog.Catalog {
+	dir, err := fs.Sub(locales, "locales")
+	if err != nil {
+		panic(err)
+	}
+	c, err := catalog.New(dir, "en")
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
 func generateHello(name string, lang string) (greeting string, err error) {
-	switch lang {
-	case "en":
-		return fmt.Sprintf("Hello %s!", name), nil
-	case "fr":
-		return fmt.Sprintf("Bonjour %s!", name), nil
-	case "es":
-		return fmt.Sprintf("Hola %s", name), nil
-	case "hu":
-		return fmt.Sprintf("Szia %s!", name), nil
-	default:
-		return "", errors.Errorf("unsupported lang: %s", lang)
+	return greet(nil, name, lang)
+}
+
+// greet greets in lang with the catalogue c, or Greetings if c is nil.
+func greet(c *catalog.Catalog, name string, lang string) (greeting string, err error) {
+	if c == nil {
+		c = Greetings
 	}
+	return c.Format(lang, "hello", catalog.Args{Name: name})
 }
@@ -0,0 +1,96 @@
+// Code generated by asyncgen -type Greeter. DO NOT EDIT.
+
+package async
+
+import (
+	"context"
+)
+
+// AsyncGreeter is the context-aware asynchronous form of Greeter.
+type AsyncGreeter interface {
+	// This is the simples use case
+	SayHello(ctx context.Context, name string) (greetingCh <-chan string)
+
+	SayLocaleHello(ctx context.Context, name string, lang string) (greetingCh <-chan string, errCh <-chan error)
+
+	// Response is a stream
+	SayMultiLangHello(ctx context.Context, name string, langCh <-chan string) (greetingCh <-chan string, errCh <-chan error)
+}
+
+// WrapToAsyncGreeter serves an AsyncGreeter with a Greeter, running every
+// call in its own goroutine.
+func WrapToAsyncGreeter(impl Greeter) AsyncGreeter {
+	return &syncToAsyncGreeter{impl: impl}
+}
+
+var _ AsyncGreeter = &syncToAsyncGreeter{}
+
+type syncToAsyncGreeter struct {
+	impl Greeter
+}
+
+func (w syncToAsyncGreeter) SayHello(ctx context.Context, name string) (greetingCh <-chan string) {
+	return Go(ctx, func(ctx context.Context) (string, error) {
+		return w.impl.SayHello(name), nil
+	}).Chan()
+}
+
+func (w syncToAsyncGreeter) SayLocaleHello(ctx context.Context, name string, lang string) (greetingCh <-chan string, errCh <-chan error) {
+	return Go(ctx, func(ctx context.Context) (string, error) {
+		return w.impl.SayLocaleHello(name, lang)
+	}).Chans()
+}
+
+func (w syncToAsyncGreeter) SayMultiLangHello(ctx context.Context, name string, langCh <-chan string) (greetingCh <-chan string, errCh <-chan error) {
+	return NewStream(ctx, func(ctx context.Context, e Emitter[string]) error {
+		langs, err := Drain(ctx, langCh)
+		if err != nil {
+			return err
+		}
+		vals, errs := w.impl.SayMultiLangHello(name, langs...)
+		for _, err := range errs {
+			if err == nil {
+				continue
+			}
+			if err := e.Fail(err); err != nil {
+				return err
+			}
+		}
+		for _, val := range vals {
+			if err := e.Send(val); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Chans()
+}
+
+// WrapToSyncGreeter serves a Greeter with an AsyncGreeter, waiting for the
+// outcome of every call unless ctx is done first.
+func WrapToSyncGreeter(ctx context.Context, impl AsyncGreeter) Greeter {
+	return &asyncToSyncGreeter{ctx: ctx, impl: impl}
+}
+
+var _ Greeter = &asyncToSyncGreeter{}
+
+type asyncToSyncGreeter struct {
+	impl AsyncGreeter
+	ctx  context.Context
+}
+
+func (w asyncToSyncGreeter) SayHello(name string) string {
+	val, _ := FutureOf(w.ctx, w.impl.SayHello(w.ctx, name), nil).Result()
+	return val
+}
+
+func (w asyncToSyncGreeter) SayLocaleHello(name string, lang string) (string, error) {
+	valCh, errCh := w.impl.SayLocaleHello(w.ctx, name, lang)
+	return FutureOf(w.ctx, valCh, errCh).Result()
+}
+
+func (w asyncToSyncGreeter) SayMultiLangHello(name string, langs ...string) ([]string, []error) {
+	ctx, cancel := context.WithCancel(w.ctx)
+	defer cancel()
+	valCh, errCh := w.impl.SayMultiLangHello(ctx, name, FromSlice(ctx, langs))
+	return StreamOf(ctx, valCh, errCh).Collect()
+}
@@ -0,0 +1,51 @@
+package async
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/bukodi/go-playground/async/catalog"
+)
+
+func TestGreetings(t *testing.T) {
+	for lang, want := range map[string]string{
+		"en":    "Hello Alice!",
+		"fr":    "Bonjour Alice!",
+		"es":    "Hola Alice",
+		"hu":    "Szia Alice!",
+		"hu-HU": "Szia Alice!",
+		"en-US": "Hello Alice!",
+	} {
+		if got, err := generateHello("Alice", lang); got != want || err != nil {
+			t.Errorf("generateHello(%s) = %q, %v, want %q", lang, got, err, want)
+		}
+	}
+	if _, err := generateHello("Alice", "de"); err == nil || err.Error() != "unsupported lang: de" {
+		t.Errorf("generateHello(de) error = %v", err)
+	}
+}
+
+func TestGreeterCatalog(t *testing.T) {
+	c, err := catalog.New(fstest.MapFS{
+		"en.json": {Data: []byte(`{"hello": "Hi {name}!"}`)},
+		"de.yaml": {Data: []byte(`hello: "Hallo {name}!"`)},
+	}, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	asyncImpl := NewAsyncGreeter(0, 2)
+	asyncImpl.Catalog = c
+	for name, impl := range map[string]Greeter{
+		"sync":  SyncGreeterImpl{Catalog: c},
+		"async": WrapToSyncGreeter(context.Background(), asyncImpl),
+	} {
+		if got := impl.SayHello("Alice"); got != "Hi Alice!" {
+			t.Errorf("%s: SayHello() = %q", name, got)
+		}
+		greetings, errs := impl.SayMultiLangHello("Alice", "de-CH", "hu")
+		if len(greetings) != 1 || greetings[0] != "Hallo Alice!" || len(errs) != 1 || errs[0].Error() != "unsupported lang: hu" {
+			t.Errorf("%s: SayMultiLangHello() = %q, %v", name, greetings, errs)
+		}
+	}
+}
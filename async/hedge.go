@@ -0,0 +1,182 @@
+package async
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// minSamples is how many latencies a Hedge needs before it trusts
+// their percentile.
+const minSamples = 10
+
+// Hedge makes the call again when it is slower than most: once the
+// call took longer than the Percentile of the latencies seen lately, a
+// duplicate is made and whichever succeeds first wins; the others are
+// cancelled. Only idempotent calls may be hedged.
+type Hedge struct {
+	Name       string  // label of the metrics
+	Percentile float64 // of the latencies to wait for, 0.95 if not set
+	Window     int     // latencies kept, 100 if not set
+	// Delay is waited for until enough latencies were seen; no
+	// duplicates are made before if it is not set.
+	Delay time.Duration
+	Max   int // duplicates per call, 1 if not set
+
+	mu        sync.Mutex
+	latencies []time.Duration // ring of the last Window latencies
+	next      int
+	stats     HedgeStats
+}
+
+// HedgeStats counts what a Hedge did.
+type HedgeStats struct {
+	Calls     int           // calls made through the policy
+	Hedges    int           // duplicates made
+	HedgeWins int           // calls won by a duplicate
+	Threshold time.Duration // current wait before a duplicate, 0 if none is made
+}
+
+var _ Policy = &Hedge{}
+
+func (h *Hedge) Do(ctx context.Context, call func(ctx context.Context) (any, error)) (any, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // the losers
+	duplicates := h.Max
+	if duplicates < 1 {
+		duplicates = 1
+	}
+	threshold := h.threshold()
+	h.count(func(s *HedgeStats) { s.Calls++ })
+
+	type outcome struct {
+		val     any
+		err     error
+		attempt int
+	}
+	outcomes := make(chan outcome, duplicates+1) // nobody blocks on a lost race
+	start := time.Now()
+	launch := func(attempt int) {
+		go func() {
+			val, err := call(ctx)
+			outcomes <- outcome{val, err, attempt}
+		}()
+	}
+	launch(0)
+	running, launched := 1, 1
+	var timer <-chan time.Time
+	if threshold > 0 {
+		t := time.NewTimer(threshold)
+		defer t.Stop()
+		timer = t.C
+	}
+	var err error
+	for running > 0 {
+		select {
+		case o := <-outcomes:
+			running--
+			if o.err == nil {
+				if o.attempt > 0 {
+					h.count(func(s *HedgeStats) { s.HedgeWins++ })
+				}
+				h.observe(time.Since(start))
+				return o.val, nil
+			}
+			if err == nil || o.attempt == 0 {
+				err = o.err
+			}
+		case <-timer:
+			timer = nil
+			if ctx.Err() != nil {
+				continue // the running attempts are ending
+			}
+			launch(launched)
+			running++
+			launched++
+			h.count(func(s *HedgeStats) { s.Hedges++ })
+			if launched <= duplicates {
+				timer = time.After(threshold)
+			}
+		}
+	}
+	return nil, err
+}
+
+// threshold is the percentile of the latencies seen, or the Delay if
+// they are too few.
+func (h *Hedge) threshold() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < minSamples {
+		return h.Delay
+	}
+	p := h.Percentile
+	if p <= 0 || p >= 1 {
+		p = 0.95
+	}
+	sorted := append([]time.Duration(nil), h.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(p*float64(len(sorted)-1))]
+}
+
+// observe records the latency of a successful call from its start,
+// whichever attempt won. Leaving out the calls won by duplicates would
+// drop the slow ones, and the percentile would sink with every hedge.
+func (h *Hedge) observe(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	window := h.Window
+	if window < 1 {
+		window = 100
+	}
+	if len(h.latencies) < window {
+		h.latencies = append(h.latencies, latency)
+		return
+	}
+	h.latencies[h.next] = latency
+	h.next = (h.next + 1) % window
+}
+
+func (h *Hedge) count(update func(s *HedgeStats)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	update(&h.stats)
+}
+
+// Stats returns what the policy did so far.
+func (h *Hedge) Stats() HedgeStats {
+	threshold := h.threshold()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.stats
+	s.Threshold = threshold
+	return s
+}
+
+var (
+	hedgeCallsDesc = prometheus.NewDesc("async_hedge_calls_total",
+		"Number of calls made through the hedging policy.", []string{"policy"}, nil)
+	hedgeHedgesDesc = prometheus.NewDesc("async_hedge_duplicates_total",
+		"Number of duplicate calls made.", []string{"policy"}, nil)
+	hedgeWinsDesc = prometheus.NewDesc("async_hedge_wins_total",
+		"Number of calls won by a duplicate.", []string{"policy"}, nil)
+	hedgeThresholdDesc = prometheus.NewDesc("async_hedge_threshold_seconds",
+		"Current wait before a duplicate call, 0 if none is made.", []string{"policy"}, nil)
+)
+
+func (h *Hedge) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{hedgeCallsDesc, hedgeHedgesDesc, hedgeWinsDesc, hedgeThresholdDesc} {
+		ch <- d
+	}
+}
+
+func (h *Hedge) Collect(ch chan<- prometheus.Metric) {
+	s := h.Stats()
+	ch <- prometheus.MustNewConstMetric(hedgeCallsDesc, prometheus.CounterValue, float64(s.Calls), h.Name)
+	ch <- prometheus.MustNewConstMetric(hedgeHedgesDesc, prometheus.CounterValue, float64(s.Hedges), h.Name)
+	ch <- prometheus.MustNewConstMetric(hedgeWinsDesc, prometheus.CounterValue, float64(s.HedgeWins), h.Name)
+	ch <- prometheus.MustNewConstMetric(hedgeThresholdDesc, prometheus.GaugeValue, s.Threshold.Seconds(), h.Name)
+}
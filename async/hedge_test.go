@@ -0,0 +1,95 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedge(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	h := &Hedge{Percentile: 0.9}
+	for i := 1; i <= 20; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	if got := h.Stats().Threshold; got != time.Millisecond*18 {
+		t.Fatalf("threshold %v, want the 90th percentile 18ms", got)
+	}
+
+	// the first attempt hangs, the duplicate wins
+	var calls int32
+	start := time.Now()
+	val, err := Guard(context.Background(), h, func(ctx context.Context) (int, error) {
+		n := atomic.AddInt32(&calls, 1)
+		if n == 1 {
+			<-ctx.Done() // cancelled once the duplicate won
+			return 0, ctx.Err()
+		}
+		return int(n), nil
+	})
+	if val != 2 || err != nil {
+		t.Errorf("got %v, %v, want the duplicate", val, err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Millisecond*18 || elapsed > time.Millisecond*60 {
+		t.Errorf("duplicate made after %v, want 18ms", elapsed)
+	}
+	if s := h.Stats(); s.Calls != 1 || s.Hedges != 1 || s.HedgeWins != 1 {
+		t.Errorf("got %+v", s)
+	}
+}
+
+func TestHedgeNoSamples(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	h := &Hedge{}
+	busy := errors.New("busy")
+	_, err := Guard(context.Background(), h, func(ctx context.Context) (int, error) {
+		time.Sleep(time.Millisecond * 10)
+		return 0, busy
+	})
+	if err != busy || h.Stats().Hedges != 0 {
+		t.Errorf("got %v, %+v, want no duplicate without latencies", err, h.Stats())
+	}
+
+	h = &Hedge{Delay: time.Millisecond * 5, Max: 2}
+	_, err = Guard(context.Background(), h, func(ctx context.Context) (int, error) {
+		time.Sleep(time.Millisecond * 30)
+		return 0, busy
+	})
+	if err != busy || h.Stats().Hedges != 2 || h.Stats().HedgeWins != 0 {
+		t.Errorf("got %v, %+v, want two failed duplicates", err, h.Stats())
+	}
+}
+
+func TestHedgeKeepsSlowLatencies(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	h := &Hedge{Percentile: 0.9, Window: 10}
+	for i := 0; i < 10; i++ {
+		h.observe(time.Millisecond * 20)
+	}
+	// every other call is slow and won by its duplicate; those count
+	// with the latency of the call, or the threshold would sink to
+	// that of the fast ones
+	for i := 0; i < 20; i++ {
+		var calls int32
+		_, err := Guard(context.Background(), h, func(ctx context.Context) (int, error) {
+			if atomic.AddInt32(&calls, 1) == 1 && i%2 == 1 {
+				<-ctx.Done()
+				return 0, ctx.Err()
+			}
+			time.Sleep(time.Millisecond)
+			return 0, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := h.Stats(); s.HedgeWins != 10 || s.Threshold < time.Millisecond*10 {
+		t.Errorf("got %+v, want the threshold of the slow calls", s)
+	}
+}
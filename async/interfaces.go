@@ -1,6 +1,9 @@
-package main
+package async
 
-import "context"
+//go:generate go run ./cmds/asyncgen -type Greeter
+
+// AsyncGreeter, WrapToAsyncGreeter and WrapToSyncGreeter are generated
+// from Greeter into greeter_async.go.
 
 type Greeter interface {
 	// This is the simples use case
@@ -11,14 +14,3 @@ type Greeter interface {
 	// Response is a stream
 	SayMultiLangHello(name string, langs ...string) (greetings []string, errs []error)
 }
-
-type AsyncGreeter interface {
-	// This is the simplest use case
-	SayHello(ctx context.Context, name string) (greetingCh <-chan string)
-
-	// Response with optional error
-	SayLocaleHello(ctx context.Context, name string, lang string) (greetingCh <-chan string, errCh <-chan error)
-
-	// Input and output is streams
-	SayMultiLangHello(ctx context.Context, name string, langCh <-chan string) (greetingsCh <-chan string, err <-chan error)
-}
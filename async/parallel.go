@@ -0,0 +1,27 @@
+package async
+
+import (
+	"context"
+)
+
+// WrapToParallelAsyncGreeter is WrapToAsyncGreeter streaming
+// SayMultiLangHello: every language is greeted by its own SayLocaleHello
+// call on the pool as soon as it is received, and the greetings are
+// streamed in the order of the languages.
+func WrapToParallelAsyncGreeter(impl Greeter, p *Pool) AsyncGreeter {
+	return &parallelGreeter{syncToAsyncGreeter{impl: impl}, p}
+}
+
+var _ AsyncGreeter = &parallelGreeter{}
+
+type parallelGreeter struct {
+	syncToAsyncGreeter
+	pool *Pool
+}
+
+func (w parallelGreeter) SayMultiLangHello(ctx context.Context, name string, langCh <-chan string) (greetingCh <-chan string, errCh <-chan error) {
+	hello := Func[string, string](func(ctx context.Context, lang string) (string, error) {
+		return w.impl.SayLocaleHello(name, lang)
+	})
+	return FanOutOrdered(w.pool, hello)(ctx, langCh).Chans()
+}
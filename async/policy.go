@@ -0,0 +1,164 @@
+package async
+
+import (
+	"context"
+	"errors"
+)
+
+// Policy guards calls: it decides whether, how often and how many
+// times at once a call is made. Retry, Breaker and Hedge are policies;
+// Chain combines them.
+type Policy interface {
+	Do(ctx context.Context, call func(ctx context.Context) (any, error)) (any, error)
+}
+
+// Guard makes the call under the policy.
+func Guard[T any](ctx context.Context, p Policy, call func(ctx context.Context) (T, error)) (T, error) {
+	val, err := p.Do(ctx, func(ctx context.Context) (any, error) {
+		return call(ctx)
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	v, _ := val.(T) // nil if the call returned a nil interface
+	return v, nil
+}
+
+// Chain returns the policy applying the policies in order, the first
+// one outermost: Chain(breaker, retry) retries within one admission of
+// the breaker.
+func Chain(policies ...Policy) Policy {
+	return chain(policies)
+}
+
+type chain []Policy
+
+func (c chain) Do(ctx context.Context, call func(ctx context.Context) (any, error)) (any, error) {
+	if len(c) == 0 {
+		return call(ctx)
+	}
+	return c[0].Do(ctx, func(ctx context.Context) (any, error) {
+		return c[1:].Do(ctx, call)
+	})
+}
+
+type transientError struct {
+	err error
+}
+
+func (e transientError) Error() string { return e.err.Error() }
+func (e transientError) Unwrap() error { return e.err }
+
+// Transient marks err as worth retrying.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return transientError{err}
+}
+
+// IsTransient tells whether err is likely to go away on its own: it
+// was marked by Transient, it reports itself Temporary, or a deadline
+// passed, as happens with slow backends.
+func IsTransient(err error) bool {
+	var temporary interface{ Temporary() bool }
+	switch {
+	case errors.As(err, &transientError{}):
+		return true
+	case errors.As(err, &temporary):
+		return temporary.Temporary()
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// GuardGreeter makes the SayHello and SayLocaleHello calls of impl
+// under the policy. The input of SayMultiLangHello can only be
+// received once, so it is neither retried nor hedged; only the
+// Breakers of the policy guard it, failing it at once with ErrOpen
+// while open and taking its first transient error for its failure.
+func GuardGreeter(impl AsyncGreeter, p Policy) AsyncGreeter {
+	return &guardedGreeter{impl: impl, policy: p}
+}
+
+var _ AsyncGreeter = &guardedGreeter{}
+
+type guardedGreeter struct {
+	impl   AsyncGreeter
+	policy Policy
+}
+
+func (g guardedGreeter) SayHello(ctx context.Context, name string) <-chan string {
+	return Go(ctx, func(ctx context.Context) (string, error) {
+		return Guard(ctx, g.policy, func(ctx context.Context) (string, error) {
+			return FutureOf(ctx, g.impl.SayHello(ctx, name), nil).Result()
+		})
+	}).Chan()
+}
+
+func (g guardedGreeter) SayLocaleHello(ctx context.Context, name string, lang string) (<-chan string, <-chan error) {
+	return Go(ctx, func(ctx context.Context) (string, error) {
+		return Guard(ctx, g.policy, func(ctx context.Context) (string, error) {
+			valCh, errCh := g.impl.SayLocaleHello(ctx, name, lang)
+			return FutureOf(ctx, valCh, errCh).Result()
+		})
+	}).Chans()
+}
+
+func (g guardedGreeter) SayMultiLangHello(ctx context.Context, name string, langCh <-chan string) (<-chan string, <-chan error) {
+	gate := breakersOf(g.policy)
+	return NewStream(ctx, func(ctx context.Context, e Emitter[string]) error {
+		called := false
+		_, err := gate.Do(ctx, func(ctx context.Context) (any, error) {
+			called = true
+			valCh, errCh := g.impl.SayMultiLangHello(ctx, name, langCh)
+			var failure error
+			for valCh != nil || errCh != nil {
+				var err error
+				select {
+				case val, ok := <-valCh:
+					if !ok {
+						valCh = nil
+						continue
+					}
+					err = e.Send(val)
+				case fail, ok := <-errCh:
+					if !ok {
+						errCh = nil
+						continue
+					}
+					if failure == nil && IsTransient(fail) {
+						failure = fail
+					}
+					err = e.Fail(fail)
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+			return nil, failure
+		})
+		if !called {
+			return err // rejected, the errors of the call were sent
+		}
+		return nil
+	}).Chans()
+}
+
+// breakersOf returns the policy applying the Breakers of p, in their
+// order, and none of its other policies.
+func breakersOf(p Policy) chain {
+	switch p := p.(type) {
+	case *Breaker:
+		return chain{p}
+	case chain:
+		var c chain
+		for _, q := range p {
+			c = append(c, breakersOf(q)...)
+		}
+		return c
+	}
+	return nil
+}
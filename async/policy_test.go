@@ -0,0 +1,229 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyGreeter fails the first calls of SayLocaleHello with a
+// transient error, then greets after the delay.
+type flakyGreeter struct {
+	AsyncGreeterImpl
+	mu    sync.Mutex
+	fails int
+	calls int
+}
+
+func (g *flakyGreeter) SayLocaleHello(ctx context.Context, name string, lang string) (<-chan string, <-chan error) {
+	g.mu.Lock()
+	g.calls++
+	fail := g.calls <= g.fails
+	g.mu.Unlock()
+	if fail {
+		return Resolved("", Transient(errors.New("backend busy"))).Chans()
+	}
+	return g.AsyncGreeterImpl.SayLocaleHello(ctx, name, lang)
+}
+
+func TestIsTransient(t *testing.T) {
+	base := errors.New("busy")
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{base, false},
+		{Transient(base), true},
+		{fmt.Errorf("wrapped: %w", Transient(base)), true},
+		{context.DeadlineExceeded, true},
+		{context.Canceled, false},
+		{&net.DNSError{IsTemporary: true}, true},
+		{&net.DNSError{}, false},
+		{ErrOpen, false},
+	} {
+		if got := IsTransient(tc.err); got != tc.want {
+			t.Errorf("IsTransient(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+	if Transient(nil) != nil {
+		t.Errorf("Transient(nil) is not nil")
+	}
+	if !errors.Is(Transient(base), base) {
+		t.Errorf("Transient() hides the error")
+	}
+}
+
+type recordPolicy struct {
+	name  string
+	calls *[]string
+}
+
+func (p recordPolicy) Do(ctx context.Context, call func(ctx context.Context) (any, error)) (any, error) {
+	*p.calls = append(*p.calls, p.name)
+	return call(ctx)
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	p := Chain(recordPolicy{"outer", &calls}, recordPolicy{"inner", &calls})
+	val, err := Guard(context.Background(), p, func(ctx context.Context) (int, error) {
+		calls = append(calls, "call")
+		return 42, nil
+	})
+	if val != 42 || err != nil || fmt.Sprint(calls) != "[outer inner call]" {
+		t.Errorf("got %v, %v, calls %v", val, err, calls)
+	}
+	if _, err := Guard(context.Background(), Chain(), func(ctx context.Context) (int, error) {
+		return 0, ErrOpen
+	}); err != ErrOpen {
+		t.Errorf("got %v, want %v", err, ErrOpen)
+	}
+}
+
+func TestGuardGreeter(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	flaky := &flakyGreeter{fails: 2}
+	retry := &Retry{Initial: time.Millisecond}
+	g := GuardGreeter(flaky, retry)
+	valCh, errCh := g.SayLocaleHello(context.Background(), "Alice", "hu")
+	select {
+	case msg := <-valCh:
+		if msg != "Szia Alice!" {
+			t.Errorf("got %q", msg)
+		}
+	case err := <-errCh:
+		t.Errorf("got %v, want a greeting on the third attempt", err)
+	}
+	if s := retry.Stats(); s.Calls != 1 || s.Retries != 2 {
+		t.Errorf("got %+v, want two retries", s)
+	}
+
+	valCh, errCh = g.SayLocaleHello(context.Background(), "Alice", "xx")
+	select {
+	case msg := <-valCh:
+		t.Errorf("got %q, want an error", msg)
+	case err := <-errCh:
+		if err == nil || IsTransient(err) {
+			t.Errorf("got %v, want unsupported lang", err)
+		}
+	}
+	if s := retry.Stats(); s.Failures != 1 || s.Retries != 2 {
+		t.Errorf("got %+v, want a failure without retries", s)
+	}
+
+	if msg := <-g.SayHello(context.Background(), "Alice"); msg != "Hello Alice!" {
+		t.Errorf("got %q", msg)
+	}
+}
+
+// TestSlowBackend runs calls against a backend slower than the
+// timeout: the breaker opens and later calls fail at once instead of
+// waiting for the backend.
+func TestSlowBackend(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	slow := NewAsyncGreeter(time.Millisecond*200, 1)
+	breaker := &Breaker{Failures: 2, Cooldown: time.Hour}
+	retry := &Retry{Attempts: 2, Initial: time.Millisecond, Timeout: time.Millisecond * 10}
+	g := WrapToSyncGreeter(context.Background(), GuardGreeter(slow, Chain(breaker, retry)))
+	for i := 0; i < 2; i++ {
+		if _, err := g.SayLocaleHello("Alice", "en"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("call %d: got %v, want deadline exceeded", i, err)
+		}
+	}
+	start := time.Now()
+	if _, err := g.SayLocaleHello("Alice", "en"); err != ErrOpen {
+		t.Errorf("got %v, want %v", err, ErrOpen)
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*5 {
+		t.Errorf("rejected call took %v", elapsed)
+	}
+	if s := retry.Stats(); s.GaveUp != 2 || s.Retries != 2 {
+		t.Errorf("retry stats %+v", s)
+	}
+	if s := breaker.Stats(); s.State != Open || s.Rejected != 1 || s.Opened != 1 {
+		t.Errorf("breaker stats %+v", s)
+	}
+}
+
+func TestGuardNilInterface(t *testing.T) {
+	val, err := Guard(context.Background(), Chain(), func(ctx context.Context) (fmt.Stringer, error) {
+		return nil, nil
+	})
+	if val != nil || err != nil {
+		t.Errorf("got %v, %v", val, err)
+	}
+}
+
+// busyGreeter fails every SayMultiLangHello with a transient error.
+type busyGreeter struct {
+	AsyncGreeterImpl
+}
+
+func (g busyGreeter) SayMultiLangHello(ctx context.Context, name string, langCh <-chan string) (<-chan string, <-chan error) {
+	return Resolved("", Transient(errors.New("backend busy"))).Chans()
+}
+
+func TestGuardGreeterMultiLang(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	breaker := &Breaker{Failures: 1, Cooldown: time.Hour}
+	retry := &Retry{Initial: time.Millisecond}
+	g := GuardGreeter(busyGreeter{}, Chain(breaker, retry))
+	langCh := make(chan string)
+	close(langCh)
+	if _, err := collect(g.SayMultiLangHello(context.Background(), "Alice", langCh)); err == nil || !IsTransient(err) {
+		t.Errorf("got %v, want backend busy", err)
+	}
+	if _, err := collect(g.SayMultiLangHello(context.Background(), "Alice", langCh)); err != ErrOpen {
+		t.Errorf("got %v, want %v", err, ErrOpen)
+	}
+	if s := breaker.Stats(); s.State != Open || s.Rejected != 1 || s.Opened != 1 {
+		t.Errorf("breaker stats %+v", s)
+	}
+	if s := retry.Stats(); s.Calls != 0 {
+		t.Errorf("retried the stream: %+v", s)
+	}
+
+	g = GuardGreeter(NewAsyncGreeter(0, 2), &Breaker{Failures: 1, Cooldown: time.Hour})
+	langCh = make(chan string, 2)
+	langCh <- "en"
+	langCh <- "hu"
+	close(langCh)
+	msgs, err := collect(g.SayMultiLangHello(context.Background(), "Alice", langCh))
+	if err != nil || len(msgs) != 2 {
+		t.Errorf("got %q, %v", msgs, err)
+	}
+}
+
+// collect receives the stream until both of its channels are closed,
+// returning the greetings and the first error.
+func collect(valCh <-chan string, errCh <-chan error) ([]string, error) {
+	var msgs []string
+	var first error
+	for valCh != nil || errCh != nil {
+		select {
+		case msg, ok := <-valCh:
+			if !ok {
+				valCh = nil
+				continue
+			}
+			msgs = append(msgs, msg)
+		case err, ok := <-errCh:
+			if !ok {
+				errCh = nil
+				continue
+			}
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return msgs, first
+}
@@ -0,0 +1,55 @@
+package async
+
+import (
+	"context"
+	"time"
+)
+
+// Pool bounds how many calls run at a time. Every call gets its own
+// deadline, so a slow one fails alone instead of holding up the rest.
+type Pool struct {
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+// NewPool returns a Pool running at most size calls at a time, each
+// limited to timeout if it is positive.
+func NewPool(size int, timeout time.Duration) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{slots: make(chan struct{}, size), timeout: timeout}
+}
+
+// Size is the number of calls the pool runs at a time.
+func (p *Pool) Size() int {
+	return cap(p.slots)
+}
+
+// Submit waits for a free slot of the pool and calls fn in a new
+// goroutine. If ctx is done or the deadline of the call passes first,
+// the Future fails at once; the slot is only freed once fn returned,
+// so calls ignoring their context still count against the limit.
+func Submit[T any](ctx context.Context, p *Pool, fn func(ctx context.Context) (T, error)) *Future[T] {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		var zero T
+		f := Resolved(zero, ctx.Err())
+		f.gone = ctx.Done()
+		return f
+	}
+	f := newFuture[T]()
+	f.gone = ctx.Done() // not that of the deadline, cancelled once resolved
+	cancel := context.CancelFunc(func() {})
+	if p.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+	}
+	go func() {
+		defer func() { <-p.slots }()
+		defer cancel() // after resolving, or the watcher would fail the call
+		f.resolve(fn(ctx))
+	}()
+	f.watch(ctx)
+	return f
+}
@@ -0,0 +1,88 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolLimit(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	p := NewPool(2, 0)
+	var running, peak int32
+	var futures []*Future[int]
+	for i := 0; i < 6; i++ {
+		i := i
+		futures = append(futures, Submit(context.Background(), p, func(ctx context.Context) (int, error) {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				m := atomic.LoadInt32(&peak)
+				if n <= m || atomic.CompareAndSwapInt32(&peak, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond * 20)
+			return i, nil
+		}))
+	}
+	for i, f := range futures {
+		if val, err := f.Result(); val != i || err != nil {
+			t.Errorf("call %d = %v, %v", i, val, err)
+		}
+	}
+	if peak != 2 {
+		t.Errorf("%d calls ran at a time, want 2", peak)
+	}
+}
+
+func TestPoolTimeout(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	p := NewPool(1, time.Millisecond*20)
+	start := time.Now()
+	slow := Submit(context.Background(), p, func(ctx context.Context) (string, error) {
+		time.Sleep(time.Millisecond * 60) // ignores ctx, like a sync call
+		return "late", nil
+	})
+	if _, err := slow.Result(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Result() error = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*50 {
+		t.Errorf("Result() waited for the call: %v", elapsed)
+	}
+
+	// the slot is only freed once the slow call returned
+	next := Submit(context.Background(), p, func(ctx context.Context) (time.Duration, error) {
+		return time.Since(start), nil
+	})
+	if started, err := next.Result(); err != nil || started < time.Millisecond*60 {
+		t.Errorf("next call started after %v, %v", started, err)
+	}
+}
+
+func TestPoolCancelWaiting(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	p := NewPool(1, 0)
+	release := make(chan struct{})
+	busy := Submit(context.Background(), p, func(ctx context.Context) (struct{}, error) {
+		<-release
+		return struct{}{}, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	waiting := Submit(ctx, p, func(ctx context.Context) (struct{}, error) {
+		t.Errorf("call ran without a free slot")
+		return struct{}{}, nil
+	})
+	if _, err := waiting.Result(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Result() error = %v, want deadline exceeded", err)
+	}
+	close(release)
+	busy.Result()
+}
@@ -0,0 +1,128 @@
+package async
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Retry makes a call again when it failed with a transient error,
+// waiting twice as long before every retry. A caller whose context
+// ended is not retried for.
+type Retry struct {
+	Name     string        // label of the metrics
+	Attempts int           // calls in total, 3 if not set
+	Initial  time.Duration // wait before the first retry, 10ms if not set
+	Max      time.Duration // longest wait, 1s if not set
+	// Timeout limits every attempt if positive, so a slow backend
+	// fails an attempt instead of the whole call.
+	Timeout time.Duration
+	// Transient tells which errors to retry, IsTransient if not set.
+	Transient func(err error) bool
+
+	mu    sync.Mutex
+	stats RetryStats
+}
+
+// RetryStats counts what a Retry did.
+type RetryStats struct {
+	Calls    int // calls made through the policy
+	Retries  int // attempts after the first one
+	GaveUp   int // calls failing after the last attempt
+	Failures int // calls failing with an error not worth retrying
+}
+
+var _ Policy = &Retry{}
+
+func (r *Retry) Do(ctx context.Context, call func(ctx context.Context) (any, error)) (any, error) {
+	attempts, wait, longest := r.Attempts, r.Initial, r.Max
+	if attempts < 1 {
+		attempts = 3
+	}
+	if wait <= 0 {
+		wait = 10 * time.Millisecond
+	}
+	if longest <= 0 {
+		longest = time.Second
+	}
+	transient := r.Transient
+	if transient == nil {
+		transient = IsTransient
+	}
+	r.count(func(s *RetryStats) { s.Calls++ })
+	for attempt := 1; ; attempt++ {
+		val, err := r.attempt(ctx, call)
+		switch {
+		case err == nil:
+			return val, nil
+		case ctx.Err() != nil:
+			return nil, err
+		case !transient(err):
+			r.count(func(s *RetryStats) { s.Failures++ })
+			return nil, err
+		case attempt == attempts:
+			r.count(func(s *RetryStats) { s.GaveUp++ })
+			return nil, err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+		if wait *= 2; wait > longest {
+			wait = longest
+		}
+		r.count(func(s *RetryStats) { s.Retries++ })
+	}
+}
+
+func (r *Retry) attempt(ctx context.Context, call func(ctx context.Context) (any, error)) (any, error) {
+	if r.Timeout <= 0 {
+		return call(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+	return Go(ctx, call).Result()
+}
+
+func (r *Retry) count(update func(s *RetryStats)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	update(&r.stats)
+}
+
+// Stats returns what the policy did so far.
+func (r *Retry) Stats() RetryStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+var (
+	retryCallsDesc = prometheus.NewDesc("async_retry_calls_total",
+		"Number of calls made through the retry policy.", []string{"policy"}, nil)
+	retryRetriesDesc = prometheus.NewDesc("async_retry_retries_total",
+		"Number of attempts after the first one.", []string{"policy"}, nil)
+	retryGaveUpDesc = prometheus.NewDesc("async_retry_gave_up_total",
+		"Number of calls failing after the last attempt.", []string{"policy"}, nil)
+	retryFailuresDesc = prometheus.NewDesc("async_retry_failures_total",
+		"Number of calls failing with an error not worth retrying.", []string{"policy"}, nil)
+)
+
+func (r *Retry) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{retryCallsDesc, retryRetriesDesc, retryGaveUpDesc, retryFailuresDesc} {
+		ch <- d
+	}
+}
+
+func (r *Retry) Collect(ch chan<- prometheus.Metric) {
+	s := r.Stats()
+	ch <- prometheus.MustNewConstMetric(retryCallsDesc, prometheus.CounterValue, float64(s.Calls), r.Name)
+	ch <- prometheus.MustNewConstMetric(retryRetriesDesc, prometheus.CounterValue, float64(s.Retries), r.Name)
+	ch <- prometheus.MustNewConstMetric(retryGaveUpDesc, prometheus.CounterValue, float64(s.GaveUp), r.Name)
+	ch <- prometheus.MustNewConstMetric(retryFailuresDesc, prometheus.CounterValue, float64(s.Failures), r.Name)
+}
@@ -0,0 +1,81 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	var attempts []time.Time
+	r := &Retry{Attempts: 4, Initial: time.Millisecond * 10, Max: time.Millisecond * 25}
+	_, err := Guard(context.Background(), r, func(ctx context.Context) (string, error) {
+		attempts = append(attempts, time.Now())
+		return "", Transient(errors.New("busy"))
+	})
+	if err == nil || len(attempts) != 4 {
+		t.Fatalf("got %v after %d attempts, want 4", err, len(attempts))
+	}
+	for i, want := range []time.Duration{10, 20, 25} {
+		want *= time.Millisecond
+		if wait := attempts[i+1].Sub(attempts[i]); wait < want || wait > want+time.Millisecond*15 {
+			t.Errorf("wait %d = %v, want %v", i, wait, want)
+		}
+	}
+	if s := r.Stats(); s != (RetryStats{Calls: 1, Retries: 3, GaveUp: 1}) {
+		t.Errorf("got %+v", s)
+	}
+}
+
+func TestRetryCancel(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	r := &Retry{Attempts: 10, Initial: time.Second}
+	start := time.Now()
+	busy := Transient(errors.New("busy"))
+	_, err := Guard(ctx, r, func(ctx context.Context) (string, error) {
+		return "", busy
+	})
+	if err != busy || time.Since(start) > time.Millisecond*100 {
+		t.Errorf("got %v after %v, want the last error once ctx is done", err, time.Since(start))
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	r := &Retry{Initial: time.Millisecond, Timeout: time.Millisecond * 10}
+	var calls int32
+	val, err := Guard(context.Background(), r, func(ctx context.Context) (string, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			time.Sleep(time.Millisecond * 30) // ignores ctx, like a sync call
+		}
+		return "ok", nil
+	})
+	if val != "ok" || err != nil || calls != 2 {
+		t.Errorf("got %q, %v after %d calls, want the second attempt", val, err, calls)
+	}
+}
+
+func TestRetryMetrics(t *testing.T) {
+	r := &Retry{Name: "greeter", Initial: time.Millisecond}
+	Guard(context.Background(), r, func(ctx context.Context) (int, error) {
+		return 0, errors.New("permanent")
+	})
+	want := `
+# HELP async_retry_failures_total Number of calls failing with an error not worth retrying.
+# TYPE async_retry_failures_total counter
+async_retry_failures_total{policy="greeter"} 1
+`
+	if err := testutil.CollectAndCompare(r, strings.NewReader(want), "async_retry_failures_total"); err != nil {
+		t.Error(err)
+	}
+}
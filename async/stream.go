@@ -0,0 +1,186 @@
+package async
+
+import (
+	"context"
+)
+
+// Stream is a sequence of values and errors produced asynchronously.
+// Values are handed over one at a time, so a slow receiver slows the
+// producer down instead of values piling up. Both channels are closed
+// once the producer returned; a receiver that is not interested in
+// the rest calls Stop.
+type Stream[T any] struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	values chan T
+	errs   chan error
+}
+
+// Emitter is handed to the producer of a Stream to send values and
+// errors. Both fail with the context error once the stream is
+// cancelled or stopped.
+type Emitter[T any] struct {
+	s *Stream[T]
+}
+
+// Send sends a value, waiting for the receiver to take it.
+func (e Emitter[T]) Send(val T) error {
+	if err := e.s.ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case e.s.values <- val:
+		return nil
+	case <-e.s.ctx.Done():
+		return e.s.ctx.Err()
+	}
+}
+
+// Fail sends an error without ending the stream. One error is
+// buffered.
+func (e Emitter[T]) Fail(err error) error {
+	if err := e.s.ctx.Err(); err != nil {
+		return err // the buffer may be free, but nobody is listening
+	}
+	select {
+	case e.s.errs <- err:
+		return nil
+	case <-e.s.ctx.Done():
+		return e.s.ctx.Err()
+	}
+}
+
+// NewStream calls produce in a new goroutine to fill the stream. An
+// error returned by produce is sent as the last error of the stream;
+// if the stream was cancelled it is only delivered when the receiver
+// is still listening.
+func NewStream[T any](ctx context.Context, produce func(ctx context.Context, e Emitter[T]) error) *Stream[T] {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Stream[T]{
+		ctx:    ctx,
+		cancel: cancel,
+		values: make(chan T),
+		errs:   make(chan error, 1),
+	}
+	go func() {
+		defer cancel()
+		defer close(s.values)
+		defer close(s.errs)
+		err := produce(ctx, Emitter[T]{s})
+		if err == nil {
+			return
+		}
+		if ctx.Err() == nil {
+			Emitter[T]{s}.Fail(err)
+			return
+		}
+		select {
+		case s.errs <- err:
+		default:
+		}
+	}()
+	return s
+}
+
+// Stop cancels the producer. The channels are closed once it returned.
+func (s *Stream[T]) Stop() {
+	s.cancel()
+}
+
+// Chans returns the value and the error channel of the stream.
+func (s *Stream[T]) Chans() (<-chan T, <-chan error) {
+	return s.values, s.errs
+}
+
+// Collect receives the whole stream.
+func (s *Stream[T]) Collect() ([]T, []error) {
+	vals := make([]T, 0)
+	errs := make([]error, 0)
+	values, errCh := s.values, s.errs
+	for values != nil || errCh != nil {
+		select {
+		case val, ok := <-values:
+			if !ok {
+				values = nil
+				continue
+			}
+			vals = append(vals, val)
+		case err, ok := <-errCh:
+			if !ok {
+				errCh = nil
+				continue
+			}
+			errs = append(errs, err)
+		}
+	}
+	return vals, errs
+}
+
+// FromSlice returns a channel that receives the values and is then
+// closed. It stops early once ctx is done.
+func FromSlice[T any](ctx context.Context, vals []T) <-chan T {
+	ch := make(chan T)
+	go func() {
+		defer close(ch)
+		for _, val := range vals {
+			select {
+			case ch <- val:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// Drain receives from ch until it is closed or ctx is done.
+func Drain[T any](ctx context.Context, ch <-chan T) ([]T, error) {
+	vals := make([]T, 0)
+	for {
+		select {
+		case val, ok := <-ch:
+			if !ok {
+				return vals, nil
+			}
+			vals = append(vals, val)
+		case <-ctx.Done():
+			return vals, ctx.Err()
+		}
+	}
+}
+
+// StreamOf returns a Stream forwarding a value and an error channel,
+// as returned by Chans, until both are closed.
+func StreamOf[T any](ctx context.Context, valCh <-chan T, errCh <-chan error) *Stream[T] {
+	return NewStream(ctx, func(ctx context.Context, e Emitter[T]) error {
+		return forward(ctx, e, valCh, errCh)
+	})
+}
+
+// forward sends everything received from the channels to e, until
+// both are closed.
+func forward[T any](ctx context.Context, e Emitter[T], valCh <-chan T, errCh <-chan error) error {
+	for valCh != nil || errCh != nil {
+		var err error
+		select {
+		case val, ok := <-valCh:
+			if !ok {
+				valCh = nil
+				continue
+			}
+			err = e.Send(val)
+		case fail, ok := <-errCh:
+			if !ok {
+				errCh = nil
+				continue
+			}
+			err = e.Fail(fail)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
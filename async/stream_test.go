@@ -0,0 +1,111 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func countTo(n int) func(ctx context.Context, e Emitter[int]) error {
+	return func(ctx context.Context, e Emitter[int]) error {
+		for i := 1; i <= n; i++ {
+			var err error
+			if i%3 == 0 {
+				err = e.Fail(fmt.Errorf("fizz %d", i))
+			} else {
+				err = e.Send(i)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestStreamCollect(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	vals, errs := NewStream(context.Background(), countTo(7)).Collect()
+	if fmt.Sprint(vals) != "[1 2 4 5 7]" {
+		t.Errorf("values = %v", vals)
+	}
+	if errorsToString(errs, false) != "fizz 3,fizz 6" {
+		t.Errorf("errors = %v", errs)
+	}
+}
+
+func TestStreamBackPressure(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	sent := make(chan int, 10)
+	s := NewStream(context.Background(), func(ctx context.Context, e Emitter[int]) error {
+		for i := 0; i < 10; i++ {
+			if err := e.Send(i); err != nil {
+				return err
+			}
+			sent <- i
+		}
+		return nil
+	})
+	valCh, _ := s.Chans()
+	<-valCh
+	time.Sleep(time.Millisecond * 20)
+	if n := len(sent); n > 1 {
+		t.Errorf("producer ran ahead of the receiver by %d values", n)
+	}
+	s.Stop()
+}
+
+func TestStreamStop(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	s := NewStream(context.Background(), countTo(1000))
+	valCh, errCh := s.Chans()
+	<-valCh
+	s.Stop()
+	for range valCh {
+	}
+	for err := range errCh {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("unexpected error after Stop: %v", err)
+		}
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	s := NewStream(ctx, func(ctx context.Context, e Emitter[int]) error {
+		e.Send(1)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	vals, errs := s.Collect()
+	if len(vals) != 1 || len(errs) != 1 || !errors.Is(errs[0], context.DeadlineExceeded) {
+		t.Errorf("Collect() = %v, %v", vals, errs)
+	}
+}
+
+func TestStreamOf(t *testing.T) {
+	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
+
+	valCh, errCh := NewStream(context.Background(), countTo(4)).Chans()
+	vals, errs := StreamOf(context.Background(), valCh, errCh).Collect()
+	if fmt.Sprint(vals) != "[1 2 4]" || errorsToString(errs, false) != "fizz 3" {
+		t.Errorf("Collect() = %v, %v", vals, errs)
+	}
+
+	feed, stop := context.WithCancel(context.Background())
+	defer stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Drain(ctx, FromSlice(feed, []int{1, 2, 3})); !errors.Is(err, context.Canceled) {
+		t.Errorf("Drain() error = %v, want canceled", err)
+	}
+}
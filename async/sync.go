@@ -1,11 +1,15 @@
-package main
+package async
 
 import (
 	"time"
+
+	"github.com/bukodi/go-playground/async/catalog"
 )
 
 type SyncGreeterImpl struct {
 	delay time.Duration
+	// Catalog has the greetings, Greetings if not set.
+	Catalog *catalog.Catalog
 }
 
 var _ Greeter = &SyncGreeterImpl{}
@@ -17,7 +21,7 @@ func (g SyncGreeterImpl) SayHello(name string) (greeting string) {
 
 func (g SyncGreeterImpl) SayLocaleHello(name string, lang string) (greeting string, err error) {
 	time.Sleep(g.delay)
-	return generateHello(name, lang)
+	return greet(g.Catalog, name, lang)
 }
 
 func (g SyncGreeterImpl) SayMultiLangHello(name string, langs ...string) (greetings []string, errs []error) {
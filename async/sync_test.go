@@ -1,4 +1,4 @@
-package main
+package async
 
 import (
 	"context"
@@ -10,6 +10,7 @@ import (
 
 var syncImpl = SyncGreeterImpl{delay: time.Millisecond * 100}
 var wrappedAsync = WrapToSyncGreeter(context.Background(), AsyncGreeterImpl{delay: time.Millisecond * 100})
+var wrappedOrdered = WrapToSyncGreeter(context.Background(), wrappedParallel)
 
 func TestSyncSayHello(t *testing.T)         { testSyncSayHello(t, syncImpl) }
 func TestWrappedAsyncSayHello(t *testing.T) { testSyncSayHello(t, wrappedAsync) }
@@ -46,8 +47,9 @@ func testSyncSayLocaleHello(t *testing.T, impl Greeter) {
 	}
 }
 
-func TestSyncSayMultiHello(t *testing.T)         { testSyncSayMultiHello(t, syncImpl) }
-func TestWrappedAsyncSayMultiHello(t *testing.T) { testSyncSayMultiHello(t, wrappedAsync) }
+func TestSyncSayMultiHello(t *testing.T)           { testSyncSayMultiHello(t, syncImpl) }
+func TestWrappedAsyncSayMultiHello(t *testing.T)   { testSyncSayMultiHello(t, wrappedAsync) }
+func TestWrappedOrderedSayMultiHello(t *testing.T) { testSyncSayMultiHello(t, wrappedOrdered) }
 
 func testSyncSayMultiHello(t *testing.T, impl Greeter) {
 	defer checkGoroutineLeakage(t, runtime.NumGoroutine())
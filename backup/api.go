@@ -0,0 +1,190 @@
+package backup
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// API serves the status of a Monitor over HTTP and lets clients
+// control it:
+//
+//	GET  /status              status of every path, see PathStatus
+//	POST /check[?path=p...]   check the paths, or every path, now
+//	POST /pause?path=p        stop checking the path
+//	POST /resume?path=p       check the path again
+//	GET  /snapshots?path=p    archives of the path, oldest first
+//	GET  /metrics             Prometheus metrics
+type API struct {
+	monitor *Monitor
+	trigger func(paths []string)
+	mux     *http.ServeMux
+}
+
+// NewAPI creates the API of the Monitor. As a Monitor checks its paths
+// from a single goroutine, checks requested through the API are passed
+// to trigger, which should hand them over to that goroutine, e.g.
+// through the Trigger channel of a Watcher.
+func NewAPI(m *Monitor, trigger func(paths []string)) *API {
+	a := &API{monitor: m, trigger: trigger, mux: http.NewServeMux()}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGoCollector(), &monitorCollector{m})
+	a.mux.HandleFunc("/status", a.status)
+	a.mux.HandleFunc("/check", a.check)
+	a.mux.HandleFunc("/pause", a.pauseOrResume)
+	a.mux.HandleFunc("/resume", a.pauseOrResume)
+	a.mux.HandleFunc("/snapshots", a.snapshots)
+	a.mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	return a
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+// knownPath checks that the path parameter names a watched path.
+func (a *API) knownPath(w http.ResponseWriter, path string) bool {
+	for _, s := range a.monitor.Status() {
+		if s.Path == path {
+			return true
+		}
+	}
+	http.Error(w, "unknown path: "+path, http.StatusNotFound)
+	return false
+}
+
+func (a *API) status(w http.ResponseWriter, r *http.Request) {
+	if allowMethod(w, r, http.MethodGet) {
+		writeJSON(w, a.monitor.Status())
+	}
+}
+
+func (a *API) check(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	paths := r.URL.Query()["path"]
+	for _, path := range paths {
+		if !a.knownPath(w, path) {
+			return
+		}
+	}
+	a.trigger(paths)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *API) pauseOrResume(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	path := r.URL.Query().Get("path")
+	var err error
+	if r.URL.Path == "/pause" {
+		err = a.monitor.Pause(path)
+	} else {
+		err = a.monitor.Resume(path)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type snapshotJSON struct {
+	File string    `json:"file"`
+	Time time.Time `json:"time"`
+	Size int64     `json:"size"`
+}
+
+func (a *API) snapshots(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	path := r.URL.Query().Get("path")
+	if !a.knownPath(w, path) {
+		return
+	}
+	snaps, err := Snapshots(a.monitor.Destination, path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	list := make([]snapshotJSON, 0, len(snaps))
+	for _, s := range snaps {
+		list = append(list, snapshotJSON{File: s.File, Time: s.Time, Size: s.Size})
+	}
+	writeJSON(w, list)
+}
+
+var (
+	lastCheckDesc = prometheus.NewDesc("backup_last_check_timestamp_seconds",
+		"Time of the last check of the path.", []string{"path"}, nil)
+	lastArchiveDesc = prometheus.NewDesc("backup_last_archive_timestamp_seconds",
+		"Time of the last archive of the path.", []string{"path"}, nil)
+	lastSizeDesc = prometheus.NewDesc("backup_last_archive_size_bytes",
+		"Size of the last archive of the path.", []string{"path"}, nil)
+	checksDesc = prometheus.NewDesc("backup_checks_total",
+		"Checks of the path.", []string{"path"}, nil)
+	archivesDesc = prometheus.NewDesc("backup_archives_total",
+		"Archives written of the path.", []string{"path"}, nil)
+	failuresDesc = prometheus.NewDesc("backup_failures_total",
+		"Failed checks of the path.", []string{"path"}, nil)
+	failingDesc = prometheus.NewDesc("backup_failing",
+		"1 if the last check of the path failed.", []string{"path"}, nil)
+	pausedDesc = prometheus.NewDesc("backup_paused",
+		"1 if the path is paused.", []string{"path"}, nil)
+)
+
+// monitorCollector exports the PathStatus of every path as metrics.
+type monitorCollector struct {
+	m *Monitor
+}
+
+func (c *monitorCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{lastCheckDesc, lastArchiveDesc, lastSizeDesc, checksDesc, archivesDesc, failuresDesc, failingDesc, pausedDesc} {
+		ch <- d
+	}
+}
+
+func (c *monitorCollector) Collect(ch chan<- prometheus.Metric) {
+	bool01 := func(b bool) float64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	seconds := func(t time.Time) float64 {
+		if t.IsZero() {
+			return 0
+		}
+		return float64(t.UnixNano()) / 1e9
+	}
+	for _, s := range c.m.Status() {
+		ch <- prometheus.MustNewConstMetric(lastCheckDesc, prometheus.GaugeValue, seconds(s.LastCheck), s.Path)
+		ch <- prometheus.MustNewConstMetric(lastArchiveDesc, prometheus.GaugeValue, seconds(s.LastArchive), s.Path)
+		ch <- prometheus.MustNewConstMetric(lastSizeDesc, prometheus.GaugeValue, float64(s.LastSize), s.Path)
+		ch <- prometheus.MustNewConstMetric(checksDesc, prometheus.CounterValue, float64(s.Checks), s.Path)
+		ch <- prometheus.MustNewConstMetric(archivesDesc, prometheus.CounterValue, float64(s.Archives), s.Path)
+		ch <- prometheus.MustNewConstMetric(failuresDesc, prometheus.CounterValue, float64(s.Failures), s.Path)
+		ch <- prometheus.MustNewConstMetric(failingDesc, prometheus.GaugeValue, bool01(s.LastError != ""), s.Path)
+		ch <- prometheus.MustNewConstMetric(pausedDesc, prometheus.GaugeValue, bool01(s.Paused), s.Path)
+	}
+}
@@ -0,0 +1,91 @@
+package backup_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/bukodi/go-playground/backup"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPI(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "alpha")
+	m := &backup.Monitor{
+		Destination: t.TempDir(),
+		Archiver:    backup.ZIP,
+		Paths:       map[string]string{src: ""},
+	}
+	var triggered [][]string
+	srv := httptest.NewServer(backup.NewAPI(m, func(paths []string) {
+		triggered = append(triggered, paths)
+		m.Check(context.Background(), src)
+	}))
+	defer srv.Close()
+
+	call := func(method, endpoint string, status int) []byte {
+		req, err := http.NewRequest(method, srv.URL+endpoint, nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, status, resp.StatusCode, "%s %s: %s", method, endpoint, body)
+		return body
+	}
+	status := func() backup.PathStatus {
+		var statuses []backup.PathStatus
+		require.NoError(t, json.Unmarshal(call("GET", "/status", http.StatusOK), &statuses))
+		require.Len(t, statuses, 1)
+		return statuses[0]
+	}
+	query := "?path=" + url.QueryEscape(src)
+
+	require.True(t, status().LastCheck.IsZero())
+
+	call("POST", "/check"+query, http.StatusAccepted)
+	require.Equal(t, [][]string{{src}}, triggered)
+	s := status()
+	require.Equal(t, 1, s.Checks)
+	require.Equal(t, 1, s.Archives)
+	require.False(t, s.LastArchive.IsZero())
+	require.NotZero(t, s.LastSize)
+	require.Empty(t, s.LastError)
+
+	var snaps []struct {
+		File string
+		Size int64
+	}
+	require.NoError(t, json.Unmarshal(call("GET", "/snapshots"+query, http.StatusOK), &snaps))
+	require.Len(t, snaps, 1)
+	require.Equal(t, s.LastFile, snaps[0].File)
+	require.Equal(t, s.LastSize, snaps[0].Size)
+
+	// a paused path is not checked
+	call("POST", "/pause"+query, http.StatusNoContent)
+	require.True(t, status().Paused)
+	call("POST", "/check", http.StatusAccepted)
+	require.Equal(t, 1, status().Checks)
+	call("POST", "/resume"+query, http.StatusNoContent)
+	call("POST", "/check", http.StatusAccepted)
+	s = status()
+	require.False(t, s.Paused)
+	require.Equal(t, 2, s.Checks)
+	require.Equal(t, 1, s.Archives, "unchanged directory must not be archived")
+
+	metrics := string(call("GET", "/metrics", http.StatusOK))
+	require.Contains(t, metrics, `backup_checks_total{path="`+src+`"} 2`)
+	require.Contains(t, metrics, `backup_archives_total{path="`+src+`"} 1`)
+	require.Contains(t, metrics, `backup_paused{path="`+src+`"} 0`)
+
+	call("POST", "/pause?path=unknown", http.StatusNotFound)
+	call("POST", "/check?path=unknown", http.StatusNotFound)
+	call("GET", "/check", http.StatusMethodNotAllowed)
+}
@@ -2,18 +2,25 @@ package backup
 
 import (
 	"archive/zip"
+	"context"
+	"fmt"
 	"io"
 	"os"
-	"path"
 	"path/filepath"
+	"runtime"
 	"sync"
+
+	"github.com/bukodi/go-playground/errorsandlogs"
 )
 
 // Archiver represents type capable of archiving and
-// restoring files.
+// restoring files. Files are stored relative to the archived
+// directory, so Restore recreates its content in dest.
+// Archive gives up with ctx.Err() once ctx is done, leaving an
+// incomplete dest for the caller to remove.
 type Archiver interface {
 	DestFmt() string
-	Archive(src, dest string) error
+	Archive(ctx context.Context, src, dest string) error
 	Restore(src, dest string) error
 }
 
@@ -29,7 +36,7 @@ func (z *zipper) DestFmt() string {
 	return "%d.zip"
 }
 
-func (z *zipper) Archive(src, dest string) error {
+func (z *zipper) Archive(ctx context.Context, src, dest string) error {
 	if err := os.MkdirAll(filepath.Dir(dest), 0777); err != nil {
 		return err
 	}
@@ -38,12 +45,43 @@ func (z *zipper) Archive(src, dest string) error {
 		return err
 	}
 	defer out.Close()
+	if err := z.archiveTo(ctx, src, out); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func (z *zipper) archiveTo(ctx context.Context, src string, out io.Writer) error {
 	w := zip.NewWriter(out)
-	defer w.Close()
-	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+	err := walkTree(src, filterOf(ctx), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			// zip keeps the content of the file a symlink points to
+			if info, err = os.Stat(path); err != nil || info.IsDir() {
+				return err
+			}
+		}
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
 		if info.IsDir() {
-			return nil // skip
+			hdr.Name += "/"
+			_, err := w.CreateHeader(hdr)
+			return err
 		}
+		hdr.Method = zip.Deflate
+		f, err := w.CreateHeader(hdr)
 		if err != nil {
 			return err
 		}
@@ -52,70 +90,141 @@ func (z *zipper) Archive(src, dest string) error {
 			return err
 		}
 		defer in.Close()
-		f, err := w.Create(path)
-		if err != nil {
+		r := newArchivedReader(ctx, hdr.Name, in)
+		if _, err := io.Copy(f, r); err != nil {
 			return err
 		}
-		io.Copy(f, in)
+		r.archived()
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// contextReader fails with ctx.Err() once ctx is done, so archiving
+// a large file can be interrupted.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
 }
 
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// restoreWorkers limits how many files are extracted at once.
+var restoreWorkers = runtime.NumCPU()
+
+// Restore extracts the archive into dest with at most restoreWorkers
+// files written in parallel. Entries that would escape dest are
+// rejected. File modes and modification times are restored, and all
+// failures are reported together as an errorsandlogs.MultiErr.
 func (z *zipper) Restore(src, dest string) error {
 	r, err := zip.OpenReader(src)
 	if err != nil {
 		return err
 	}
 	defer r.Close()
-	var w sync.WaitGroup
-	var errs []error
-	errChan := make(chan error)
-	go func() {
-		for err := range errChan {
-			errs = append(errs, err)
-		}
-	}()
+	errs := errorsandlogs.NewMultiErr()
+	var dirs, files []*zip.File
 	for _, f := range r.File {
-		w.Add(1)
-		go func(f *zip.File) {
-			zippedfile, err := f.Open()
-			if err != nil {
-				errChan <- err
-				w.Done()
-				return
-			}
-			toFilename := path.Join(dest, f.Name)
-			err = os.MkdirAll(path.Dir(toFilename), 0777)
-			if err != nil {
-				errChan <- err
-				w.Done()
-				return
-			}
-			newFile, err := os.Create(toFilename)
-			if err != nil {
-				zippedfile.Close()
-				errChan <- err
-				w.Done()
-				return
-			}
-			_, err = io.Copy(newFile, zippedfile)
-			newFile.Close()
-			zippedfile.Close()
-			if err != nil {
-				errChan <- err
-				w.Done()
-				return
+		target, err := safeJoin(dest, f.Name)
+		if err != nil {
+			errs.Append(err)
+			continue
+		}
+		if f.FileInfo().IsDir() {
+			errs.Append(os.MkdirAll(target, 0700))
+			dirs = append(dirs, f)
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			errs.Append(fmt.Errorf("%s: unsupported file type %v", f.Name, f.Mode().Type()))
+			continue
+		}
+		errs.Append(os.MkdirAll(filepath.Dir(target), 0777))
+		files = append(files, f)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan *zip.File)
+	for i := 0; i < restoreWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				if err := restoreZipFile(f, dest); err != nil {
+					mu.Lock()
+					errs.Append(fmt.Errorf("%s: %w", f.Name, err))
+					mu.Unlock()
+				}
 			}
-			w.Done()
-		}(f)
+		}()
+	}
+	for _, f := range files {
+		jobs <- f
 	}
-	w.Wait()
-	close(errChan)
-	if len(errs) > 0 {
-		return errs[0] // return first error
+	close(jobs)
+	wg.Wait()
+
+	// directories last, as restoring their content updates their mtime
+	for i := len(dirs) - 1; i >= 0; i-- {
+		target, _ := safeJoin(dest, dirs[i].Name)
+		errs.Append(restoreZipMetadata(dirs[i], target))
 	}
-	return nil
+	return errs.Reduce()
+}
+
+func restoreZipFile(f *zip.File, dest string) error {
+	target, err := safeJoin(dest, f.Name)
+	if err != nil {
+		return err
+	}
+	in, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	os.Remove(target) // do not write through an existing link
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return restoreZipMetadata(f, target)
+}
+
+func restoreZipMetadata(f *zip.File, target string) error {
+	if err := os.Chmod(target, f.Mode().Perm()); err != nil {
+		return err
+	}
+	mtime := f.Modified
+	if mtime.IsZero() {
+		mtime = f.ModTime()
+	}
+	return os.Chtimes(target, mtime, mtime)
 }
 
 // Zip is an Archiver that zips and unzips files.
 var ZIP Archiver = (*zipper)(nil)
+
+// Archivers lists the available Archiver implementations by the
+// name used to select them on the command line.
+var Archivers = map[string]Archiver{
+	"zip":     ZIP,
+	"dedup":   DEDUP,
+	"targz":   TarGz,
+	"tarzstd": TarZstd,
+}
@@ -1,10 +1,17 @@
 package backup_test
 
 import (
+	"archive/zip"
+	"context"
+	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
-	"github.com/bukodi/go-playgroud/backup"
+	"github.com/bukodi/go-playground/backup"
+	"github.com/bukodi/go-playground/errorsandlogs"
 	"github.com/stretchr/testify/require"
 )
 
@@ -19,7 +26,7 @@ func TestZipArchive(t *testing.T) {
 	setup(t)
 	defer teardown(t)
 
-	err := backup.ZIP.Archive("test/hash1", "test/output/1.zip")
+	err := backup.ZIP.Archive(context.Background(), "test/hash1", "test/output/1.zip")
 	require.NoError(t, err)
 
 	// unzip
@@ -28,6 +35,72 @@ func TestZipArchive(t *testing.T) {
 
 }
 
+func TestZipRestoresMetadata(t *testing.T) {
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "sub", "run.sh"), "#!/bin/sh")
+	require.NoError(t, os.Chmod(filepath.Join(src, "sub", "run.sh"), 0750))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(src, "sub", "run.sh"), mtime, mtime))
+	require.NoError(t, os.Chtimes(filepath.Join(src, "sub"), mtime, mtime))
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "empty"), 0777))
+
+	archive := filepath.Join(t.TempDir(), "1.zip")
+	require.NoError(t, backup.ZIP.Archive(context.Background(), src, archive))
+	dest := t.TempDir()
+	require.NoError(t, backup.ZIP.Restore(archive, dest))
+
+	info, err := os.Stat(filepath.Join(dest, "sub", "run.sh"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0750), info.Mode().Perm())
+	require.True(t, mtime.Equal(info.ModTime()))
+	info, err = os.Stat(filepath.Join(dest, "sub"))
+	require.NoError(t, err)
+	require.True(t, mtime.Equal(info.ModTime()))
+	info, err = os.Stat(filepath.Join(dest, "empty"))
+	require.NoError(t, err)
+	require.True(t, info.IsDir())
+}
+
+func TestZipRestoreRejectsEscapes(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "slip.zip")
+	f, err := os.Create(archive)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	for _, name := range []string{"good.txt", "../evil.txt", "sub/../../evil2.txt"} {
+		fw, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(name))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	dest := filepath.Join(dir, "out")
+	err = backup.ZIP.Restore(archive, dest)
+	require.Error(t, err)
+	var merr *errorsandlogs.MultiErr
+	require.True(t, errors.As(err, &merr))
+	require.Len(t, merr.Errors(), 2, "every escaping entry is reported")
+
+	_, err = os.Stat(filepath.Join(dest, "good.txt"))
+	require.NoError(t, err, "valid entries are still restored")
+	_, err = os.Stat(filepath.Join(dir, "evil.txt"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "evil2.txt"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestArchiveCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for name, a := range backup.Archivers {
+		dest := filepath.Join(t.TempDir(), "1"+filepath.Ext(a.DestFmt()))
+		err := a.Archive(ctx, "test/hash1", dest)
+		require.True(t, errors.Is(err, context.Canceled), "%s: %v", name, err)
+	}
+}
+
 type call struct {
 	Src  string
 	Dest string
@@ -44,9 +117,12 @@ func (a *TestArchiver) DestFmt() string {
 	return "%d.zip"
 }
 
-func (a *TestArchiver) Archive(src, dest string) error {
+func (a *TestArchiver) Archive(ctx context.Context, src, dest string) error {
 	a.Archives = append(a.Archives, &call{Src: src, Dest: dest})
-	return nil
+	if err := os.MkdirAll(filepath.Dir(dest), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dest, nil, 0666)
 }
 func (a *TestArchiver) Restore(src, dest string) error {
 	a.Restores = append(a.Restores, &call{Src: src, Dest: dest})
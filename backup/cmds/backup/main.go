@@ -1,13 +1,20 @@
 package main
 
 import (
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/bukodi/go-playground/backup"
+	"github.com/bukodi/go-playground/backup/registry"
 	"github.com/matryer/filedb"
 )
 
@@ -16,19 +23,72 @@ import (
 
   usage:
 
-    backup -db=./backupdata.db add {path} [{path} {path}...]
-    backup -db=./backupdata.db remove {path} [{path} {path}...]
-    backup -db=./backupdata.db list
+    backup -db=./backup.db add [--exclude {pattern}...] [--include {pattern}...] {path} [{path} {path}...]
+    backup -db=./backup.db remove {path} [{path} {path}...]
+    backup -db=./backup.db list
+    backup -db=./backup.db import {filedb directory}
+    backup -archive=./archive snapshots {path}
+    backup -archive=./archive restore {path} [--at {time}] --to {dir}
+    backup -storage={url} snapshots {path}
+    backup -storage={url} restore {path} [--at {time}] --to {dir}
+    backup diff {snapshotA} {snapshotB}
+    backup -db=./backup.db -archive=./archive verify [--trust {ca.pem}] [--quick] [{path}...]
+    backup -db=./backup.db -archive=./archive prune --retention {policy} [--dry-run] [{path}...]
+
+  The --at time is RFC 3339, "2006-01-02 15:04:05", "2006-01-02" or
+  the Unix nano timestamp shown by snapshots; it defaults to now.
+  The prune policy uses the backupd -retention syntax, e.g.
+  last=10,daily=7,weekly=4,monthly=12,size=10G; without paths it
+  prunes every registered path.
+  The add patterns match file and directory names, or paths relative
+  to the added path if they contain a slash; with --include only the
+  matching files are archived. Patterns can also be listed in
+  .backupignore files inside the watched directories. Adding a
+  registered path again with patterns replaces its rules.
+  A running backupd picks up added and removed paths within seconds.
+  Import copies the paths of the filedb database used by earlier
+  versions into the registry.
+  Encrypted archives are restored and compared with -passphrase-file
+  or with -cert and -key.
+  With -storage, snapshots are listed and restored from the storage
+  backupd uploads to: a directory, sftp://user@host/dir,
+  s3://bucket/prefix?endpoint=host:port or an http(s):// URL.
+  Verify checks every archive of the paths, or of every registered
+  path, against the manifest written next to it. With --trust the
+  manifests must be signed by a certificate chaining to one in the
+  PEM file; --quick only checks the archive digests and skips the
+  trial restore.
 
 */
 
-type path struct {
-	Path string
-	Hash string
-}
+type path registry.Path
 
 func (p path) String() string {
-	return fmt.Sprintf("%s [%s]", p.Path, p.Hash)
+	return fmt.Sprintf("%s [%s]%s", p.Path, p.Hash, ruleString(p.Filter))
+}
+
+// ruleString formats the rules of a path as listed.
+func ruleString(f backup.Filter) string {
+	var s string
+	if len(f.Include) > 0 {
+		s += fmt.Sprintf(" include=%s", strings.Join(f.Include, ","))
+	}
+	if len(f.Exclude) > 0 {
+		s += fmt.Sprintf(" exclude=%s", strings.Join(f.Exclude, ","))
+	}
+	return s
+}
+
+// patterns collects the values of a repeated flag.
+type patterns []string
+
+func (p *patterns) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patterns) Set(value string) error {
+	*p = append(*p, value)
+	return nil
 }
 
 func main() {
@@ -40,65 +100,341 @@ func main() {
 		}
 	}()
 	var (
-		dbpath = flag.String("db", "./backupdata", "path to database directory")
+		dbpath   = flag.String("db", "./backup.db", "path to the path registry database")
+		archive  = flag.String("archive", "archive", "path to archive location")
+		pswFile  = flag.String("passphrase-file", "", "passphrase file of encrypted archives")
+		certFile = flag.String("cert", "", "PEM certificate encrypted archives are encrypted for")
+		keyFile  = flag.String("key", "", "PEM private key of the -cert certificate")
+		storeURL = flag.String("storage", "", "list and restore snapshots from this storage instead of -archive")
 	)
 	flag.Parse()
+	keys, err := backup.LoadKeyWrapper(*pswFile, *certFile, *keyFile)
+	if err != nil {
+		fatalErr = err
+		return
+	}
+	if keys != nil {
+		backup.RegisterEncrypted(keys)
+	}
+	var storage backup.Storage
+	if *storeURL != "" {
+		if storage, err = backup.OpenStorage(*storeURL); err != nil {
+			fatalErr = err
+			return
+		}
+	}
 	args := flag.Args()
 	if len(args) < 1 {
 		fatalErr = errors.New("invalid usage; must specify command")
 		return
 	}
-	db, err := filedb.Dial(*dbpath)
-	if err != nil {
-		fatalErr = err
+	switch strings.ToLower(args[0]) {
+	case "snapshots":
+		fatalErr = snapshots(*archive, storage, args[1:])
+		return
+	case "restore":
+		fatalErr = restore(*archive, storage, args[1:])
+		return
+	case "diff":
+		fatalErr = diff(args[1:])
 		return
 	}
-	defer db.Close()
-	col, err := db.C("paths")
+	reg, err := registry.Open(*dbpath)
 	if err != nil {
 		fatalErr = err
 		return
 	}
+	defer reg.Close()
 	switch strings.ToLower(args[0]) {
+	case "prune":
+		fatalErr = prune(*archive, reg, args[1:])
+	case "import":
+		fatalErr = importFileDB(reg, args[1:])
+	case "verify":
+		fatalErr = verify(*archive, reg, args[1:])
 	case "list":
-		var path path
-		col.ForEach(func(i int, data []byte) bool {
-			err := json.Unmarshal(data, &path)
-			if err != nil {
-				fatalErr = err
-				return false
-			}
-			fmt.Printf("= %s\n", path)
-			return false
-		})
+		paths, err := reg.Paths()
+		if err != nil {
+			fatalErr = err
+			return
+		}
+		for _, p := range paths {
+			fmt.Printf("= %s\n", path(p))
+		}
 	case "add":
-		if len(args[1:]) == 0 {
+		fs := flag.NewFlagSet("add", flag.ContinueOnError)
+		var filter backup.Filter
+		fs.Var((*patterns)(&filter.Exclude), "exclude", "pattern of files and directories to leave out (repeatable)")
+		fs.Var((*patterns)(&filter.Include), "include", "pattern of the only files to archive (repeatable)")
+		if fatalErr = fs.Parse(args[1:]); fatalErr != nil {
+			return
+		}
+		if fs.NArg() == 0 {
 			fatalErr = errors.New("must specify path to add")
 			return
 		}
-		for _, p := range args[1:] {
-			path := &path{Path: p, Hash: "Not yet archived"}
-			if err := col.InsertJSON(path); err != nil {
+		for _, p := range fs.Args() {
+			path := path{Path: p, Hash: "Not yet archived", Filter: filter}
+			err := reg.Add(registry.Path(path))
+			if errors.Is(err, registry.ErrExists) && fs.NFlag() > 0 {
+				if _, err = reg.SetFilter(p, filter); err == nil {
+					fmt.Printf("~ %s %s\n", p, ruleString(filter))
+					continue
+				}
+			}
+			if err != nil {
 				fatalErr = err
 				return
 			}
 			fmt.Printf("+ %s\n", path)
 		}
 	case "remove":
-		var path path
-		col.RemoveEach(func(i int, data []byte) (bool, bool) {
-			err := json.Unmarshal(data, &path)
+		for _, p := range args[1:] {
+			removed, err := reg.Remove(p)
 			if err != nil {
 				fatalErr = err
-				return false, true
+				return
 			}
-			for _, p := range args[1:] {
-				if path.Path == p {
-					fmt.Printf("- %s\n", path)
-					return true, false
+			if removed {
+				fmt.Printf("- %s\n", p)
+			}
+		}
+	default:
+		fatalErr = fmt.Errorf("unknown command: %s", args[0])
+	}
+}
+
+// importFileDB copies the paths of a filedb database, as written by
+// earlier versions, into the registry.
+func importFileDB(reg *registry.Registry, args []string) error {
+	if len(args) != 1 {
+		return errors.New("must specify filedb directory to import")
+	}
+	db, err := filedb.Dial(args[0])
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	col, err := db.C("paths")
+	if err != nil {
+		return err
+	}
+	var paths []path
+	col.ForEach(func(_ int, data []byte) bool {
+		var p path
+		if err = json.Unmarshal(data, &p); err != nil {
+			return true
+		}
+		paths = append(paths, p)
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		err := reg.Add(registry.Path(p))
+		if errors.Is(err, registry.ErrExists) {
+			fmt.Printf("= %s (already registered)\n", p)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("+ %s\n", p)
+	}
+	return nil
+}
+
+// listSnapshots lists the snapshots of path in the storage, if set,
+// or in the local archive.
+func listSnapshots(archive string, storage backup.Storage, path string) ([]backup.SnapshotInfo, error) {
+	if storage != nil {
+		return backup.StoredSnapshots(storage, path)
+	}
+	return backup.Snapshots(archive, path)
+}
+
+func snapshots(archive string, storage backup.Storage, args []string) error {
+	if len(args) != 1 {
+		return errors.New("must specify path to list snapshots of")
+	}
+	snaps, err := listSnapshots(archive, storage, args[0])
+	if err != nil {
+		return err
+	}
+	for _, snap := range snaps {
+		fmt.Printf("%d  %s  %10d  %s\n", snap.Time.UnixNano(), snap.Time.Format(time.RFC3339), snap.Size, snap.File)
+	}
+	return nil
+}
+
+func restore(archive string, storage backup.Storage, args []string) error {
+	if len(args) < 1 {
+		return errors.New("must specify path to restore")
+	}
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	at := fs.String("at", "", "restore the directory as it was at this time")
+	to := fs.String("to", "", "directory to restore into")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *to == "" {
+		return errors.New("must specify --to directory")
+	}
+	t := time.Now()
+	if *at != "" {
+		var err error
+		if t, err = parseTime(*at); err != nil {
+			return err
+		}
+	}
+	snaps, err := listSnapshots(archive, storage, args[0])
+	if err != nil {
+		return err
+	}
+	snap, ok := backup.SnapshotAt(snaps, t)
+	if !ok {
+		return fmt.Errorf("no snapshot of %s at %s", args[0], t.Format(time.RFC3339))
+	}
+	file := snap.File
+	if storage != nil {
+		tmp, err := ioutil.TempDir("", "backup-restore")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp)
+		if file, err = backup.Fetch(storage, snap.File, tmp); err != nil {
+			return err
+		}
+	}
+	if err := backup.RestoreSnapshot(file, *to); err != nil {
+		return err
+	}
+	fmt.Printf("restored %s from %s into %s\n", args[0], snap.Time.Format(time.RFC3339), *to)
+	return nil
+}
+
+func diff(args []string) error {
+	if len(args) != 2 {
+		return errors.New("must specify two snapshots to compare")
+	}
+	changes, err := backup.Diff(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+	return nil
+}
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func parseTime(s string) (time.Time, error) {
+	if nano, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(0, nano), nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s", s)
+}
+
+func prune(archive string, reg *registry.Registry, args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	var retention backup.Retention
+	fs.Var(&retention, "retention", "snapshots to keep per path")
+	dryRun := fs.Bool("dry-run", false, "only show what would be deleted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if retention.IsZero() {
+		return errors.New("must specify --retention policy")
+	}
+	paths := fs.Args()
+	if len(paths) == 0 {
+		registered, err := reg.Paths()
+		if err != nil {
+			return err
+		}
+		for _, p := range registered {
+			paths = append(paths, p.Path)
+		}
+	}
+	for _, p := range paths {
+		pruned, err := backup.Prune(archive, p, retention, *dryRun)
+		if err != nil {
+			return err
+		}
+		for _, snap := range pruned {
+			if *dryRun {
+				fmt.Printf("would delete %s\n", snap.File)
+			} else {
+				fmt.Printf("deleted %s\n", snap.File)
+			}
+		}
+	}
+	return nil
+}
+
+func verify(archive string, reg *registry.Registry, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	trust := fs.String("trust", "", "PEM file of the certificates manifests must be signed under")
+	quick := fs.Bool("quick", false, "only check the archive digests")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var roots *x509.CertPool
+	if *trust != "" {
+		data, err := ioutil.ReadFile(*trust)
+		if err != nil {
+			return err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates in %s", *trust)
+		}
+	}
+	paths := fs.Args()
+	if len(paths) == 0 {
+		registered, err := reg.Paths()
+		if err != nil {
+			return err
+		}
+		for _, p := range registered {
+			paths = append(paths, p.Path)
+		}
+	}
+	failed := 0
+	for _, p := range paths {
+		results, err := backup.VerifyPath(archive, p, roots, *quick)
+		if err != nil {
+			return err
+		}
+		for _, v := range results {
+			if !v.OK() {
+				failed++
+				for _, problem := range v.Problems {
+					fmt.Printf("FAIL %s: %s\n", v.File, problem)
 				}
+				continue
 			}
-			return false, false
-		})
+			if v.Signer != nil {
+				fmt.Printf("ok   %s (signed by %s)\n", v.File, v.Signer.Subject)
+			} else {
+				fmt.Printf("ok   %s\n", v.File)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d archives failed verification", failed)
 	}
+	return nil
 }
@@ -1,25 +1,22 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/matryer/filedb"
-	"github.com/bukodi/go-playgroud/backup"
+	"github.com/bukodi/go-playground/backup"
+	"github.com/bukodi/go-playground/backup/registry"
+	"github.com/bukodi/go-playground/errorsandlogs"
 )
 
-type path struct {
-	Path string
-	Hash string
-}
-
 func main() {
 	var fatalErr error
 	defer func() {
@@ -28,84 +25,265 @@ func main() {
 		}
 	}()
 	var (
-		interval = flag.Int("interval", 10, "interval between checks (seconds)")
+		interval = flag.Int("interval", 10, "interval between checks, or between full rescans with -watch (seconds)")
+		watch    = flag.Bool("watch", false, "check paths on filesystem events instead of polling")
+		pswFile  = flag.String("passphrase-file", "", "encrypt archives with the passphrase in this file")
+		certFile = flag.String("cert", "", "encrypt archives for the holder of this PEM certificate")
+		debounce = flag.Duration("debounce", 2*time.Second, "with -watch, time a path must be quiet before it is checked")
 		archive  = flag.String("archive", "archive", "path to archive location")
-		dbpath   = flag.String("db", "./db", "path to filedb database")
+		storage  = flag.String("storage", "", "also upload archives to this directory, sftp://, s3:// or http(s):// URL")
+		dbpath   = flag.String("db", "./backup.db", "path to the path registry database")
+		reload   = flag.Duration("reload", 5*time.Second, "interval between checks for paths added or removed with the backup tool")
+		format   = flag.String("format", "zip", "archive format (zip, dedup, targz or tarzstd); dedup archives can not be encrypted")
+		httpAddr = flag.String("http", "", "serve the status and control API on this address, e.g. localhost:8080")
+		hashMode = flag.String("hash", "meta", "change detection: meta (names, sizes and mtimes) or content (SHA-256 of file contents)")
+		signCert = flag.String("sign-cert", "", "sign the manifests of the archives with this PEM certificate")
+		signKey  = flag.String("sign-key", "", "PEM private key of the -sign-cert certificate")
 	)
+	var retention backup.Retention
+	flag.Var(&retention, "retention", "snapshots to keep per path, e.g. last=10,daily=7,weekly=4,monthly=12,size=10G")
 	flag.Parse()
-	m := &backup.Monitor{
-		Destination: *archive,
-		Archiver:    backup.ZIP,
-		Paths:       make(map[string]string),
-	}
-	db, err := filedb.Dial(*dbpath)
+	keys, err := backup.LoadKeyWrapper(*pswFile, *certFile, "")
 	if err != nil {
 		fatalErr = err
 		return
 	}
-	defer db.Close()
-	col, err := db.C("paths")
-	if err != nil {
+	if keys != nil {
+		if backup.Archivers[*format] == backup.DEDUP {
+			fatalErr = errors.New("dedup archives can not be encrypted, use another -format with -passphrase-file or -cert")
+			return
+		}
+		backup.RegisterEncrypted(keys)
+		*format += "+enc"
+	}
+	archiver, ok := backup.Archivers[*format]
+	if !ok {
+		fatalErr = fmt.Errorf("unknown archive format: %s", *format)
+		return
+	}
+	m := &backup.Monitor{
+		Destination: *archive,
+		Archiver:    archiver,
+	}
+	if m.Signer, err = backup.LoadManifestSigner(*signCert, *signKey); err != nil {
 		fatalErr = err
 		return
 	}
-	var path path
-	col.ForEach(func(_ int, data []byte) bool {
-		if err := json.Unmarshal(data, &path); err != nil {
+	if *storage != "" {
+		if m.Storage, err = backup.OpenStorage(*storage); err != nil {
 			fatalErr = err
-			return true
+			return
 		}
-		m.Paths[path.Path] = path.Hash
-		return false // carry on
-	})
-	if fatalErr != nil {
+	}
+	switch *hashMode {
+	case "meta":
+	case "content":
+		m.Hasher = backup.NewContentHasher()
+	default:
+		fatalErr = fmt.Errorf("unknown hash mode: %s", *hashMode)
 		return
 	}
-	if len(m.Paths) < 1 {
-		fatalErr = errors.New("no paths - use backup tool to add at least one")
+	reg, err := registry.Open(*dbpath)
+	if err != nil {
+		fatalErr = err
 		return
 	}
-	check(m, col)
+	defer reg.Close()
+	if _, err := loadPaths(reg, m); err != nil {
+		fatalErr = err
+		return
+	}
+	if len(m.PathList()) < 1 {
+		log.Println("No paths yet - use backup tool to add some")
+	}
+	trigger := make(chan []string, 1)
+	go reloadPaths(reg, m, trigger, *reload)
+	if *httpAddr != "" {
+		api := backup.NewAPI(m, func(paths []string) {
+			go func() { trigger <- paths }()
+		})
+		srv := &http.Server{Addr: *httpAddr, Handler: api}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Println("failed to serve API:", err)
+			}
+		}()
+		defer srv.Close()
+	}
+	// the first signal abandons the archive being written and stops,
+	// a second one exits at once
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signalChan
+		fmt.Println()
+		log.Printf("Stopping...")
+		cancel()
+		<-signalChan
+		log.Fatalln("Stopped without cleaning up")
+	}()
+	check(ctx, m, reg, retention)
+	if *watch {
+		w := &backup.Watcher{
+			Monitor:  m,
+			Debounce: *debounce,
+			Rescan:   time.Duration(*interval) * time.Second,
+			Trigger:  trigger,
+			OnCheck: func(counter int, err error) {
+				report(m, reg, retention, counter, err)
+			},
+		}
+		fatalErr = w.Run(ctx)
+		return
+	}
 	for {
 		select {
 		case <-time.After(time.Duration(*interval) * time.Second):
-			check(m, col)
-		case <-signalChan:
-			// stop
-			fmt.Println()
-			log.Printf("Stopping...")
-			goto stop
+			check(ctx, m, reg, retention)
+		case paths := <-trigger:
+			check(ctx, m, reg, retention, paths...)
+		case <-ctx.Done():
+			return
 		}
 	}
-stop:
 }
 
-func check(m *backup.Monitor, col *filedb.C) {
+// check checks the paths, or every path if none are given.
+func check(ctx context.Context, m *backup.Monitor, reg *registry.Registry, retention backup.Retention, paths ...string) {
 	log.Println("Checking...")
-	counter, err := m.Now()
-	if err != nil {
-		log.Fatalln("failed to backup:", err)
+	var counter int
+	var err error
+	if len(paths) == 0 {
+		counter, err = m.Now(ctx)
+	} else {
+		counter, err = m.Check(ctx, paths...)
+	}
+	report(m, reg, retention, counter, err)
+}
+
+// report logs the result of a check and saves the hashes of the
+// archived paths. Failed paths are logged and retried on the next
+// check.
+func report(m *backup.Monitor, reg *registry.Registry, retention backup.Retention, counter int, err error) {
+	var errs *errorsandlogs.MultiErr
+	if errors.As(err, &errs) {
+		for _, err := range errs.Errors() {
+			if errors.Is(err, context.Canceled) {
+				log.Println("  Interrupted")
+			} else {
+				log.Println("failed to backup", err)
+			}
+		}
+	} else if err != nil {
+		log.Println("failed to backup:", err)
 	}
 	if counter > 0 {
 		log.Printf("  Archived %d directories\n", counter)
-		// update hashes
-		var path path
-		col.SelectEach(func(_ int, data []byte) (bool, []byte, bool) {
-			if err := json.Unmarshal(data, &path); err != nil {
-				log.Println("failed to unmarshal data (skipping):", err)
-				return true, data, false
+		for dir, changes := range m.Changed {
+			for _, c := range changes {
+				log.Printf("    %s: %s\n", dir, c)
+			}
+		}
+		if err := reg.SetHashes(m.Hashes()); err != nil {
+			log.Println("failed to update hashes:", err)
+		}
+	} else if err == nil {
+		log.Println("  No changes")
+	}
+	if !retention.IsZero() {
+		prune(m, retention)
+	}
+}
+
+// loadPaths makes the paths of the monitor match the registry and
+// returns the ones added.
+func loadPaths(reg *registry.Registry, m *backup.Monitor) ([]string, error) {
+	paths, err := reg.Paths()
+	if err != nil {
+		return nil, err
+	}
+	current := m.Hashes()
+	var added []string
+	for i := range paths {
+		p := &paths[i]
+		m.SetFilter(p.Path, &p.Filter)
+		if _, ok := current[p.Path]; ok {
+			delete(current, p.Path)
+			continue
+		}
+		m.AddPath(p.Path, p.Hash)
+		added = append(added, p.Path)
+	}
+	for path := range current {
+		m.RemovePath(path)
+		log.Println("Stopped watching", path)
+	}
+	return added, nil
+}
+
+// reloadPaths picks up the paths added or removed with the backup
+// tool while backupd is running, and has the added ones checked.
+func reloadPaths(reg *registry.Registry, m *backup.Monitor, trigger chan<- []string, interval time.Duration) {
+	gen := int64(-1) // reload once in case paths changed during startup
+	for range time.Tick(interval) {
+		latest, err := reg.Generation()
+		if err != nil {
+			log.Println("failed to read registry:", err)
+			continue
+		}
+		if latest == gen {
+			continue
+		}
+		added, err := loadPaths(reg, m)
+		if err != nil {
+			log.Println("failed to reload paths:", err)
+			continue
+		}
+		gen = latest
+		for _, path := range added {
+			log.Println("Started watching", path)
+		}
+		if len(added) > 0 {
+			trigger <- added
+		}
+	}
+}
+
+func prune(m *backup.Monitor, retention backup.Retention) {
+	dedup := false
+	for _, path := range m.PathList() {
+		pruned, err := backup.Prune(m.Destination, path, retention, false)
+		if err != nil {
+			log.Println("failed to prune", path+":", err)
+			continue
+		}
+		for _, snap := range pruned {
+			log.Printf("  Pruned %s\n", snap.File)
+			dedup = dedup || snap.Archiver == backup.DEDUP
+			if m.Storage == nil {
+				continue
+			}
+			name, err := backup.StorageName(m.Destination, snap.File)
+			if err == nil {
+				err = m.Storage.Delete(name)
+			}
+			if err == nil {
+				err = m.Storage.Delete(name + backup.ManifestExt)
+				if errors.Is(err, os.ErrNotExist) {
+					err = nil
+				}
 			}
-			path.Hash, _ = m.Paths[path.Path]
-			newdata, err := json.Marshal(&path)
 			if err != nil {
-				log.Println("failed to marshal data (skipping):", err)
-				return true, data, false
+				log.Println("failed to delete", name, "from storage:", err)
 			}
-			return true, newdata, false
-		})
-	} else {
-		log.Println("  No changes")
+		}
+	}
+	if dedup && m.Storage != nil {
+		// the chunks of the deleted snapshots are still in the storage
+		if _, err := backup.CollectStoredChunks(m.Storage, m.Destination); err != nil {
+			log.Println("failed to collect chunks in storage:", err)
+		}
 	}
 }
@@ -0,0 +1,174 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Hasher calculates a hash of an entire directory structure,
+// leaving out the files excluded by the Filter, which may be nil.
+// Monitor archives a path when its hash changes.
+type Hasher interface {
+	Hash(path string, f *Filter) (string, error)
+}
+
+// HashFunc adapts an ordinary function, like DirHash, to a Hasher.
+type HashFunc func(path string, f *Filter) (string, error)
+
+// Hash calls fn(path, f).
+func (fn HashFunc) Hash(path string, f *Filter) (string, error) {
+	return fn(path, f)
+}
+
+// ChangeReporter is implemented by Hashers that can tell which
+// files changed between their last two hashes of a path.
+type ChangeReporter interface {
+	Changes(path string) []Change
+}
+
+type cachedDigest struct {
+	ino   uint64
+	ctime int64
+	mtime int64
+	size  int64
+	sum   string
+}
+
+// ContentHasher hashes directories by the SHA-256 of their file
+// contents, so only real content changes alter the hash. Digests
+// are cached per file and reused while the inode, ctime, mtime and
+// size of the file stay the same, which keeps re-scans cheap.
+type ContentHasher struct {
+	mu      sync.Mutex
+	cache   map[string]cachedDigest
+	last    map[string]map[string]string
+	changes map[string][]Change
+}
+
+// NewContentHasher creates a ContentHasher with an empty cache.
+func NewContentHasher() *ContentHasher {
+	return &ContentHasher{
+		cache:   make(map[string]cachedDigest),
+		last:    make(map[string]map[string]string),
+		changes: make(map[string][]Change),
+	}
+}
+
+var _ ChangeReporter = (*ContentHasher)(nil)
+
+// Hash scans the directory and returns a hash of the relative paths,
+// permissions and content digests of everything in it that is not
+// left out by f or the IgnoreFile files.
+func (h *ContentHasher) Hash(root string, f *Filter) (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	digests := make(map[string]string)
+	seen := make(map[string]bool)
+	err := walkTree(root, f, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			digests[rel] = fmt.Sprintf("dir %v", info.Mode().Perm())
+			return nil
+		}
+		seen[path] = true
+		sum, err := h.digest(path, info)
+		if err != nil {
+			return err
+		}
+		digests[rel] = fmt.Sprintf("%s %v", sum, info.Mode().Perm())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	h.forget(root, seen)
+	if prev, ok := h.last[root]; ok {
+		h.changes[root] = compareDigests(prev, digests)
+	} else {
+		h.changes[root] = nil
+	}
+	h.last[root] = digests
+
+	names := make([]string, 0, len(digests))
+	for name := range digests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	hash := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(hash, "%s\x00%s\x00", name, digests[name])
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// Changes returns the files added, modified or removed under path
+// between the last two calls to Hash.
+func (h *ContentHasher) Changes(path string) []Change {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.changes[path]
+}
+
+func (h *ContentHasher) digest(path string, info os.FileInfo) (string, error) {
+	ino, ctime := fileID(info)
+	key := cachedDigest{ino: ino, ctime: ctime, mtime: info.ModTime().UnixNano(), size: info.Size()}
+	if cached, ok := h.cache[path]; ok {
+		key.sum = cached.sum
+		if cached == key {
+			return cached.sum, nil
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return "", err
+	}
+	key.sum = fmt.Sprintf("%x", sum.Sum(nil))
+	h.cache[path] = key
+	return key.sum, nil
+}
+
+// forget drops the cached digests of files under root that are gone.
+func (h *ContentHasher) forget(root string, seen map[string]bool) {
+	prefix := root + string(filepath.Separator)
+	for path := range h.cache {
+		if !seen[path] && (path == root || len(path) > len(prefix) && path[:len(prefix)] == prefix) {
+			delete(h.cache, path)
+		}
+	}
+}
+
+func compareDigests(prev, next map[string]string) []Change {
+	var changes []Change
+	for p, d := range next {
+		old, ok := prev[p]
+		if !ok {
+			changes = append(changes, Change{Kind: '+', Path: p})
+		} else if old != d {
+			changes = append(changes, Change{Kind: '~', Path: p})
+		}
+	}
+	for p := range prev {
+		if _, ok := next[p]; !ok {
+			changes = append(changes, Change{Kind: '-', Path: p})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
@@ -0,0 +1,110 @@
+package backup_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/bukodi/go-playground/backup"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentHasher(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "alpha")
+	writeTestFile(t, filepath.Join(dir, "sub", "b.txt"), "beta")
+	h := backup.NewContentHasher()
+
+	first, err := h.Hash(dir, nil)
+	require.NoError(t, err)
+	require.Empty(t, h.Changes(dir))
+
+	// touching a file does not change the content hash
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "a.txt"), later, later))
+	second, err := h.Hash(dir, nil)
+	require.NoError(t, err)
+	require.Equal(t, first, second)
+	require.Empty(t, h.Changes(dir))
+
+	// a same sized change with the original mtime is still noticed
+	info, err := os.Stat(filepath.Join(dir, "sub", "b.txt"))
+	require.NoError(t, err)
+	writeTestFile(t, filepath.Join(dir, "sub", "b.txt"), "BETA")
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "sub", "b.txt"), info.ModTime(), info.ModTime()))
+	writeTestFile(t, filepath.Join(dir, "c.txt"), "gamma")
+	require.NoError(t, os.Remove(filepath.Join(dir, "a.txt")))
+	third, err := h.Hash(dir, nil)
+	require.NoError(t, err)
+	require.NotEqual(t, second, third)
+	require.Equal(t, []backup.Change{
+		{Kind: '-', Path: "a.txt"},
+		{Kind: '+', Path: "c.txt"},
+		{Kind: '~', Path: "sub/b.txt"},
+	}, h.Changes(dir))
+}
+
+func TestMonitorReportsChanges(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "alpha")
+	a := &TestArchiver{}
+	m := &backup.Monitor{
+		Destination: t.TempDir(),
+		Paths:       map[string]string{dir: ""},
+		Archiver:    a,
+		Hasher:      backup.NewContentHasher(),
+	}
+	n, err := m.Now(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	n, err = m.Now(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "alpha2")
+	n, err = m.Now(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, []backup.Change{{Kind: '~', Path: "a.txt"}}, m.Changed[dir])
+	require.Len(t, a.Archives, 2)
+}
+
+func TestMonitorDedupKeepsMTimeChanges(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs the inode and ctime of files")
+	}
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	writeTestFile(t, file, "alpha")
+	m := &backup.Monitor{
+		Destination: t.TempDir(),
+		Paths:       map[string]string{dir: ""},
+		Archiver:    backup.DEDUP,
+		Hasher:      backup.NewContentHasher(),
+	}
+	_, err := m.Now(context.Background())
+	require.NoError(t, err)
+
+	// same size, same mtime, other content
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	writeTestFile(t, file, "omega")
+	require.NoError(t, os.Chtimes(file, info.ModTime(), info.ModTime()))
+	n, err := m.Now(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	snaps, err := backup.Snapshots(m.Destination, dir)
+	require.NoError(t, err)
+	require.Len(t, snaps, 2)
+	restored := t.TempDir()
+	require.NoError(t, backup.DEDUP.Restore(snaps[1].File, restored))
+	data, err := ioutil.ReadFile(filepath.Join(restored, "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "omega", string(data))
+}
@@ -0,0 +1,379 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChunkDir is the name of the directory, next to the per path
+// archive directories, where the DEDUP archiver keeps its chunks.
+const ChunkDir = ".chunks"
+
+const (
+	chunkMin  = 256 << 10
+	chunkMax  = 4 << 20
+	chunkMask = 1<<20 - 1
+)
+
+// gearTable drives the rolling hash used to find chunk boundaries.
+var gearTable [256]uint64
+
+func init() {
+	for i := range gearTable {
+		sum := sha256.Sum256([]byte{byte(i)})
+		gearTable[i] = binary.BigEndian.Uint64(sum[:8])
+	}
+}
+
+// Snapshot is the manifest written by the DEDUP archiver. It lists
+// every file of the archived directory with the chunks holding its
+// content.
+type Snapshot struct {
+	Source  string          `json:"source"`
+	Created time.Time       `json:"created"`
+	Files   []*SnapshotFile `json:"files"`
+}
+
+// SnapshotFile is a single entry of a Snapshot. Path is relative to
+// the archived directory and always uses forward slashes. SHA256 is
+// the digest of the content. Ino and CTime, where the platform has
+// them, tell with Size and ModTime whether the file is unchanged
+// since.
+type SnapshotFile struct {
+	Path    string      `json:"path"`
+	Dir     bool        `json:"dir,omitempty"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mtime"`
+	Size    int64       `json:"size"`
+	Ino     uint64      `json:"ino,omitempty"`
+	CTime   int64       `json:"ctime,omitempty"`
+	SHA256  string      `json:"sha256,omitempty"`
+	Chunks  []string    `json:"chunks,omitempty"`
+}
+
+// ReadSnapshot loads a snapshot manifest written by the DEDUP archiver.
+func ReadSnapshot(path string) (*Snapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseSnapshot(path, data)
+}
+
+func parseSnapshot(name string, data []byte) (*Snapshot, error) {
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("invalid snapshot %s: %w", name, err)
+	}
+	return &snap, nil
+}
+
+type deduper struct{}
+
+func (d *deduper) DestFmt() string {
+	return "%d.snap"
+}
+
+// chunkStore returns the chunk directory shared by all snapshots
+// stored under the same destination as snap.
+func (d *deduper) chunkStore(snap string) string {
+	return filepath.Join(filepath.Dir(filepath.Dir(snap)), ChunkDir)
+}
+
+// chunkPath returns where the chunk of the hex SHA-256 digest sum is
+// kept in store. Digests come from snapshots, so anything else is
+// rejected.
+func chunkPath(store, sum string) (string, error) {
+	if err := checkChunk(sum); err != nil {
+		return "", err
+	}
+	return filepath.Join(store, sum[:2], sum), nil
+}
+
+func checkChunk(sum string) error {
+	if len(sum) != 2*sha256.Size {
+		return fmt.Errorf("invalid chunk id %q", sum)
+	}
+	if _, err := hex.DecodeString(sum); err != nil {
+		return fmt.Errorf("invalid chunk id %q", sum)
+	}
+	return nil
+}
+
+func (d *deduper) Archive(ctx context.Context, src, dest string) error {
+	store := d.chunkStore(dest)
+	if err := os.MkdirAll(filepath.Dir(dest), 0777); err != nil {
+		return err
+	}
+	prev := previousFiles(filepath.Dir(dest), store)
+	snap := &Snapshot{Source: src, Created: time.Now()}
+	err := walkTree(src, filterOf(ctx), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		entry := &SnapshotFile{
+			Path:    filepath.ToSlash(rel),
+			Dir:     info.IsDir(),
+			Mode:    info.Mode().Perm(),
+			ModTime: info.ModTime(),
+		}
+		snap.Files = append(snap.Files, entry)
+		if info.IsDir() {
+			return nil
+		}
+		entry.Size = info.Size()
+		entry.Ino, entry.CTime = fileID(info)
+		if old, ok := prev[entry.Path]; ok && old.unchanged(entry) {
+			// unchanged, nothing to store
+			entry.Chunks, entry.SHA256 = old.Chunks, old.SHA256
+			archiveSumsOf(ctx).set(entry.Path, entry.SHA256)
+			return nil
+		}
+		entry.Chunks, entry.SHA256, err = storeChunks(ctx, store, path, entry.Path)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dest, data, 0666)
+}
+
+// unchanged tells if f, of an earlier snapshot, still describes the
+// file of entry. Like the digests cached by ContentHasher, chunks are
+// only reused while the inode and ctime are also the same, as a
+// rewrite that keeps the size and mtime changes those.
+func (f *SnapshotFile) unchanged(entry *SnapshotFile) bool {
+	return f.Size == entry.Size && f.ModTime.Equal(entry.ModTime) &&
+		f.Ino == entry.Ino && f.CTime == entry.CTime && f.SHA256 != ""
+}
+
+// previousFiles returns the entries of the latest snapshot in dir
+// whose chunks are all still present in store.
+func previousFiles(dir, store string) map[string]*SnapshotFile {
+	files := make(map[string]*SnapshotFile)
+	names, _ := filepath.Glob(filepath.Join(dir, "*.snap"))
+	if len(names) == 0 {
+		return files
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return snapshotTime(names[i]) < snapshotTime(names[j])
+	})
+	snap, err := ReadSnapshot(names[len(names)-1])
+	if err != nil {
+		return files
+	}
+	for _, f := range snap.Files {
+		if f.Dir || !touchChunks(store, f.Chunks) {
+			continue
+		}
+		files[f.Path] = f
+	}
+	return files
+}
+
+func snapshotTime(name string) int64 {
+	n, _ := strconv.ParseInt(strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)), 10, 64)
+	return n
+}
+
+// touchChunks tells if the chunks are all present in store, and
+// marks them as used now, so CollectChunks spares them until the
+// snapshot reusing them is written.
+func touchChunks(store string, sums []string) bool {
+	now := time.Now()
+	for _, sum := range sums {
+		path, err := chunkPath(store, sum)
+		if err != nil {
+			return false
+		}
+		if err := os.Chtimes(path, now, now); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// storeChunks splits the file archived as name into content defined
+// chunks and writes the ones missing from the store. It returns the
+// chunk digests in file order and the digest of the whole file.
+func storeChunks(ctx context.Context, store, path, name string) ([]string, string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer in.Close()
+	archived := newArchivedReader(ctx, name, in)
+	r := bufio.NewReaderSize(archived, 1<<20)
+	buf := make([]byte, 0, chunkMax)
+	var sums []string
+	for {
+		chunk, err := nextChunk(r, buf[:0])
+		if len(chunk) > 0 {
+			sum := sha256.Sum256(chunk)
+			hexSum := hex.EncodeToString(sum[:])
+			if err := writeChunk(store, hexSum, chunk); err != nil {
+				return nil, "", err
+			}
+			sums = append(sums, hexSum)
+		}
+		if err == io.EOF {
+			archived.archived()
+			return sums, archived.sum(), nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+	}
+}
+
+// nextChunk reads bytes into buf until a chunk boundary is found by
+// the gear rolling hash or the maximum chunk size is reached.
+func nextChunk(r *bufio.Reader, buf []byte) ([]byte, error) {
+	var h uint64
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return buf, err
+		}
+		buf = append(buf, b)
+		h = h<<1 + gearTable[b]
+		if len(buf) >= chunkMax || (len(buf) >= chunkMin && h&chunkMask == 0) {
+			return buf, nil
+		}
+	}
+}
+
+func writeChunk(store, sum string, data []byte) error {
+	path, err := chunkPath(store, sum)
+	if err != nil {
+		return err
+	}
+	if now := time.Now(); os.Chtimes(path, now, now) == nil {
+		return nil // already stored, now marked as used
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), sum+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (d *deduper) Restore(src, dest string) error {
+	snap, err := ReadSnapshot(src)
+	if err != nil {
+		return err
+	}
+	store := d.chunkStore(src)
+	for _, f := range snap.Files {
+		target, err := safeJoin(dest, f.Path)
+		if err != nil {
+			return err
+		}
+		if f.Dir {
+			if err := os.MkdirAll(target, 0777); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := restoreChunks(store, f, target); err != nil {
+			return err
+		}
+	}
+	// directory times are set last, as restoring their content
+	// updates them
+	for i := len(snap.Files) - 1; i >= 0; i-- {
+		f := snap.Files[i]
+		if !f.Dir {
+			continue
+		}
+		target, _ := safeJoin(dest, f.Path) // checked above
+		if err := os.Chmod(target, f.Mode); err != nil {
+			return err
+		}
+		if err := os.Chtimes(target, f.ModTime, f.ModTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func restoreChunks(store string, f *SnapshotFile, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, f.Mode)
+	if err != nil {
+		return err
+	}
+	for _, sum := range f.Chunks {
+		path, err := chunkPath(store, sum)
+		if err != nil {
+			out.Close()
+			return fmt.Errorf("%s: %w", f.Path, err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			out.Close()
+			return err
+		}
+		if actual := sha256.Sum256(data); hex.EncodeToString(actual[:]) != sum {
+			out.Close()
+			return fmt.Errorf("chunk %s of %s is corrupted", sum, f.Path)
+		}
+		if _, err := out.Write(data); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(target, f.Mode); err != nil {
+		return err
+	}
+	return os.Chtimes(target, f.ModTime, f.ModTime)
+}
+
+// DEDUP is an Archiver that writes snapshot manifests and stores the
+// file contents as content addressed chunks shared by all snapshots
+// under the same destination.
+var DEDUP Archiver = (*deduper)(nil)
@@ -0,0 +1,111 @@
+package backup_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bukodi/go-playground/backup"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0777))
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func countChunks(t *testing.T, store string) int {
+	n := 0
+	err := filepath.Walk(store, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			n++
+		}
+		return err
+	})
+	require.NoError(t, err)
+	return n
+}
+
+func TestDedupArchive(t *testing.T) {
+	src := t.TempDir()
+	archive := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "a.txt"), "alpha")
+	writeTestFile(t, filepath.Join(src, "sub", "b.txt"), "beta")
+	writeTestFile(t, filepath.Join(src, "sub", "c.txt"), "alpha")
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "empty"), 0777))
+
+	dest := func(n int) string {
+		return filepath.Join(archive, "src", fmt.Sprintf(backup.DEDUP.DestFmt(), n))
+	}
+	store := filepath.Join(archive, backup.ChunkDir)
+
+	require.NoError(t, backup.DEDUP.Archive(context.Background(), src, dest(1)))
+	require.Equal(t, 2, countChunks(t, store), "identical contents must share a chunk")
+
+	// an unchanged tree costs only the manifest
+	require.NoError(t, backup.DEDUP.Archive(context.Background(), src, dest(2)))
+	require.Equal(t, 2, countChunks(t, store))
+
+	// a modified file adds a single chunk
+	later := time.Now().Add(time.Minute)
+	writeTestFile(t, filepath.Join(src, "sub", "b.txt"), "gamma")
+	require.NoError(t, os.Chtimes(filepath.Join(src, "sub", "b.txt"), later, later))
+	require.NoError(t, backup.DEDUP.Archive(context.Background(), src, dest(3)))
+	require.Equal(t, 3, countChunks(t, store))
+
+	restored := filepath.Join(t.TempDir(), "restored")
+	require.NoError(t, backup.DEDUP.Restore(dest(2), restored))
+	data, err := ioutil.ReadFile(filepath.Join(restored, "sub", "b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "beta", string(data))
+	info, err := os.Stat(filepath.Join(restored, "empty"))
+	require.NoError(t, err)
+	require.True(t, info.IsDir())
+
+	require.NoError(t, backup.DEDUP.Restore(dest(3), restored))
+	data, err = ioutil.ReadFile(filepath.Join(restored, "sub", "b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "gamma", string(data))
+}
+
+func TestDedupRestoreDetectsCorruption(t *testing.T) {
+	src := t.TempDir()
+	archive := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "a.txt"), "alpha")
+	snap := filepath.Join(archive, "src", "1.snap")
+	require.NoError(t, backup.DEDUP.Archive(context.Background(), src, snap))
+
+	s, err := backup.ReadSnapshot(snap)
+	require.NoError(t, err)
+	require.Len(t, s.Files, 1)
+	sum := s.Files[0].Chunks[0]
+	chunk := filepath.Join(archive, backup.ChunkDir, sum[:2], sum)
+	require.NoError(t, ioutil.WriteFile(chunk, []byte("tampered"), 0644))
+
+	require.Error(t, backup.DEDUP.Restore(snap, t.TempDir()))
+}
+
+func TestDedupRestoreRejectsCraftedSnapshots(t *testing.T) {
+	for name, file := range map[string]string{
+		"escaping path": `{"path": "../escaped.txt", "mode": 420}`,
+		"absolute path": `{"path": "/escaped.txt", "mode": 420}`,
+		"short chunk":   `{"path": "a.txt", "mode": 420, "chunks": ["a"]}`,
+		"traversing id": `{"path": "a.txt", "mode": 420, "chunks": ["../../../../../../../../../../../../../../etc/passwd"]}`,
+		"non hex chunk": `{"path": "a.txt", "mode": 420, "chunks": ["zz` + strings.Repeat("0", 62) + `"]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			archive := t.TempDir()
+			snap := filepath.Join(archive, "src", "1.snap")
+			writeTestFile(t, snap, `{"source": "src", "files": [`+file+`]}`)
+			dest := filepath.Join(t.TempDir(), "dest")
+			require.Error(t, backup.DEDUP.Restore(snap, dest))
+			_, err := os.Stat(filepath.Join(filepath.Dir(dest), "escaped.txt"))
+			require.True(t, os.IsNotExist(err))
+		})
+	}
+}
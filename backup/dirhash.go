@@ -5,22 +5,27 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 )
 
 // DirHash calculates an MD5 hash of an entire directory
-// structure.
-func DirHash(path string) (string, error) {
+// structure. Files left out by f, which may be nil, and by
+// IgnoreFile files are not part of the hash.
+func DirHash(path string, f *Filter) (string, error) {
 	hash := md5.New()
-	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+	err := walkTree(path, f, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 		io.WriteString(hash, path)
 		fmt.Fprintf(hash, "%v", info.IsDir())
-		fmt.Fprintf(hash, "%v", info.ModTime())
 		fmt.Fprintf(hash, "%v", info.Mode())
 		fmt.Fprintf(hash, "%v", info.Name())
+		if info.IsDir() {
+			// the mtime and size of a directory also change when
+			// excluded files are added to it
+			return nil
+		}
+		fmt.Fprintf(hash, "%v", info.ModTime())
 		fmt.Fprintf(hash, "%v", info.Size())
 		return nil
 	})
@@ -3,20 +3,20 @@ package backup_test
 import (
 	"testing"
 
+	"github.com/bukodi/go-playground/backup"
 	"github.com/stretchr/testify/require"
-	"github.com/bukodi/go-playgroud/backup"
 )
 
 func TestDirHash(t *testing.T) {
 
-	hash1a, err := backup.DirHash("test/hash1")
+	hash1a, err := backup.DirHash("test/hash1", nil)
 	require.NoError(t, err)
-	hash1b, err := backup.DirHash("test/hash1")
+	hash1b, err := backup.DirHash("test/hash1", nil)
 	require.NoError(t, err)
 
 	require.Equal(t, hash1a, hash1b, "hash1 and hash1b should be identical")
 
-	hash2, err := backup.DirHash("test/hash2")
+	hash2, err := backup.DirHash("test/hash2", nil)
 	require.NoError(t, err)
 
 	require.NotEqual(t, hash1a, hash2, "hash1 and hash2 should not be the same")
@@ -0,0 +1,517 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// ErrTampered is returned by the Restore of an encrypted archive
+// that was modified, truncated or encrypted for another key.
+var ErrTampered = errors.New("encrypted archive is corrupted or tampered with")
+
+const (
+	encMagic     = "BKENC1\n"
+	encChunkSize = 64 << 10
+	encKeySize   = 32
+
+	// maxIterations bounds the PBKDF2 iterations read from an archive,
+	// which could otherwise keep a restore busy for hours.
+	maxIterations = 10000000
+)
+
+// KeyWrapper protects the random key every encrypted archive is
+// encrypted with.
+type KeyWrapper interface {
+	// WrapKey returns an encrypted form of the archive key.
+	WrapKey(key []byte) (json.RawMessage, error)
+	// UnwrapKey recovers the archive key from the output of WrapKey.
+	UnwrapKey(wrapped json.RawMessage) ([]byte, error)
+}
+
+type encrypted struct {
+	inner Archiver
+	keys  KeyWrapper
+}
+
+// streamArchiver is an Archiver that can write its archive to a
+// stream, which the encrypting Archiver encrypts as it is written.
+type streamArchiver interface {
+	Archiver
+	archiveTo(ctx context.Context, src string, w io.Writer) error
+}
+
+// NewEncrypted returns an Archiver that archives with inner and
+// encrypts the result with AES-256-GCM, streamed in 64 KiB chunks, so
+// the plain archive never reaches the disk. inner must write a single
+// archive stream: ZIP, TarGz and TarZstd do, DEDUP, storing its chunks
+// as they are, can not be encrypted. Restore authenticates the whole
+// archive before handing it to inner and returns ErrTampered if it was
+// modified.
+func NewEncrypted(inner Archiver, keys KeyWrapper) Archiver {
+	return &encrypted{inner: inner, keys: keys}
+}
+
+// RegisterEncrypted adds an encrypting variant of every Archiver that
+// can be encrypted to Archivers, so their encrypted archives are
+// recognized by ArchiverFor and Snapshots.
+func RegisterEncrypted(keys KeyWrapper) {
+	for name, a := range Archivers {
+		if _, ok := a.(streamArchiver); !ok {
+			continue
+		}
+		Archivers[name+"+enc"] = NewEncrypted(a, keys)
+	}
+}
+
+func (e *encrypted) DestFmt() string {
+	return e.inner.DestFmt() + ".enc"
+}
+
+type encHeader struct {
+	Version int             `json:"v"`
+	Nonce   []byte          `json:"nonce"`
+	Key     json.RawMessage `json:"key"`
+}
+
+// plainTemp creates the file the authenticated plain archive is kept
+// in while inner restores it, as the archivers read files: inside
+// dest, which gets the plain content anyway, and readable only by the
+// owner.
+func plainTemp(dest string) (*os.File, error) {
+	if err := os.MkdirAll(dest, 0777); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(dest, ".backup-restore-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return tmp, nil
+}
+
+func (e *encrypted) Archive(ctx context.Context, src, dest string) error {
+	inner, ok := e.inner.(streamArchiver)
+	if !ok {
+		return fmt.Errorf("%s archives can not be encrypted", strings.TrimPrefix(e.inner.DestFmt(), "%d"))
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0777); err != nil {
+		return err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	archived := make(chan struct{})
+	go func() {
+		defer close(archived)
+		pw.CloseWithError(inner.archiveTo(ctx, src, pw))
+	}()
+	err = e.encrypt(pr, out)
+	pr.CloseWithError(err) // stops inner if encrypting failed
+	<-archived
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (e *encrypted) encrypt(in io.Reader, out io.Writer) error {
+	key := make([]byte, encKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return err
+	}
+	wrapped, err := e.keys.WrapKey(key)
+	if err != nil {
+		return err
+	}
+	h := encHeader{Version: 1, Nonce: make([]byte, 7), Key: wrapped}
+	if _, err := io.ReadFull(rand.Reader, h.Nonce); err != nil {
+		return err
+	}
+	header, err := json.Marshal(&h)
+	if err != nil {
+		return err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	w.WriteString(encMagic)
+	binary.Write(w, binary.BigEndian, uint32(len(header)))
+	w.Write(header)
+
+	// Each chunk is sealed with a nonce made of the random prefix, the
+	// chunk counter and a final chunk flag, with the header as
+	// additional data, so chunks cannot be reordered, dropped or
+	// moved between archives (the STREAM construction).
+	buf := make([]byte, encChunkSize)
+	r := bufio.NewReader(in)
+	n, err := io.ReadFull(r, buf[:encChunkSize])
+	for counter := uint32(0); ; counter++ {
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		last := true
+		if err == nil {
+			// peek to find out whether this was the last chunk
+			_, perr := r.Peek(1)
+			last = perr == io.EOF
+		}
+		sealed := aead.Seal(nil, chunkNonce(h.Nonce, counter, last), buf[:n], header)
+		binary.Write(w, binary.BigEndian, uint32(len(sealed)))
+		w.Write(sealed)
+		if last {
+			break
+		}
+		n, err = io.ReadFull(r, buf[:encChunkSize])
+	}
+	return w.Flush()
+}
+
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[7:], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (e *encrypted) Restore(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := plainTemp(dest)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := e.decrypt(bufio.NewReader(in), tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("%s: %w", src, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return e.inner.Restore(tmp.Name(), dest)
+}
+
+func (e *encrypted) decrypt(in io.Reader, out io.Writer) error {
+	magic := make([]byte, len(encMagic))
+	if _, err := io.ReadFull(in, magic); err != nil || string(magic) != encMagic {
+		return errors.New("not an encrypted archive")
+	}
+	var size uint32
+	if err := binary.Read(in, binary.BigEndian, &size); err != nil || size > 1<<20 {
+		return ErrTampered
+	}
+	header := make([]byte, size)
+	if _, err := io.ReadFull(in, header); err != nil {
+		return ErrTampered
+	}
+	var h encHeader
+	if err := json.Unmarshal(header, &h); err != nil || h.Version != 1 || len(h.Nonce) != 7 {
+		return ErrTampered
+	}
+	key, err := e.keys.UnwrapKey(h.Key)
+	if err != nil {
+		return err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, encChunkSize+aead.Overhead())
+	for counter := uint32(0); ; counter++ {
+		if err := binary.Read(in, binary.BigEndian, &size); err != nil {
+			return ErrTampered // truncated before the final chunk
+		}
+		if int(size) > len(buf) || int(size) < aead.Overhead() {
+			return ErrTampered
+		}
+		if _, err := io.ReadFull(in, buf[:size]); err != nil {
+			return ErrTampered
+		}
+		plain, err := aead.Open(nil, chunkNonce(h.Nonce, counter, false), buf[:size], header)
+		last := false
+		if err != nil {
+			plain, err = aead.Open(nil, chunkNonce(h.Nonce, counter, true), buf[:size], header)
+			last = true
+		}
+		if err != nil {
+			return ErrTampered
+		}
+		if _, err := out.Write(plain); err != nil {
+			return err
+		}
+		if last {
+			if n, _ := in.Read(make([]byte, 1)); n > 0 {
+				return ErrTampered // data after the final chunk
+			}
+			return nil
+		}
+	}
+}
+
+type passphraseKey struct {
+	passphrase []byte
+	iterations int
+}
+
+type wrappedPassphraseKey struct {
+	Alg        string `json:"alg"`
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iter"`
+	Nonce      []byte `json:"nonce"`
+	Key        []byte `json:"key"`
+}
+
+// PassphraseKey protects archive keys with a key derived from the
+// passphrase with PBKDF2-SHA256 and a random salt per archive, like
+// the PBES2 key management of JWE.
+func PassphraseKey(passphrase string) KeyWrapper {
+	return &passphraseKey{passphrase: []byte(passphrase), iterations: 200000}
+}
+
+func (p *passphraseKey) WrapKey(key []byte) (json.RawMessage, error) {
+	w := wrappedPassphraseKey{Alg: "PBKDF2-SHA256+A256GCM", Salt: make([]byte, 16), Iterations: p.iterations, Nonce: make([]byte, 12)}
+	if _, err := io.ReadFull(rand.Reader, w.Salt); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, w.Nonce); err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(pbkdf2.Key(p.passphrase, w.Salt, w.Iterations, encKeySize, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	w.Key = aead.Seal(nil, w.Nonce, key, []byte(w.Alg))
+	return json.Marshal(&w)
+}
+
+func (p *passphraseKey) UnwrapKey(wrapped json.RawMessage) ([]byte, error) {
+	var w wrappedPassphraseKey
+	if err := json.Unmarshal(wrapped, &w); err != nil || w.Alg != "PBKDF2-SHA256+A256GCM" || len(w.Nonce) != 12 {
+		return nil, errors.New("archive is not encrypted with a passphrase")
+	}
+	if w.Iterations < 1 || w.Iterations > maxIterations {
+		return nil, fmt.Errorf("%w: %d PBKDF2 iterations", ErrTampered, w.Iterations)
+	}
+	aead, err := newGCM(pbkdf2.Key(p.passphrase, w.Salt, w.Iterations, encKeySize, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	key, err := aead.Open(nil, w.Nonce, w.Key, []byte(w.Alg))
+	if err != nil {
+		return nil, errors.New("wrong passphrase or tampered archive key")
+	}
+	return key, nil
+}
+
+type certificateKey struct {
+	cert *x509.Certificate
+	priv crypto.PrivateKey
+}
+
+type wrappedCertificateKey struct {
+	Alg       string `json:"alg"`
+	Cert      []byte `json:"cert"` // SHA-256 of the recipient certificate
+	Ephemeral []byte `json:"epk,omitempty"`
+	Nonce     []byte `json:"nonce,omitempty"`
+	Key       []byte `json:"key"`
+}
+
+// CertificateKey protects archive keys for the holder of the private
+// key of cert: with RSA-OAEP for RSA keys and with ECDH-ES and
+// AES-GCM for EC keys. priv is only needed for restoring and may be
+// nil when archiving.
+func CertificateKey(cert *x509.Certificate, priv crypto.PrivateKey) KeyWrapper {
+	return &certificateKey{cert: cert, priv: priv}
+}
+
+func (c *certificateKey) WrapKey(key []byte) (json.RawMessage, error) {
+	id := sha256.Sum256(c.cert.Raw)
+	w := wrappedCertificateKey{Cert: id[:]}
+	switch pub := c.cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		w.Alg = "RSA-OAEP-256"
+		wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, key, nil)
+		if err != nil {
+			return nil, err
+		}
+		w.Key = wrapped
+	case *ecdsa.PublicKey:
+		w.Alg = "ECDH-ES+A256GCM"
+		eph, x, y, err := elliptic.GenerateKey(pub.Curve, rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		w.Ephemeral = elliptic.Marshal(pub.Curve, x, y)
+		sx, _ := pub.Curve.ScalarMult(pub.X, pub.Y, eph)
+		aead, err := ecdhKEK(pub.Curve, sx, w.Ephemeral)
+		if err != nil {
+			return nil, err
+		}
+		w.Nonce = make([]byte, aead.NonceSize())
+		w.Key = aead.Seal(nil, w.Nonce, key, w.Cert)
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return json.Marshal(&w)
+}
+
+func (c *certificateKey) UnwrapKey(wrapped json.RawMessage) ([]byte, error) {
+	var w wrappedCertificateKey
+	if err := json.Unmarshal(wrapped, &w); err != nil || w.Alg == "" {
+		return nil, errors.New("archive is not encrypted for a certificate")
+	}
+	if id := sha256.Sum256(c.cert.Raw); string(id[:]) != string(w.Cert) {
+		return nil, errors.New("archive is encrypted for another certificate")
+	}
+	var key []byte
+	var err error
+	switch priv := c.priv.(type) {
+	case *rsa.PrivateKey:
+		if w.Alg != "RSA-OAEP-256" {
+			return nil, fmt.Errorf("unexpected key algorithm %s", w.Alg)
+		}
+		key, err = rsa.DecryptOAEP(sha256.New(), nil, priv, w.Key, nil)
+	case *ecdsa.PrivateKey:
+		if w.Alg != "ECDH-ES+A256GCM" {
+			return nil, fmt.Errorf("unexpected key algorithm %s", w.Alg)
+		}
+		x, y := elliptic.Unmarshal(priv.Curve, w.Ephemeral)
+		if x == nil {
+			return nil, ErrTampered
+		}
+		sx, _ := priv.Curve.ScalarMult(x, y, priv.D.Bytes())
+		var aead cipher.AEAD
+		if aead, err = ecdhKEK(priv.Curve, sx, w.Ephemeral); err == nil {
+			key, err = aead.Open(nil, w.Nonce, w.Key, w.Cert)
+		}
+	case nil:
+		return nil, errors.New("private key is needed to restore encrypted archives")
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", priv)
+	}
+	if err != nil {
+		return nil, ErrTampered
+	}
+	return key, nil
+}
+
+// ecdhKEK derives the key encryption key from the shared secret with
+// HKDF-SHA256, binding the ephemeral public key.
+func ecdhKEK(curve elliptic.Curve, sharedX *big.Int, ephemeral []byte) (cipher.AEAD, error) {
+	secret := make([]byte, (curve.Params().BitSize+7)/8)
+	sharedX.FillBytes(secret)
+	kek := make([]byte, encKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, ephemeral, []byte("backup archive key")), kek); err != nil {
+		return nil, err
+	}
+	return newGCM(kek)
+}
+
+// LoadKeyWrapper creates the KeyWrapper configured on the command
+// line: a passphrase read from passphraseFile, or the PEM encoded
+// certificate in certFile with the optional private key in keyFile.
+// It returns nil if neither is given.
+func LoadKeyWrapper(passphraseFile, certFile, keyFile string) (KeyWrapper, error) {
+	switch {
+	case passphraseFile != "" && certFile != "":
+		return nil, errors.New("use either a passphrase or a certificate")
+	case passphraseFile != "":
+		data, err := ioutil.ReadFile(passphraseFile)
+		if err != nil {
+			return nil, err
+		}
+		passphrase := strings.TrimRight(string(data), "\r\n")
+		if passphrase == "" {
+			return nil, errors.New("empty passphrase")
+		}
+		return PassphraseKey(passphrase), nil
+	case certFile != "":
+		block, err := readPEM(certFile)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		var priv crypto.PrivateKey
+		if keyFile != "" {
+			if block, err = readPEM(keyFile); err != nil {
+				return nil, err
+			}
+			if priv, err = parsePrivateKey(block.Bytes); err != nil {
+				return nil, err
+			}
+		}
+		return CertificateKey(cert, priv), nil
+	}
+	return nil, nil
+}
+
+func readPEM(file string) (*pem.Block, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", file)
+	}
+	return block, nil
+}
+
+func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	return x509.ParseECPrivateKey(der)
+}
@@ -0,0 +1,171 @@
+package backup_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bukodi/go-playground/backup"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestCert(t *testing.T, serial int64, priv crypto.Signer) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "backup"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func archiveEncrypted(t *testing.T, a backup.Archiver) (string, string) {
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "secret.txt"), "top secret")
+	dest := filepath.Join(t.TempDir(), "src", "1.zip.enc")
+	require.NoError(t, a.Archive(context.Background(), src, dest))
+	data, err := ioutil.ReadFile(dest)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "top secret")
+	return src, dest
+}
+
+func requireRestored(t *testing.T, a backup.Archiver, archive string) {
+	dest := t.TempDir()
+	require.NoError(t, a.Restore(archive, dest))
+	data, err := ioutil.ReadFile(filepath.Join(dest, "secret.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "top secret", string(data))
+}
+
+func TestEncryptedPassphrase(t *testing.T) {
+	a := backup.NewEncrypted(backup.ZIP, backup.PassphraseKey("correct horse"))
+	require.Equal(t, "%d.zip.enc", a.DestFmt())
+	_, archive := archiveEncrypted(t, a)
+	requireRestored(t, a, archive)
+
+	wrong := backup.NewEncrypted(backup.ZIP, backup.PassphraseKey("battery staple"))
+	require.Error(t, wrong.Restore(archive, t.TempDir()))
+}
+
+func TestEncryptedTampering(t *testing.T) {
+	a := backup.NewEncrypted(backup.ZIP, backup.PassphraseKey("correct horse"))
+	_, archive := archiveEncrypted(t, a)
+	data, err := ioutil.ReadFile(archive)
+	require.NoError(t, err)
+
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)-20] ^= 1
+	require.NoError(t, ioutil.WriteFile(archive, flipped, 0644))
+	dest := t.TempDir()
+	require.ErrorIs(t, a.Restore(archive, dest), backup.ErrTampered)
+	entries, err := ioutil.ReadDir(dest)
+	require.NoError(t, err)
+	require.Empty(t, entries, "nothing is restored from a tampered archive")
+
+	require.NoError(t, ioutil.WriteFile(archive, data[:len(data)-1], 0644))
+	require.ErrorIs(t, a.Restore(archive, t.TempDir()), backup.ErrTampered)
+
+	require.NoError(t, ioutil.WriteFile(archive, append(data, 0), 0644))
+	require.ErrorIs(t, a.Restore(archive, t.TempDir()), backup.ErrTampered)
+}
+
+func TestEncryptedCertificate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	for name, priv := range map[string]crypto.Signer{"rsa": rsaKey, "ec": ecKey} {
+		t.Run(name, func(t *testing.T) {
+			cert := createTestCert(t, 1, priv)
+			// archiving needs only the certificate
+			_, archive := archiveEncrypted(t, backup.NewEncrypted(backup.ZIP, backup.CertificateKey(cert, nil)))
+			requireRestored(t, backup.NewEncrypted(backup.ZIP, backup.CertificateKey(cert, priv)), archive)
+
+			require.Error(t, backup.NewEncrypted(backup.ZIP, backup.CertificateKey(cert, nil)).Restore(archive, t.TempDir()))
+			other := createTestCert(t, 2, priv)
+			require.Error(t, backup.NewEncrypted(backup.ZIP, backup.CertificateKey(other, priv)).Restore(archive, t.TempDir()))
+		})
+	}
+}
+
+func TestRegisterEncrypted(t *testing.T) {
+	keys := backup.PassphraseKey("correct horse")
+	backup.RegisterEncrypted(keys)
+	defer delete(backup.Archivers, "zip+enc")
+	_, ok := backup.Archivers["dedup+enc"]
+	require.False(t, ok)
+
+	src := filepath.Join(t.TempDir(), "docs")
+	writeTestFile(t, filepath.Join(src, "secret.txt"), "top secret")
+	archive := t.TempDir()
+	m := &backup.Monitor{Destination: archive, Archiver: backup.Archivers["zip+enc"], Paths: map[string]string{src: ""}}
+	_, err := m.Now(context.Background())
+	require.NoError(t, err)
+	snaps, err := backup.Snapshots(archive, src)
+	require.NoError(t, err)
+	require.Len(t, snaps, 1)
+	dest := t.TempDir()
+	require.NoError(t, backup.RestoreSnapshot(snaps[0].File, dest))
+	_, err = os.Stat(filepath.Join(dest, "secret.txt"))
+	require.NoError(t, err)
+}
+
+func TestEncryptedLeavesNoPlaintext(t *testing.T) {
+	a := backup.NewEncrypted(backup.ZIP, backup.PassphraseKey("correct horse"))
+	_, archive := archiveEncrypted(t, a)
+	requireRestored(t, a, archive)
+	entries, err := ioutil.ReadDir(filepath.Dir(archive))
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "only the encrypted archive is kept")
+
+	dest := t.TempDir()
+	require.NoError(t, a.Restore(archive, dest))
+	entries, err = ioutil.ReadDir(dest)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "only the restored file is kept")
+	require.Equal(t, "secret.txt", entries[0].Name())
+}
+
+func TestEncryptedDedup(t *testing.T) {
+	a := backup.NewEncrypted(backup.DEDUP, backup.PassphraseKey("correct horse"))
+	err := a.Archive(context.Background(), t.TempDir(), filepath.Join(t.TempDir(), "1.snap.enc"))
+	require.EqualError(t, err, ".snap archives can not be encrypted")
+}
+
+func TestEncryptedIterationLimit(t *testing.T) {
+	a := backup.NewEncrypted(backup.ZIP, backup.PassphraseKey("correct horse"))
+	_, archive := archiveEncrypted(t, a)
+	data, err := ioutil.ReadFile(archive)
+	require.NoError(t, err)
+
+	// the header is prefixed with its length, after the magic
+	start := len("BKENC1\n")
+	size := binary.BigEndian.Uint32(data[start:])
+	header := bytes.Replace(data[start+4:start+4+int(size)], []byte(`"iter":200000`), []byte(`"iter":2000000000`), 1)
+	var crafted bytes.Buffer
+	crafted.Write(data[:start])
+	binary.Write(&crafted, binary.BigEndian, uint32(len(header)))
+	crafted.Write(header)
+	crafted.Write(data[start+4+int(size):])
+	require.NoError(t, ioutil.WriteFile(archive, crafted.Bytes(), 0644))
+	require.ErrorIs(t, a.Restore(archive, t.TempDir()), backup.ErrTampered)
+}
@@ -0,0 +1,28 @@
+//go:build linux
+// +build linux
+
+package backup
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID returns the inode and the status change time of the file,
+// which together with the size and mtime tell whether a cached
+// content digest is still valid.
+func fileID(info os.FileInfo) (ino uint64, ctime int64) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Ino, st.Ctim.Nano()
+	}
+	return 0, 0
+}
+
+// hardLinkID identifies the file by device and inode if it has more
+// than one hard link.
+func hardLinkID(info os.FileInfo) (id [2]uint64, ok bool) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && st.Nlink > 1 {
+		return [2]uint64{uint64(st.Dev), st.Ino}, true
+	}
+	return id, false
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package backup
+
+import "os"
+
+// fileID is not available on this platform, cached digests are
+// validated by size and mtime only.
+func fileID(info os.FileInfo) (ino uint64, ctime int64) {
+	return 0, 0
+}
+
+// hardLinkID is not available on this platform, hard links are
+// archived as separate files.
+func hardLinkID(info os.FileInfo) (id [2]uint64, ok bool) {
+	return id, false
+}
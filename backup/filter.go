@@ -0,0 +1,190 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile is the name of the files listing, like .gitignore,
+// patterns of files that are not backed up. Patterns are relative to
+// the directory containing the file.
+const IgnoreFile = ".backupignore"
+
+// Filter holds the include and exclude rules of a watched path.
+// Patterns without a slash match the name of a file or directory at
+// any depth, others match the slash separated path relative to the
+// watched path. A trailing slash restricts a pattern to directories.
+// If Include is not empty, only files matching one of its patterns
+// are backed up. Exclude and IgnoreFile patterns starting with "!"
+// re-include what an earlier pattern excluded.
+type Filter struct {
+	Include []string `json:",omitempty"`
+	Exclude []string `json:",omitempty"`
+}
+
+type filterKey struct{}
+
+// WithFilter returns a context under which the Archivers leave out
+// the files excluded by f, as the Hashers do when given f. IgnoreFile
+// files are honoured with or without a Filter.
+func WithFilter(ctx context.Context, f *Filter) context.Context {
+	return context.WithValue(ctx, filterKey{}, f)
+}
+
+// filterOf returns the Filter of ctx, nil if there is none.
+func filterOf(ctx context.Context) *Filter {
+	f, _ := ctx.Value(filterKey{}).(*Filter)
+	return f
+}
+
+type rule struct {
+	pattern  string
+	base     string // directory of the IgnoreFile, relative to the root
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+func parseRule(pattern, base string) (rule, bool) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return rule{}, false
+	}
+	r := rule{base: base}
+	if strings.HasPrefix(pattern, "!") {
+		r.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		r.dirOnly = true
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	if strings.Contains(pattern, "/") {
+		r.anchored = true
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+	r.pattern = pattern
+	return r, pattern != ""
+}
+
+func (r rule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "." {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = rel[len(r.base)+1:]
+	}
+	if !r.anchored {
+		ok, _ := path.Match(r.pattern, path.Base(rel))
+		return ok
+	}
+	ok, _ := path.Match(r.pattern, rel)
+	return ok
+}
+
+// matcher evaluates the rules of a single walk of a watched path.
+type matcher struct {
+	root    string
+	include []rule
+	exclude []rule
+	ignores map[string][]rule // IgnoreFile rules by directory
+}
+
+func newMatcher(root string, f *Filter) *matcher {
+	m := &matcher{root: root, ignores: make(map[string][]rule)}
+	if f != nil {
+		for _, p := range f.Include {
+			if r, ok := parseRule(p, "."); ok {
+				m.include = append(m.include, r)
+			}
+		}
+		for _, p := range f.Exclude {
+			if r, ok := parseRule(p, "."); ok {
+				m.exclude = append(m.exclude, r)
+			}
+		}
+	}
+	return m
+}
+
+// ignoreRules returns the rules of the IgnoreFile in dir, which is
+// relative to the root.
+func (m *matcher) ignoreRules(dir string) []rule {
+	if rules, ok := m.ignores[dir]; ok {
+		return rules
+	}
+	var rules []rule
+	if f, err := os.Open(filepath.Join(m.root, filepath.FromSlash(dir), IgnoreFile)); err == nil {
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			if r, ok := parseRule(s.Text(), dir); ok {
+				rules = append(rules, r)
+			}
+		}
+		f.Close()
+	}
+	m.ignores[dir] = rules
+	return rules
+}
+
+// skip reports whether the entry at the slash separated relative
+// path is left out of the backup.
+func (m *matcher) skip(rel string, isDir bool) bool {
+	excluded := false
+	for _, r := range m.exclude {
+		if r.match(rel, isDir) {
+			excluded = !r.negate
+		}
+	}
+	// IgnoreFile rules of the ancestors, outermost first
+	dirs := []string{"."}
+	for i, c := range rel {
+		if c == '/' {
+			dirs = append(dirs, rel[:i])
+		}
+	}
+	for _, dir := range dirs {
+		for _, r := range m.ignoreRules(dir) {
+			if r.match(rel, isDir) {
+				excluded = !r.negate
+			}
+		}
+	}
+	if excluded || isDir || len(m.include) == 0 {
+		return excluded
+	}
+	for _, r := range m.include {
+		if r.match(rel, isDir) {
+			return false
+		}
+	}
+	return true
+}
+
+// walkTree is like filepath.Walk, but leaves out the files excluded
+// by f, which may be nil, and by the IgnoreFile files in root.
+func walkTree(root string, f *Filter, fn filepath.WalkFunc) error {
+	m := newMatcher(root, f)
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err == nil && p != root {
+			rel, relErr := filepath.Rel(root, p)
+			if relErr != nil {
+				return relErr
+			}
+			if m.skip(filepath.ToSlash(rel), info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		return fn(p, info, err)
+	})
+}
@@ -0,0 +1,118 @@
+package backup_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/bukodi/go-playground/backup"
+	"github.com/stretchr/testify/require"
+)
+
+func restoredFiles(t *testing.T, dir string) []string {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	require.NoError(t, err)
+	sort.Strings(files)
+	return files
+}
+
+func TestFilter(t *testing.T) {
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "main.go"), "package main")
+	writeTestFile(t, filepath.Join(src, "node_modules", "lib", "index.js"), "js")
+	writeTestFile(t, filepath.Join(src, ".git", "HEAD"), "ref")
+	writeTestFile(t, filepath.Join(src, "build", "out.o"), "obj")
+	writeTestFile(t, filepath.Join(src, "docs", "build", "index.md"), "docs")
+	writeTestFile(t, filepath.Join(src, "logs", backup.IgnoreFile), "# logs\n*.log\n!keep.log\n")
+	writeTestFile(t, filepath.Join(src, "logs", "debug.log"), "debug")
+	writeTestFile(t, filepath.Join(src, "logs", "keep.log"), "keep")
+	f := &backup.Filter{Exclude: []string{"node_modules", ".git/", "/build"}}
+	ctx := backup.WithFilter(context.Background(), f)
+
+	expected := []string{"docs/build/index.md", "logs/.backupignore", "logs/keep.log", "main.go"}
+	for name, a := range backup.Archivers {
+		t.Run(name, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "src", "1"+a.DestFmt()[2:])
+			require.NoError(t, a.Archive(ctx, src, archive))
+			dest := t.TempDir()
+			require.NoError(t, a.Restore(archive, dest))
+			require.Equal(t, expected, restoredFiles(t, dest))
+		})
+	}
+
+	hash, err := backup.DirHash(src, f)
+	require.NoError(t, err)
+	h := backup.NewContentHasher()
+	content, err := h.Hash(src, f)
+	require.NoError(t, err)
+	writeTestFile(t, filepath.Join(src, "node_modules", "new.js"), "js")
+	writeTestFile(t, filepath.Join(src, "logs", "other.log"), "log")
+	newHash, err := backup.DirHash(src, f)
+	require.NoError(t, err)
+	require.Equal(t, hash, newHash, "excluded files do not change the hash")
+	newContent, err := h.Hash(src, f)
+	require.NoError(t, err)
+	require.Equal(t, content, newContent)
+
+	writeTestFile(t, filepath.Join(src, "docs", "new.md"), "docs")
+	newHash, err = backup.DirHash(src, f)
+	require.NoError(t, err)
+	require.NotEqual(t, hash, newHash)
+}
+
+func TestFilterInclude(t *testing.T) {
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "main.go"), "package main")
+	writeTestFile(t, filepath.Join(src, "README.md"), "readme")
+	writeTestFile(t, filepath.Join(src, "pkg", "lib.go"), "package pkg")
+	writeTestFile(t, filepath.Join(src, "vendor", "dep.go"), "package dep")
+	ctx := backup.WithFilter(context.Background(), &backup.Filter{Include: []string{"*.go"}, Exclude: []string{"vendor"}})
+
+	archive := filepath.Join(t.TempDir(), "1.zip")
+	require.NoError(t, backup.ZIP.Archive(ctx, src, archive))
+	dest := t.TempDir()
+	require.NoError(t, backup.ZIP.Restore(archive, dest))
+	require.Equal(t, []string{"main.go", "pkg/lib.go"}, restoredFiles(t, dest))
+}
+
+func TestMonitorFilters(t *testing.T) {
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "main.go"), "package main")
+	writeTestFile(t, filepath.Join(src, "debug.log"), "debug")
+
+	// the rules are those of each Monitor, not of the process
+	for _, tc := range []struct {
+		name     string
+		filter   *backup.Filter
+		expected []string
+	}{
+		{"no logs", &backup.Filter{Exclude: []string{"*.log"}}, []string{"main.go"}},
+		{"only logs", &backup.Filter{Include: []string{"*.log"}}, []string{"debug.log"}},
+		{"none", nil, []string{"debug.log", "main.go"}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			m := &backup.Monitor{Destination: t.TempDir(), Archiver: backup.ZIP}
+			m.AddPath(src, "")
+			m.SetFilter(src, tc.filter)
+			_, err := m.Now(context.Background())
+			require.NoError(t, err)
+			snaps, err := backup.Snapshots(m.Destination, src)
+			require.NoError(t, err)
+			require.Len(t, snaps, 1)
+			dest := t.TempDir()
+			require.NoError(t, backup.RestoreSnapshot(snaps[0].File, dest))
+			require.Equal(t, tc.expected, restoredFiles(t, dest))
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package backup
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fullsailor/pkcs7"
+)
+
+// ManifestExt is appended to the name of an archive to get the name
+// of its manifest.
+const ManifestExt = ".manifest"
+
+// Manifest lists the digests of an archive and of the files archived
+// in it, so the archive can be checked later by Verify.
+type Manifest struct {
+	Archive string    `json:"archive"` // base name of the archive file
+	Source  string    `json:"source"`
+	Created time.Time `json:"created"`
+	Size    int64     `json:"size"`
+	SHA256  string    `json:"sha256"`
+	// Files maps the slash separated relative path of every regular
+	// file to the SHA-256 digest of its content.
+	Files map[string]string `json:"files"`
+}
+
+// ManifestSigner signs manifests with PKCS#7. Only RSA keys are
+// supported.
+type ManifestSigner struct {
+	Cert *x509.Certificate
+	Key  crypto.PrivateKey
+}
+
+// LoadManifestSigner reads the PEM encoded certificate and private
+// key of a ManifestSigner. It returns nil if certFile is empty.
+func LoadManifestSigner(certFile, keyFile string) (*ManifestSigner, error) {
+	if certFile == "" {
+		return nil, nil
+	}
+	block, err := readPEM(certFile)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if block, err = readPEM(keyFile); err != nil {
+		return nil, err
+	}
+	key, err := parsePrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := key.(*rsa.PrivateKey); !ok {
+		return nil, fmt.Errorf("%s: only RSA keys can sign manifests", keyFile)
+	}
+	return &ManifestSigner{Cert: cert, Key: key}, nil
+}
+
+func (s *ManifestSigner) sign(data []byte) ([]byte, error) {
+	signed, err := pkcs7.NewSignedData(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := signed.AddSigner(s.Cert, s.Key, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, err
+	}
+	der, err := signed.Finish()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: der}), nil
+}
+
+// WriteManifest writes the manifest of the archive file created from
+// src next to it, signed if signer is not nil. files are the digests
+// of the archived files, as recorded while archiving.
+func WriteManifest(src, file string, files map[string]string, signer *ManifestSigner) error {
+	m := &Manifest{Archive: filepath.Base(file), Source: src, Created: time.Now(), Files: files}
+	var err error
+	if m.Size, m.SHA256, err = fileDigest(file); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if signer != nil {
+		if data, err = signer.sign(data); err != nil {
+			return fmt.Errorf("failed to sign manifest: %w", err)
+		}
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+ManifestExt+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), file+ManifestExt)
+}
+
+func fileDigest(file string) (int64, string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// archiveSums collects the digests of the files an Archiver archives
+// as it reads them, so the manifest describes the archive even if the
+// source changed since.
+type archiveSums struct {
+	mu   sync.Mutex
+	sums map[string]string
+}
+
+type archiveSumsKey struct{}
+
+// withArchiveSums returns a context under which the archivers record
+// the digests of the files they archive into the returned archiveSums.
+func withArchiveSums(ctx context.Context) (context.Context, *archiveSums) {
+	s := &archiveSums{sums: make(map[string]string)}
+	return context.WithValue(ctx, archiveSumsKey{}, s), s
+}
+
+// archiveSumsOf returns the archiveSums of ctx, nil if there is none.
+func archiveSumsOf(ctx context.Context) *archiveSums {
+	s, _ := ctx.Value(archiveSumsKey{}).(*archiveSums)
+	return s
+}
+
+// set records the digest of the file archived as name. Nothing is
+// recorded without withArchiveSums.
+func (s *archiveSums) set(name, sum string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sums[name] = sum
+}
+
+func (s *archiveSums) get(name string) string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sums[name]
+}
+
+// files returns a copy of the digests recorded.
+func (s *archiveSums) files() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := make(map[string]string, len(s.sums))
+	for name, sum := range s.sums {
+		files[name] = sum
+	}
+	return files
+}
+
+// archivedReader reads the content of the file archived as name,
+// failing once ctx is done, and hashes it on the way.
+type archivedReader struct {
+	contextReader
+	name string
+	sums *archiveSums
+	hash hash.Hash
+}
+
+func newArchivedReader(ctx context.Context, name string, r io.Reader) *archivedReader {
+	return &archivedReader{contextReader: contextReader{ctx, r}, name: name, sums: archiveSumsOf(ctx), hash: sha256.New()}
+}
+
+func (r *archivedReader) Read(p []byte) (int, error) {
+	n, err := r.contextReader.Read(p)
+	r.hash.Write(p[:n])
+	return n, err
+}
+
+// sum returns the digest of what was read.
+func (r *archivedReader) sum() string {
+	return fmt.Sprintf("%x", r.hash.Sum(nil))
+}
+
+// archived records the digest of what was read, once it is archived.
+func (r *archivedReader) archived() {
+	r.sums.set(r.name, r.sum())
+}
+
+// ReadManifest reads the manifest of the archive file. If it is
+// signed, the signature is checked and the signing certificate is
+// returned; it must chain to one of roots, unless roots is nil.
+func ReadManifest(file string, roots *x509.CertPool) (*Manifest, *x509.Certificate, error) {
+	data, err := ioutil.ReadFile(file + ManifestExt)
+	if err != nil {
+		return nil, nil, err
+	}
+	var signer *x509.Certificate
+	if block, _ := pem.Decode(data); block != nil && block.Type == "PKCS7" {
+		p7, err := pkcs7.Parse(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid manifest signature: %w", err)
+		}
+		if err := p7.Verify(); err != nil {
+			return nil, nil, fmt.Errorf("invalid manifest signature: %w", err)
+		}
+		if signer = p7.GetOnlySigner(); signer == nil {
+			return nil, nil, errors.New("manifest must have a single signer")
+		}
+		if roots != nil {
+			intermediates := x509.NewCertPool()
+			for _, c := range p7.Certificates {
+				intermediates.AddCert(c)
+			}
+			_, err := signer.Verify(x509.VerifyOptions{
+				Roots:         roots,
+				Intermediates: intermediates,
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("untrusted manifest signer %s: %w", signer.Subject, err)
+			}
+		}
+		data = p7.Content
+	} else if roots != nil {
+		return nil, nil, errors.New("manifest is not signed")
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return &m, signer, nil
+}
+
+// Verification is the result of verifying an archive.
+type Verification struct {
+	File     string
+	Signer   *x509.Certificate // nil if the manifest is not signed
+	Problems []string
+}
+
+// OK reports whether no problem was found.
+func (v *Verification) OK() bool {
+	return len(v.Problems) == 0
+}
+
+func (v *Verification) problem(format string, args ...interface{}) {
+	v.Problems = append(v.Problems, fmt.Sprintf(format, args...))
+}
+
+// Verify checks the archive file against its manifest. Signed
+// manifests must chain to one of roots, and if roots is not nil
+// unsigned manifests are rejected. Unless quick is set, the archive
+// is restored into a temporary directory and the digests of the
+// restored files are compared too, which also reads the chunks of
+// DEDUP snapshots and authenticates encrypted archives.
+func Verify(file string, roots *x509.CertPool, quick bool) *Verification {
+	v := &Verification{File: file}
+	m, signer, err := ReadManifest(file, roots)
+	if os.IsNotExist(err) {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			v.problem("archive and manifest are missing")
+		} else {
+			v.problem("manifest is missing")
+		}
+		return v
+	}
+	if err != nil {
+		v.problem("%v", err)
+		return v
+	}
+	v.Signer = signer
+	if m.Archive != filepath.Base(file) {
+		v.problem("manifest is of another archive: %s", m.Archive)
+	}
+	size, sum, err := fileDigest(file)
+	switch {
+	case os.IsNotExist(err):
+		v.problem("archive is missing")
+		return v
+	case err != nil:
+		v.problem("%v", err)
+		return v
+	case size != m.Size || sum != m.SHA256:
+		v.problem("archive is corrupted: SHA-256 %s, expected %s", sum, m.SHA256)
+		return v
+	}
+	if quick {
+		return v
+	}
+	tmp, err := ioutil.TempDir("", "backup-verify")
+	if err != nil {
+		v.problem("%v", err)
+		return v
+	}
+	defer os.RemoveAll(tmp)
+	if err := RestoreSnapshot(file, tmp); err != nil {
+		v.problem("cannot restore: %v", err)
+		return v
+	}
+	restored, err := fileSums(tmp)
+	if err != nil {
+		v.problem("%v", err)
+		return v
+	}
+	names := make([]string, 0, len(m.Files))
+	for name := range m.Files {
+		names = append(names, name)
+	}
+	for name := range restored {
+		if _, ok := m.Files[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sum, ok := restored[name]
+		want, listed := m.Files[name]
+		switch {
+		case !listed:
+			v.problem("%s is not in the manifest", name)
+		case !ok:
+			v.problem("%s is missing", name)
+		case sum != want:
+			v.problem("%s is corrupted", name)
+		}
+	}
+	return v
+}
+
+// VerifyPath verifies every archive of the watched path stored under
+// destination and reports manifests left without their archive.
+func VerifyPath(destination, path string, roots *x509.CertPool, quick bool) ([]*Verification, error) {
+	snaps, err := Snapshots(destination, path)
+	if err != nil {
+		return nil, err
+	}
+	var results []*Verification
+	archives := make(map[string]bool)
+	for _, snap := range snaps {
+		archives[snap.File] = true
+		results = append(results, Verify(snap.File, roots, quick))
+	}
+	manifests, err := filepath.Glob(filepath.Join(ArchiveDir(destination, path), "*"+ManifestExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, manifest := range manifests {
+		if file := strings.TrimSuffix(manifest, ManifestExt); !archives[file] {
+			results = append(results, Verify(file, roots, quick))
+		}
+	}
+	return results, nil
+}
+
+// removeArchive deletes the archive file and its manifest.
+func removeArchive(file string) error {
+	if err := os.Remove(file); err != nil {
+		return err
+	}
+	if err := os.Remove(file + ManifestExt); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
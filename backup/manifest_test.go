@@ -0,0 +1,194 @@
+package backup_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bukodi/go-playground/backup"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSigner(t *testing.T, serial int64) *backup.ManifestSigner {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return &backup.ManifestSigner{Cert: createTestCert(t, serial, priv), Key: priv}
+}
+
+func archiveWithManifest(t *testing.T, a backup.Archiver, signer *backup.ManifestSigner) (*backup.Monitor, string) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "alpha")
+	writeTestFile(t, filepath.Join(src, "sub", "b.txt"), "beta")
+	m := &backup.Monitor{
+		Destination: t.TempDir(),
+		Archiver:    a,
+		Paths:       map[string]string{src: ""},
+		Signer:      signer,
+	}
+	_, err := m.Now(context.Background())
+	require.NoError(t, err)
+	return m, src
+}
+
+func problems(t *testing.T, results []*backup.Verification) []string {
+	var all []string
+	for _, v := range results {
+		all = append(all, v.Problems...)
+	}
+	return all
+}
+
+func TestSignedManifest(t *testing.T) {
+	signer := newTestSigner(t, 1)
+	m, src := archiveWithManifest(t, backup.ZIP, signer)
+	snaps, err := backup.Snapshots(m.Destination, src)
+	require.NoError(t, err)
+	require.Len(t, snaps, 1)
+	file := snaps[0].File
+
+	manifest, cert, err := backup.ReadManifest(file, nil)
+	require.NoError(t, err)
+	require.Equal(t, signer.Cert.Raw, cert.Raw)
+	require.Len(t, manifest.Files, 2)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(signer.Cert)
+	v := backup.Verify(file, roots, false)
+	require.True(t, v.OK(), "%v", v.Problems)
+	require.NotNil(t, v.Signer)
+
+	// signed by someone else
+	other := x509.NewCertPool()
+	other.AddCert(newTestSigner(t, 2).Cert)
+	v = backup.Verify(file, other, true)
+	require.False(t, v.OK())
+	require.Contains(t, v.Problems[0], "untrusted")
+
+	// a modified manifest no longer matches its signature
+	data, err := ioutil.ReadFile(file + backup.ManifestExt)
+	require.NoError(t, err)
+	data[len(data)/2] ^= 1
+	require.NoError(t, ioutil.WriteFile(file+backup.ManifestExt, data, 0644))
+	require.False(t, backup.Verify(file, nil, true).OK())
+}
+
+func TestUnsignedManifest(t *testing.T) {
+	m, src := archiveWithManifest(t, backup.TarGz, nil)
+	results, err := backup.VerifyPath(m.Destination, src, nil, false)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.True(t, results[0].OK(), "%v", results[0].Problems)
+	require.Nil(t, results[0].Signer)
+
+	roots := x509.NewCertPool()
+	results, err = backup.VerifyPath(m.Destination, src, roots, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"manifest is not signed"}, problems(t, results))
+}
+
+func TestVerifyFindsDamage(t *testing.T) {
+	m, src := archiveWithManifest(t, backup.ZIP, nil)
+	snaps, err := backup.Snapshots(m.Destination, src)
+	require.NoError(t, err)
+	file := snaps[0].File
+
+	data, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	data[len(data)-30] ^= 0xff
+	require.NoError(t, ioutil.WriteFile(file, data, 0644))
+	results, err := backup.VerifyPath(m.Destination, src, nil, true)
+	require.NoError(t, err)
+	require.Len(t, problems(t, results), 1)
+	require.Contains(t, problems(t, results)[0], "archive is corrupted")
+
+	require.NoError(t, os.Remove(file))
+	results, err = backup.VerifyPath(m.Destination, src, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"archive is missing"}, problems(t, results))
+}
+
+func TestVerifyFindsInjectedFiles(t *testing.T) {
+	m, src := archiveWithManifest(t, backup.ZIP, nil)
+	snaps, err := backup.Snapshots(m.Destination, src)
+	require.NoError(t, err)
+	file := snaps[0].File
+
+	// the archive holds a file the manifest does not list
+	manifest, _, err := backup.ReadManifest(file, nil)
+	require.NoError(t, err)
+	delete(manifest.Files, "sub/b.txt")
+	data, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(file+backup.ManifestExt, data, 0644))
+	v := backup.Verify(file, nil, false)
+	require.Equal(t, []string{"sub/b.txt is not in the manifest"}, v.Problems)
+}
+
+func TestVerifyDedupChunks(t *testing.T) {
+	m, src := archiveWithManifest(t, backup.DEDUP, nil)
+	results, err := backup.VerifyPath(m.Destination, src, nil, false)
+	require.NoError(t, err)
+	require.Empty(t, problems(t, results))
+
+	// the manifest of a DEDUP snapshot only covers the file list, the
+	// chunks are checked by restoring
+	chunks, err := filepath.Glob(filepath.Join(m.Destination, backup.ChunkDir, "*", "*"))
+	require.NoError(t, err)
+	require.NotEmpty(t, chunks)
+	require.NoError(t, ioutil.WriteFile(chunks[0], []byte("rotten"), 0644))
+	results, err = backup.VerifyPath(m.Destination, src, nil, true)
+	require.NoError(t, err)
+	require.Empty(t, problems(t, results))
+	results, err = backup.VerifyPath(m.Destination, src, nil, false)
+	require.NoError(t, err)
+	require.Len(t, problems(t, results), 1)
+	require.True(t, strings.HasPrefix(problems(t, results)[0], "cannot restore"), problems(t, results)[0])
+}
+
+// editingArchiver changes the source right after archiving it.
+type editingArchiver struct {
+	backup.Archiver
+}
+
+func (a editingArchiver) Archive(ctx context.Context, src, dest string) error {
+	if err := a.Archiver.Archive(ctx, src, dest); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(src, "a.txt"), []byte("edited"), 0644)
+}
+
+func TestManifestDescribesArchive(t *testing.T) {
+	backup.RegisterEncrypted(backup.PassphraseKey("correct horse"))
+	defer func() {
+		for name := range backup.Archivers {
+			if strings.HasSuffix(name, "+enc") {
+				delete(backup.Archivers, name)
+			}
+		}
+	}()
+	for name, a := range map[string]backup.Archiver{
+		"zip":   backup.ZIP,
+		"targz": backup.TarGz,
+		"dedup": backup.DEDUP,
+		"enc":   backup.Archivers["zip+enc"],
+	} {
+		t.Run(name, func(t *testing.T) {
+			m, src := archiveWithManifest(t, editingArchiver{a}, nil)
+			snaps, err := backup.Snapshots(m.Destination, src)
+			require.NoError(t, err)
+			require.Len(t, snaps, 1)
+			manifest, _, err := backup.ReadManifest(snaps[0].File, nil)
+			require.NoError(t, err)
+			require.Len(t, manifest.Files, 2)
+			v := backup.Verify(snaps[0].File, nil, false)
+			require.True(t, v.OK(), "%v", v.Problems)
+		})
+	}
+}
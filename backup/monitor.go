@@ -1,42 +1,268 @@
 package backup
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/bukodi/go-playground/errorsandlogs"
 )
 
 // Monitor checks paths and archives any that
-// have changed.
+// have changed. Paths must not be modified directly
+// while the Monitor is in use, see AddPath.
 type Monitor struct {
 	Paths       map[string]string
 	Archiver    Archiver
 	Destination string
+	// Hasher calculates the directory hashes, DirHash is used if nil.
+	Hasher Hasher
+	// Storage, if set, receives a copy of every archive once it has
+	// been written to Destination.
+	Storage Storage
+	// Signer, if set, signs the manifest written next to every
+	// archive.
+	Signer *ManifestSigner
+	// Changed holds the files that changed in each path archived by
+	// the last call to Now, if the Hasher is a ChangeReporter.
+	Changed map[string][]Change
+
+	mu      sync.Mutex // guards status, Paths and filters
+	status  map[string]*PathStatus
+	filters map[string]*Filter
+}
+
+func (m *Monitor) hash(path string) (string, error) {
+	if m.Hasher == nil {
+		return DirHash(path, m.FilterOf(path))
+	}
+	return m.Hasher.Hash(path, m.FilterOf(path))
 }
 
 // Now checks all directories in Paths with the latest hash.
 // Archive will be called for any paths whose hashes do not match.
-func (m *Monitor) Now() (int, error) {
+func (m *Monitor) Now(ctx context.Context) (int, error) {
+	return m.Check(ctx, m.PathList()...)
+}
+
+// PathList returns the watched paths.
+func (m *Monitor) PathList() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	paths := make([]string, 0, len(m.Paths))
+	for path := range m.Paths {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// Hashes returns a copy of the hashes of the watched paths.
+func (m *Monitor) Hashes() map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hashes := make(map[string]string, len(m.Paths))
+	for path, hash := range m.Paths {
+		hashes[path] = hash
+	}
+	return hashes
+}
+
+// AddPath starts watching the path, which was last archived with
+// the given hash. It is safe to call while the Monitor is checking.
+func (m *Monitor) AddPath(path, hash string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Paths == nil {
+		m.Paths = make(map[string]string)
+	}
+	m.Paths[path] = hash
+}
+
+// RemovePath stops watching the path and forgets its Filter. It is
+// safe to call while the Monitor is checking.
+func (m *Monitor) RemovePath(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.Paths, path)
+	delete(m.status, path)
+	delete(m.filters, path)
+}
+
+// SetFilter sets the include and exclude rules the path is hashed and
+// archived with from the next check on; nil removes them. It is safe
+// to call while the Monitor is checking.
+func (m *Monitor) SetFilter(path string, f *Filter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f == nil {
+		delete(m.filters, path)
+		return
+	}
+	if m.filters == nil {
+		m.filters = make(map[string]*Filter)
+	}
+	m.filters[path] = f
+}
+
+// FilterOf returns the rules of the path, nil if it has none.
+func (m *Monitor) FilterOf(path string) *Filter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.filters[path]
+}
+
+func (m *Monitor) lastHash(path string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hash, ok := m.Paths[path]
+	if !ok || m.statusOf(path).Paused {
+		return "", false
+	}
+	return hash, true
+}
+
+// Check is like Now, but only checks the given paths of Paths.
+// Paused paths are skipped. A path that fails does not stop the
+// others from being checked; the failures are returned together as
+// an errorsandlogs.MultiErr. Once ctx is done no further path is
+// checked and an archive being written is abandoned.
+func (m *Monitor) Check(ctx context.Context, paths ...string) (int, error) {
 	var counter int
-	for path, lastHash := range m.Paths {
-		newHash, err := DirHash(path)
+	errs := errorsandlogs.NewMultiErr()
+	m.Changed = make(map[string][]Change)
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			errs.Append(err)
+			break
+		}
+		lastHash, ok := m.lastHash(path)
+		if !ok {
+			continue
+		}
+		newHash, err := m.hash(path)
 		if err != nil {
-			return 0, err
+			m.recordCheck(path, "", err)
+			errs.Append(fmt.Errorf("%s: %w", path, err))
+			continue
 		}
-		if newHash != lastHash {
-			err := m.act(path)
-			if err != nil {
-				return counter, err
-			}
+		if newHash == lastHash {
+			m.recordCheck(path, "", nil)
+			continue
+		}
+		if r, ok := m.Hasher.(ChangeReporter); ok {
+			m.Changed[path] = r.Changes(path)
+		}
+		file, err := m.act(ctx, path)
+		m.recordCheck(path, file, err)
+		if err != nil {
+			errs.Append(fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		m.mu.Lock()
+		if _, ok := m.Paths[path]; ok { // unless removed meanwhile
 			m.Paths[path] = newHash // update the hash
-			counter++
 		}
+		m.mu.Unlock()
+		counter++
 	}
-	return counter, nil
+	return counter, errs.Reduce()
 }
 
-func (m *Monitor) act(path string) error {
-	dirname := filepath.Base(path)
+func (m *Monitor) act(ctx context.Context, path string) (string, error) {
 	filename := fmt.Sprintf(m.Archiver.DestFmt(), time.Now().UnixNano())
-	return m.Archiver.Archive(path, filepath.Join(m.Destination, dirname, filename))
+	dest := filepath.Join(ArchiveDir(m.Destination, path), filename)
+	ctx, sums := withArchiveSums(WithFilter(ctx, m.FilterOf(path)))
+	if err := writeArchive(ctx, m.Archiver, path, dest); err != nil {
+		return "", err
+	}
+	if err := WriteManifest(path, dest, sums.files(), m.Signer); err != nil {
+		return "", fmt.Errorf("failed to write manifest of %s: %w", dest, err)
+	}
+	if m.Storage == nil {
+		return dest, nil
+	}
+	if err := Upload(m.Storage, m.Destination, dest); err != nil {
+		return "", fmt.Errorf("failed to upload %s: %w", dest, err)
+	}
+	return dest, nil
+}
+
+// TempGrace is how old a temporary archive must be for writeArchive
+// to take it for the leftover of a crash. Younger ones may still be
+// written by another Monitor or backup process.
+var TempGrace = 24 * time.Hour
+
+// writeArchive archives src into a temporary file next to dest and
+// renames it to dest once it is complete and synced, so dest never
+// holds a partial archive, not even after a crash. Temporary archives
+// left behind by an earlier crash are removed.
+func writeArchive(ctx context.Context, a Archiver, src, dest string) error {
+	dir := filepath.Dir(dest)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	removeStaleTemps(dir, a.DestFmt())
+	tmp, err := ioutil.TempFile(dir, filepath.Base(dest)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	if err := a.Archive(ctx, src, tmp.Name()); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := syncFile(tmp.Name()); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// removeStaleTemps removes the temporary archives of writeArchive in
+// dir older than TempGrace. Other temporary files, such as those of
+// manifests, are left to whoever writes them.
+func removeStaleTemps(dir, destFmt string) {
+	entries, _ := ioutil.ReadDir(dir)
+	for _, info := range entries {
+		if info.Mode().IsRegular() && isArchiveTemp(info.Name(), destFmt) &&
+			time.Since(info.ModTime()) >= TempGrace {
+			os.Remove(filepath.Join(dir, info.Name()))
+		}
+	}
+}
+
+// isArchiveTemp tells if name is that of a temporary file of
+// writeArchive: an archive name of destFmt, ".tmp" and the random
+// digits of ioutil.TempFile.
+func isArchiveTemp(name, destFmt string) bool {
+	i := strings.LastIndex(name, ".tmp")
+	if i < 0 {
+		return false
+	}
+	suffix := name[i+len(".tmp"):]
+	if suffix == "" || strings.Trim(suffix, "0123456789") != "" {
+		return false
+	}
+	var n int64
+	if _, err := fmt.Sscanf(name[:i], destFmt, &n); err != nil {
+		return false
+	}
+	return fmt.Sprintf(destFmt, n) == name[:i]
+}
+
+func syncFile(name string) error {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
@@ -1,10 +1,16 @@
 package backup_test
 
 import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
-	"github.com/bukodi/go-playgroud/backup"
+	"github.com/bukodi/go-playground/backup"
 	"github.com/stretchr/testify/require"
 )
 
@@ -12,7 +18,7 @@ func TestMonitor(t *testing.T) {
 
 	a := &TestArchiver{}
 	m := &backup.Monitor{
-		Destination: "test/archive",
+		Destination: t.TempDir(),
 		Paths: map[string]string{
 			"test/hash1": "abc",
 			"test/hash2": "def",
@@ -20,14 +26,127 @@ func TestMonitor(t *testing.T) {
 		Archiver: a,
 	}
 
-	n, err := m.Now()
+	n, err := m.Now(context.Background())
 	require.NoError(t, err)
 	require.Equal(t, 2, n)
 
 	require.Equal(t, 2, len(a.Archives))
 	for _, call := range a.Archives {
 		require.True(t, strings.HasPrefix(call.Dest, m.Destination))
-		require.True(t, strings.HasSuffix(call.Dest, ".zip"))
+		snaps, err := backup.Snapshots(m.Destination, call.Src)
+		require.NoError(t, err)
+		require.Len(t, snaps, 1)
+		require.True(t, strings.HasSuffix(snaps[0].File, ".zip"))
+		require.Equal(t, filepath.Dir(call.Dest), filepath.Dir(snaps[0].File))
 	}
 
 }
+
+func TestMonitorAddRemovePath(t *testing.T) {
+	a := &TestArchiver{}
+	m := &backup.Monitor{Destination: t.TempDir(), Archiver: a}
+	m.AddPath("test/hash1", "abc")
+	m.AddPath("test/hash2", "def")
+	require.NoError(t, m.Pause("test/hash2"))
+	m.RemovePath("test/hash2")
+	require.Error(t, m.Pause("test/hash2"))
+	require.Equal(t, []string{"test/hash1"}, m.PathList())
+
+	n, err := m.Now(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Len(t, m.Status(), 1)
+	require.NotEqual(t, "abc", m.Hashes()["test/hash1"])
+}
+
+func TestMonitorFailingPath(t *testing.T) {
+	a := &TestArchiver{}
+	missing := filepath.Join(t.TempDir(), "missing")
+	m := &backup.Monitor{
+		Destination: t.TempDir(),
+		Paths: map[string]string{
+			missing:      "abc",
+			"test/hash1": "abc",
+		},
+		Archiver: a,
+	}
+	n, err := m.Now(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), missing)
+	require.Equal(t, 1, n, "the other path must still be archived")
+	require.Equal(t, "abc", m.Hashes()[missing])
+}
+
+// interruptedArchiver writes part of an archive and is then
+// interrupted, as by a shutdown.
+type interruptedArchiver struct {
+	TestArchiver
+	cancel context.CancelFunc
+}
+
+func (a *interruptedArchiver) Archive(ctx context.Context, src, dest string) error {
+	if err := ioutil.WriteFile(dest, []byte("PK partial"), 0666); err != nil {
+		return err
+	}
+	a.cancel()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestMonitorInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := &backup.Monitor{
+		Destination: t.TempDir(),
+		Paths: map[string]string{
+			"test/hash1": "abc",
+			"test/hash2": "def",
+		},
+		Archiver: &interruptedArchiver{cancel: cancel},
+	}
+	n, err := m.Now(ctx)
+	require.True(t, errors.Is(err, context.Canceled), "%v", err)
+	require.Equal(t, 0, n)
+	require.Equal(t, map[string]string{"test/hash1": "abc", "test/hash2": "def"}, m.Hashes())
+
+	// neither the partial archive nor its temporary file is left
+	var files []string
+	require.NoError(t, filepath.Walk(m.Destination, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	}))
+	require.Empty(t, files)
+}
+
+func TestMonitorRemovesOnlyStaleTemps(t *testing.T) {
+	m := &backup.Monitor{
+		Destination: t.TempDir(),
+		Paths:       map[string]string{"test/hash1": "abc"},
+		Archiver:    &TestArchiver{},
+	}
+	dir := backup.ArchiveDir(m.Destination, "test/hash1")
+	require.NoError(t, os.MkdirAll(dir, 0777))
+	old := time.Now().Add(-2 * backup.TempGrace)
+	files := map[string]bool{ // whether it is left
+		"1.zip.tmp123":          false, // crashed earlier
+		"2.zip.tmp456":          true,  // being written by another process
+		"3.zip.manifest.tmp789": true,  // not an archive
+		"4.zip.tmp1.part":       true,  // not of writeArchive
+		"5.tar.gz.tmp345":       true,  // of another archiver
+		"notes.tmp":             true,
+	}
+	for name := range files {
+		writeTestFile(t, filepath.Join(dir, name), "partial")
+		if name != "2.zip.tmp456" {
+			require.NoError(t, os.Chtimes(filepath.Join(dir, name), old, old))
+		}
+	}
+	_, err := m.Now(context.Background())
+	require.NoError(t, err)
+	for name, left := range files {
+		_, err := os.Stat(filepath.Join(dir, name))
+		require.Equal(t, left, err == nil, name)
+	}
+}
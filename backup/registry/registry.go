@@ -0,0 +1,216 @@
+// Package registry keeps the list of paths watched by backupd in a
+// SQLite database shared with the backup tool.
+package registry
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/bukodi/go-playground/backup"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SchemaVersion is the version of the database layout written by
+// this package. It is stored as the SQLite user_version.
+const SchemaVersion = 1
+
+// migrations[i] upgrades the schema from version i to i+1.
+var migrations = []string{
+	`CREATE TABLE paths (
+		path   TEXT PRIMARY KEY,
+		hash   TEXT NOT NULL DEFAULT '',
+		filter TEXT NOT NULL DEFAULT '{}'
+	);
+	CREATE TABLE generation (
+		id    INTEGER PRIMARY KEY CHECK (id = 0),
+		value INTEGER NOT NULL
+	);
+	INSERT INTO generation (id, value) VALUES (0, 0);`,
+}
+
+// ErrExists is returned by Add for paths already registered.
+var ErrExists = errors.New("path already registered")
+
+// Path is a watched path with the hash of its last archive.
+type Path struct {
+	Path string
+	Hash string
+	backup.Filter
+}
+
+// Registry is the database of the watched paths. Every change is a
+// transaction, so the backup tool and backupd can write it at the
+// same time.
+type Registry struct {
+	db *sql.DB
+}
+
+// Open opens the database file, creating it or upgrading its schema
+// if needed.
+func Open(file string) (*Registry, error) {
+	db, err := sql.Open("sqlite3", file+"?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	r := &Registry{db: db}
+	if err := r.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Registry) migrate() error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var version int
+	if err := tx.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("registry schema version %d is newer than the supported %d", version, SchemaVersion)
+	}
+	for ; version < SchemaVersion; version++ {
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			return fmt.Errorf("failed to upgrade registry schema to version %d: %w", version+1, err)
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Close closes the database.
+func (r *Registry) Close() error {
+	return r.db.Close()
+}
+
+// Version returns the schema version of the database.
+func (r *Registry) Version() (int, error) {
+	var version int
+	err := r.db.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// Generation returns a number that changes whenever a path is added
+// or removed or its rules change, so watchers can tell when to reload
+// the paths.
+func (r *Registry) Generation() (int64, error) {
+	var gen int64
+	err := r.db.QueryRow("SELECT value FROM generation").Scan(&gen)
+	return gen, err
+}
+
+// Paths returns every registered path, sorted.
+func (r *Registry) Paths() ([]Path, error) {
+	rows, err := r.db.Query("SELECT path, hash, filter FROM paths ORDER BY path")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var paths []Path
+	for rows.Next() {
+		var p Path
+		var filter string
+		if err := rows.Scan(&p.Path, &p.Hash, &filter); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(filter), &p.Filter); err != nil {
+			return nil, fmt.Errorf("invalid filter of %s: %w", p.Path, err)
+		}
+		paths = append(paths, p)
+	}
+	return paths, rows.Err()
+}
+
+// Add registers the path.
+func (r *Registry) Add(p Path) error {
+	filter, err := json.Marshal(&p.Filter)
+	if err != nil {
+		return err
+	}
+	return r.update(func(tx *sql.Tx) error {
+		var n int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM paths WHERE path = ?", p.Path).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("%s: %w", p.Path, ErrExists)
+		}
+		_, err := tx.Exec("INSERT INTO paths (path, hash, filter) VALUES (?, ?, ?)", p.Path, p.Hash, string(filter))
+		return err
+	}, true)
+}
+
+// SetFilter replaces the include and exclude rules of the path and
+// reports whether it is registered.
+func (r *Registry) SetFilter(path string, f backup.Filter) (bool, error) {
+	filter, err := json.Marshal(&f)
+	if err != nil {
+		return false, err
+	}
+	var updated bool
+	err = r.update(func(tx *sql.Tx) error {
+		res, err := tx.Exec("UPDATE paths SET filter = ? WHERE path = ?", string(filter), path)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		updated = n > 0
+		return err
+	}, true)
+	return updated, err
+}
+
+// Remove unregisters the path and reports whether it was registered.
+func (r *Registry) Remove(path string) (bool, error) {
+	var removed bool
+	err := r.update(func(tx *sql.Tx) error {
+		res, err := tx.Exec("DELETE FROM paths WHERE path = ?", path)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		removed = n > 0
+		return err
+	}, true)
+	return removed, err
+}
+
+// SetHashes records the hashes of the last archives of the paths.
+// Paths that are no longer registered are ignored.
+func (r *Registry) SetHashes(hashes map[string]string) error {
+	return r.update(func(tx *sql.Tx) error {
+		for path, hash := range hashes {
+			if _, err := tx.Exec("UPDATE paths SET hash = ? WHERE path = ?", hash, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, false)
+}
+
+// update runs fn in a transaction, bumping the generation if the set
+// of paths changes.
+func (r *Registry) update(fn func(tx *sql.Tx) error, pathsChange bool) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if pathsChange {
+		if _, err := tx.Exec("UPDATE generation SET value = value + 1"); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
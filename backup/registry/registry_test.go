@@ -0,0 +1,120 @@
+package registry_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/bukodi/go-playground/backup"
+	"github.com/bukodi/go-playground/backup/registry"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "backup.db")
+	reg, err := registry.Open(file)
+	require.NoError(t, err)
+	defer reg.Close()
+
+	version, err := reg.Version()
+	require.NoError(t, err)
+	require.Equal(t, registry.SchemaVersion, version)
+	gen, err := reg.Generation()
+	require.NoError(t, err)
+
+	filter := backup.Filter{Exclude: []string{"*.tmp"}}
+	require.NoError(t, reg.Add(registry.Path{Path: "/home/b", Filter: filter}))
+	require.NoError(t, reg.Add(registry.Path{Path: "/home/a", Hash: "h"}))
+	err = reg.Add(registry.Path{Path: "/home/a"})
+	require.True(t, errors.Is(err, registry.ErrExists), "%v", err)
+
+	paths, err := reg.Paths()
+	require.NoError(t, err)
+	require.Equal(t, []registry.Path{
+		{Path: "/home/a", Hash: "h"},
+		{Path: "/home/b", Filter: filter},
+	}, paths)
+	next, err := reg.Generation()
+	require.NoError(t, err)
+	require.NotEqual(t, gen, next, "adding paths must change the generation")
+
+	// hash updates do not make watchers reload
+	require.NoError(t, reg.SetHashes(map[string]string{"/home/b": "new", "/gone": "x"}))
+	gen, err = reg.Generation()
+	require.NoError(t, err)
+	require.Equal(t, next, gen)
+
+	removed, err := reg.Remove("/home/a")
+	require.NoError(t, err)
+	require.True(t, removed)
+	removed, err = reg.Remove("/home/a")
+	require.NoError(t, err)
+	require.False(t, removed)
+
+	// a second handle, as used by the other tool, sees the changes
+	other, err := registry.Open(file)
+	require.NoError(t, err)
+	defer other.Close()
+	paths, err = other.Paths()
+	require.NoError(t, err)
+	require.Equal(t, []registry.Path{{Path: "/home/b", Hash: "new", Filter: filter}}, paths)
+
+	// rule changes make watchers reload
+	filter = backup.Filter{Include: []string{"*.go"}}
+	updated, err := other.SetFilter("/home/b", filter)
+	require.NoError(t, err)
+	require.True(t, updated)
+	next, err = reg.Generation()
+	require.NoError(t, err)
+	require.NotEqual(t, gen, next, "changing rules must change the generation")
+	paths, err = reg.Paths()
+	require.NoError(t, err)
+	require.Equal(t, []registry.Path{{Path: "/home/b", Hash: "new", Filter: filter}}, paths)
+	updated, err = other.SetFilter("/home/a", filter)
+	require.NoError(t, err)
+	require.False(t, updated)
+}
+
+func TestRegistryConcurrentWriters(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "backup.db")
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for w := 0; w < 4; w++ {
+		reg, err := registry.Open(file)
+		require.NoError(t, err)
+		defer reg.Close()
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				errs <- reg.Add(registry.Path{Path: fmt.Sprintf("/p/%d/%d", w, i)})
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	reg, err := registry.Open(file)
+	require.NoError(t, err)
+	defer reg.Close()
+	paths, err := reg.Paths()
+	require.NoError(t, err)
+	require.Len(t, paths, 40)
+}
+
+func TestRegistryRejectsNewerSchema(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "backup.db")
+	db, err := sql.Open("sqlite3", file)
+	require.NoError(t, err)
+	_, err = db.Exec(fmt.Sprintf("PRAGMA user_version = %d", registry.SchemaVersion+1))
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	_, err = registry.Open(file)
+	require.Error(t, err)
+}
@@ -0,0 +1,250 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retention decides which snapshots of a watched path are kept.
+// Snapshots are kept if they are among the KeepLast newest ones or
+// if they are the newest of one of the last KeepHourly hours,
+// KeepDaily days, KeepWeekly weeks or KeepMonthly months that have
+// snapshots. If MaxSize is set, the oldest of the kept snapshots are
+// dropped until their total size fits, but the newest one is always
+// kept. For the DEDUP archiver only the manifests are counted.
+// The zero value keeps everything.
+type Retention struct {
+	KeepLast    int
+	KeepHourly  int
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	MaxSize     int64
+}
+
+// IsZero reports whether the policy keeps every snapshot.
+func (r Retention) IsZero() bool {
+	return r == Retention{}
+}
+
+var retentionKeys = []string{"last", "hourly", "daily", "weekly", "monthly", "size"}
+
+func (r *Retention) fields() []*int {
+	return []*int{&r.KeepLast, &r.KeepHourly, &r.KeepDaily, &r.KeepWeekly, &r.KeepMonthly}
+}
+
+// String formats the policy the way Set parses it.
+func (r *Retention) String() string {
+	if r == nil {
+		return ""
+	}
+	var parts []string
+	for i, f := range r.fields() {
+		if *f > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", retentionKeys[i], *f))
+		}
+	}
+	if r.MaxSize > 0 {
+		parts = append(parts, fmt.Sprintf("size=%d", r.MaxSize))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Set parses a policy like "last=10,daily=7,weekly=4,size=10G", so
+// a Retention can be used as a flag.Value.
+func (r *Retention) Set(s string) error {
+	*r = Retention{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid retention rule: %s", part)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if key == "size" {
+			size, err := ParseSize(value)
+			if err != nil {
+				return err
+			}
+			r.MaxSize = size
+			continue
+		}
+		found := false
+		for i, f := range r.fields() {
+			if retentionKeys[i] == key {
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					return fmt.Errorf("invalid retention count: %s", part)
+				}
+				*f = n
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown retention rule: %s", key)
+		}
+	}
+	return nil
+}
+
+// ParseSize parses a byte count with an optional K, M, G or T suffix.
+func ParseSize(s string) (int64, error) {
+	mult := int64(1)
+	upper := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	if upper != "" {
+		switch upper[len(upper)-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult > 1 {
+			upper = upper[:len(upper)-1]
+		}
+	}
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return n * mult, nil
+}
+
+// Apply splits the snapshots, as returned by Snapshots, into the ones
+// kept and the ones to prune. Both are returned oldest first.
+func (r Retention) Apply(snaps []SnapshotInfo) (keep, prune []SnapshotInfo) {
+	if r.IsZero() || len(snaps) == 0 {
+		return snaps, nil
+	}
+	kept := make([]bool, len(snaps))
+	buckets := []struct {
+		n   int
+		key func(t time.Time) string
+	}{
+		{r.KeepHourly, func(t time.Time) string { return t.Format("2006-01-02 15") }},
+		{r.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{r.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", year, week)
+		}},
+		{r.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for i := len(snaps) - 1; i >= 0 && i >= len(snaps)-r.KeepLast; i-- {
+		kept[i] = true
+	}
+	for _, b := range buckets {
+		seen := make(map[string]bool)
+		for i := len(snaps) - 1; i >= 0 && len(seen) < b.n; i-- {
+			key := b.key(snaps[i].Time)
+			if !seen[key] {
+				seen[key] = true
+				kept[i] = true
+			}
+		}
+	}
+	if r.MaxSize > 0 {
+		var total int64
+		for i := len(snaps) - 1; i >= 0; i-- {
+			if !kept[i] {
+				continue
+			}
+			total += snaps[i].Size
+			if total > r.MaxSize && i != len(snaps)-1 {
+				kept[i] = false
+			}
+		}
+	}
+	for i, snap := range snaps {
+		if kept[i] {
+			keep = append(keep, snap)
+		} else {
+			prune = append(prune, snap)
+		}
+	}
+	return keep, prune
+}
+
+// Prune applies the retention policy to the snapshots of the watched
+// path and deletes the ones it does not keep, unless dryRun is set.
+// It returns the pruned snapshots.
+func Prune(destination, path string, r Retention, dryRun bool) ([]SnapshotInfo, error) {
+	snaps, err := Snapshots(destination, path)
+	if err != nil {
+		return nil, err
+	}
+	_, prune := r.Apply(snaps)
+	if dryRun || len(prune) == 0 {
+		return prune, nil
+	}
+	dedup := false
+	for _, snap := range prune {
+		if err := removeArchive(snap.File); err != nil {
+			return nil, err
+		}
+		dedup = dedup || snap.Archiver == DEDUP
+	}
+	if dedup {
+		if _, err := CollectChunks(destination); err != nil {
+			return prune, err
+		}
+	}
+	return prune, nil
+}
+
+// ChunkGrace is how old an unreferenced chunk must be for
+// CollectChunks to delete it. A DEDUP archive being written, maybe by
+// another process, references its chunks only once it is complete;
+// the chunks it stores or reuses are kept this long meanwhile.
+var ChunkGrace = time.Hour
+
+// CollectChunks deletes the chunks of the DEDUP archiver that are
+// no longer referenced by any snapshot under destination and returns
+// how many were removed. Chunks written or reused within ChunkGrace
+// and temporary files are left alone.
+func CollectChunks(destination string) (int, error) {
+	used := make(map[string]bool)
+	manifests, err := filepath.Glob(filepath.Join(destination, "*", "*.snap"))
+	if err != nil {
+		return 0, err
+	}
+	for _, manifest := range manifests {
+		snap, err := ReadSnapshot(manifest)
+		if err != nil {
+			return 0, err // never delete chunks we might still need
+		}
+		for _, f := range snap.Files {
+			for _, sum := range f.Chunks {
+				used[sum] = true
+			}
+		}
+	}
+	removed := 0
+	store := filepath.Join(destination, ChunkDir)
+	err = filepath.Walk(store, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil || info.IsDir() || used[info.Name()] {
+			return err
+		}
+		if strings.Contains(info.Name(), ".tmp") || time.Since(info.ModTime()) < ChunkGrace {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,128 @@
+package backup_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bukodi/go-playground/backup"
+	"github.com/stretchr/testify/require"
+)
+
+func snapshotsAt(times ...time.Time) []backup.SnapshotInfo {
+	snaps := make([]backup.SnapshotInfo, len(times))
+	for i, t := range times {
+		snaps[i] = backup.SnapshotInfo{File: fmt.Sprint(i), Time: t, Size: 100}
+	}
+	return snaps
+}
+
+func files(snaps []backup.SnapshotInfo) []string {
+	names := make([]string, 0, len(snaps))
+	for _, s := range snaps {
+		names = append(names, s.File)
+	}
+	return names
+}
+
+func TestRetentionSet(t *testing.T) {
+	var r backup.Retention
+	require.NoError(t, r.Set("last=3, daily=7,monthly=12,size=2G"))
+	require.Equal(t, backup.Retention{KeepLast: 3, KeepDaily: 7, KeepMonthly: 12, MaxSize: 2 << 30}, r)
+	require.Equal(t, "last=3,daily=7,monthly=12,size=2147483648", r.String())
+	require.Error(t, r.Set("yearly=1"))
+	require.Error(t, r.Set("last=-1"))
+	require.Error(t, r.Set("size=lots"))
+}
+
+func TestRetentionApply(t *testing.T) {
+	day := time.Date(2021, 3, 1, 0, 0, 0, 0, time.Local)
+	snaps := snapshotsAt(
+		day.Add(1*time.Hour),      // 0
+		day.Add(2*time.Hour),      // 1
+		day.Add(25*time.Hour),     // 2
+		day.Add(26*time.Hour),     // 3
+		day.Add(49*time.Hour),     // 4
+		day.Add(49*time.Hour+1e9), // 5
+		day.Add(49*time.Hour+2e9), // 6
+	)
+
+	keep, prune := backup.Retention{}.Apply(snaps)
+	require.Len(t, keep, 7)
+	require.Empty(t, prune)
+
+	keep, prune = backup.Retention{KeepLast: 2}.Apply(snaps)
+	require.Equal(t, []string{"5", "6"}, files(keep))
+	require.Equal(t, []string{"0", "1", "2", "3", "4"}, files(prune))
+
+	keep, _ = backup.Retention{KeepDaily: 2}.Apply(snaps)
+	require.Equal(t, []string{"3", "6"}, files(keep))
+
+	keep, _ = backup.Retention{KeepLast: 1, KeepDaily: 5}.Apply(snaps)
+	require.Equal(t, []string{"1", "3", "6"}, files(keep))
+
+	keep, _ = backup.Retention{KeepDaily: 5, MaxSize: 250}.Apply(snaps)
+	require.Equal(t, []string{"3", "6"}, files(keep))
+
+	// the newest snapshot survives even if it alone exceeds the limit
+	keep, _ = backup.Retention{KeepLast: 3, MaxSize: 10}.Apply(snaps)
+	require.Equal(t, []string{"6"}, files(keep))
+}
+
+func TestPruneDedup(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "docs")
+	archive := t.TempDir()
+	store := filepath.Join(archive, backup.ChunkDir)
+	m := &backup.Monitor{
+		Destination: archive,
+		Archiver:    backup.DEDUP,
+		Paths:       map[string]string{src: ""},
+	}
+	for i := 0; i < 3; i++ {
+		writeTestFile(t, filepath.Join(src, "a.txt"), fmt.Sprint("version ", i))
+		mtime := time.Now().Add(time.Duration(i) * time.Minute)
+		require.NoError(t, os.Chtimes(filepath.Join(src, "a.txt"), mtime, mtime))
+		_, err := m.Now(context.Background())
+		require.NoError(t, err)
+	}
+	require.Equal(t, 3, countChunks(t, store))
+
+	pruned, err := backup.Prune(archive, src, backup.Retention{KeepLast: 1}, true)
+	require.NoError(t, err)
+	require.Len(t, pruned, 2)
+	snaps, err := backup.Snapshots(archive, src)
+	require.NoError(t, err)
+	require.Len(t, snaps, 3, "dry run must not delete")
+
+	// chunks of a running archive are not yet referenced
+	tmp := filepath.Join(store, "ab", "abcd.tmp123")
+	writeTestFile(t, tmp, "partial")
+
+	pruned, err = backup.Prune(archive, src, backup.Retention{KeepLast: 1}, false)
+	require.NoError(t, err)
+	require.Len(t, pruned, 2)
+	snaps, err = backup.Snapshots(archive, src)
+	require.NoError(t, err)
+	require.Len(t, snaps, 1)
+	require.Equal(t, 4, countChunks(t, store), "recent chunks are kept")
+
+	old := time.Now().Add(-2 * backup.ChunkGrace)
+	err = filepath.Walk(store, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			err = os.Chtimes(path, old, old)
+		}
+		return err
+	})
+	require.NoError(t, err)
+	n, err := backup.CollectChunks(archive)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, 2, countChunks(t, store), "unreferenced chunks are collected")
+	require.FileExists(t, tmp)
+
+	restored := t.TempDir()
+	require.NoError(t, backup.RestoreSnapshot(snaps[0].File, restored))
+}
@@ -0,0 +1,165 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// SnapshotInfo describes an archive written by a Monitor.
+type SnapshotInfo struct {
+	File     string
+	Time     time.Time
+	Size     int64
+	Archiver Archiver
+}
+
+// ArchiveDir returns the directory where the archives of
+// the watched path are stored under destination.
+func ArchiveDir(destination, path string) string {
+	return filepath.Join(destination, filepath.Base(path))
+}
+
+// ArchiverFor finds the Archiver whose DestFmt produced the given
+// archive file name and returns it with the encoded timestamp.
+func ArchiverFor(file string) (Archiver, time.Time, bool) {
+	name := filepath.Base(file)
+	i := 0
+	for i < len(name) && name[i] >= '0' && name[i] <= '9' {
+		i++
+	}
+	nano, err := strconv.ParseInt(name[:i], 10, 64)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	for _, a := range Archivers {
+		if fmt.Sprintf(a.DestFmt(), nano) == name {
+			return a, time.Unix(0, nano), true
+		}
+	}
+	return nil, time.Time{}, false
+}
+
+// Snapshots lists the archives of the watched path stored under
+// destination, oldest first.
+func Snapshots(destination, path string) ([]SnapshotInfo, error) {
+	entries, err := ioutil.ReadDir(ArchiveDir(destination, path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snaps []SnapshotInfo
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		a, t, ok := ArchiverFor(e.Name())
+		if !ok {
+			continue
+		}
+		snaps = append(snaps, SnapshotInfo{
+			File:     filepath.Join(ArchiveDir(destination, path), e.Name()),
+			Time:     t,
+			Size:     e.Size(),
+			Archiver: a,
+		})
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].Time.Before(snaps[j].Time) })
+	return snaps, nil
+}
+
+// SnapshotAt returns the latest snapshot taken at or before t.
+func SnapshotAt(snaps []SnapshotInfo, t time.Time) (SnapshotInfo, bool) {
+	for i := len(snaps) - 1; i >= 0; i-- {
+		if !snaps[i].Time.After(t) {
+			return snaps[i], true
+		}
+	}
+	return SnapshotInfo{}, false
+}
+
+// RestoreSnapshot recovers the directory content stored in the
+// archive file into dest.
+func RestoreSnapshot(file, dest string) error {
+	a, _, ok := ArchiverFor(file)
+	if !ok {
+		return fmt.Errorf("unknown archive format: %s", file)
+	}
+	return a.Restore(file, dest)
+}
+
+// Change is a file that differs between two states of a
+// directory, for example two snapshots. Kind is '+' for
+// added, '-' for removed and '~' for modified files.
+type Change struct {
+	Kind byte
+	Path string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%c %s", c.Kind, c.Path)
+}
+
+// Diff restores both archives into temporary directories and
+// reports the files that differ between them.
+func Diff(snapA, snapB string) ([]Change, error) {
+	tmp, err := ioutil.TempDir("", "backup-diff")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	a, b := filepath.Join(tmp, "a"), filepath.Join(tmp, "b")
+	if err := RestoreSnapshot(snapA, a); err != nil {
+		return nil, err
+	}
+	if err := RestoreSnapshot(snapB, b); err != nil {
+		return nil, err
+	}
+	sumsA, err := fileSums(a)
+	if err != nil {
+		return nil, err
+	}
+	sumsB, err := fileSums(b)
+	if err != nil {
+		return nil, err
+	}
+	return compareDigests(sumsA, sumsB), nil
+}
+
+// fileSums returns the SHA-256 digest of every regular file under
+// root keyed by its slash separated relative path.
+func fileSums(root string) (map[string]string, error) {
+	sums := make(map[string]string)
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return sums, nil // empty archive
+	}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		sums[filepath.ToSlash(rel)] = fmt.Sprintf("%x", h.Sum(nil))
+		return nil
+	})
+	return sums, err
+}
@@ -0,0 +1,60 @@
+package backup_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bukodi/go-playground/backup"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotsRestoreAndDiff(t *testing.T) {
+	for _, format := range []string{"zip", "dedup"} {
+		t.Run(format, func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), "docs")
+			archive := t.TempDir()
+			writeTestFile(t, filepath.Join(src, "a.txt"), "alpha")
+			writeTestFile(t, filepath.Join(src, "b.txt"), "beta")
+			m := &backup.Monitor{
+				Destination: archive,
+				Archiver:    backup.Archivers[format],
+				Paths:       map[string]string{src: ""},
+			}
+			_, err := m.Now(context.Background())
+			require.NoError(t, err)
+			between := time.Now()
+
+			later := time.Now().Add(time.Minute)
+			writeTestFile(t, filepath.Join(src, "b.txt"), "beta2")
+			writeTestFile(t, filepath.Join(src, "c.txt"), "gamma")
+			require.NoError(t, os.Chtimes(filepath.Join(src, "b.txt"), later, later))
+			_, err = m.Now(context.Background())
+			require.NoError(t, err)
+
+			snaps, err := backup.Snapshots(archive, src)
+			require.NoError(t, err)
+			require.Len(t, snaps, 2)
+			require.True(t, snaps[0].Time.Before(snaps[1].Time))
+
+			snap, ok := backup.SnapshotAt(snaps, between)
+			require.True(t, ok)
+			require.Equal(t, snaps[0], snap)
+			_, ok = backup.SnapshotAt(snaps, snaps[0].Time.Add(-time.Second))
+			require.False(t, ok)
+
+			dest := t.TempDir()
+			require.NoError(t, backup.RestoreSnapshot(snap.File, dest))
+			data, err := ioutil.ReadFile(filepath.Join(dest, "b.txt"))
+			require.NoError(t, err)
+			require.Equal(t, "beta", string(data))
+
+			changes, err := backup.Diff(snaps[0].File, snaps[1].File)
+			require.NoError(t, err)
+			require.Equal(t, []backup.Change{{Kind: '~', Path: "b.txt"}, {Kind: '+', Path: "c.txt"}}, changes)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// PathStatus is the state of a watched path as seen by its Monitor.
+type PathStatus struct {
+	Path        string    `json:"path"`
+	Paused      bool      `json:"paused"`
+	LastCheck   time.Time `json:"lastCheck"`
+	LastArchive time.Time `json:"lastArchive"`
+	LastFile    string    `json:"lastFile,omitempty"`
+	LastSize    int64     `json:"lastSize"`
+	LastError   string    `json:"lastError,omitempty"`
+	Checks      int       `json:"checks"`
+	Archives    int       `json:"archives"`
+	Failures    int       `json:"failures"`
+}
+
+// statusOf returns the status of the path, creating it if needed.
+// m.mu must be held.
+func (m *Monitor) statusOf(path string) *PathStatus {
+	if m.status == nil {
+		m.status = make(map[string]*PathStatus)
+	}
+	s, ok := m.status[path]
+	if !ok {
+		s = &PathStatus{Path: path}
+		m.status[path] = s
+	}
+	return s
+}
+
+// Status returns the status of every path in Paths, sorted by path.
+// It is safe to call while the Monitor is checking.
+func (m *Monitor) Status() []PathStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	statuses := make([]PathStatus, 0, len(m.Paths))
+	for path := range m.Paths {
+		statuses = append(statuses, *m.statusOf(path))
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Path < statuses[j].Path })
+	return statuses
+}
+
+// Pause stops checking the path until Resume is called.
+func (m *Monitor) Pause(path string) error {
+	return m.setPaused(path, true)
+}
+
+// Resume checks the path again after Pause.
+func (m *Monitor) Resume(path string) error {
+	return m.setPaused(path, false)
+}
+
+func (m *Monitor) setPaused(path string, paused bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.Paths[path]; !ok {
+		return fmt.Errorf("unknown path: %s", path)
+	}
+	m.statusOf(path).Paused = paused
+	return nil
+}
+
+// recordCheck updates the status of the path after a check that wrote
+// the archive file, if it is not empty, or failed with err.
+func (m *Monitor) recordCheck(path, file string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.statusOf(path)
+	s.LastCheck = time.Now()
+	s.Checks++
+	if err != nil {
+		s.LastError = err.Error()
+		s.Failures++
+		return
+	}
+	s.LastError = ""
+	if file != "" {
+		s.LastArchive = s.LastCheck
+		s.LastFile = file
+		s.LastSize = 0
+		if info, err := os.Stat(file); err == nil {
+			s.LastSize = info.Size()
+		}
+		s.Archives++
+	}
+}
@@ -0,0 +1,133 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// HTTPStorage is a Storage on a plain HTTP server, for example a
+// WebDAV share or nginx with the dav module. Objects are written
+// with PUT, read with GET and removed with DELETE. List parses the
+// links of the directory index page the server returns for
+// "URL/dir/", as generated by nginx autoindex or http.FileServer.
+type HTTPStorage struct {
+	URL string
+	// Client is used for the requests, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+func (s *HTTPStorage) client() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+	return s.Client
+}
+
+func (s *HTTPStorage) url(name string) string {
+	u := s.URL
+	for _, part := range strings.Split(name, "/") {
+		u += "/" + url.PathEscape(part)
+	}
+	return u
+}
+
+func (s *HTTPStorage) do(method, name string, body io.Reader, size int64) (*http.Response, error) {
+	if body != nil && size == 0 {
+		body = http.NoBody // a zero ContentLength would mean unknown otherwise
+	}
+	req, err := http.NewRequest(method, s.url(name), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, httpError(method, req.URL, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+func httpError(method string, u *url.URL, status int) error {
+	err := fmt.Errorf("%s %s: %s", method, u.Redacted(), http.StatusText(status))
+	if status == http.StatusNotFound {
+		return &os.PathError{Op: method, Path: u.Path, Err: os.ErrNotExist}
+	}
+	return err
+}
+
+func (s *HTTPStorage) Put(name string, r io.Reader, size int64) error {
+	resp, err := s.do(http.MethodPut, name, io.LimitReader(r, size), size)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *HTTPStorage) Get(name string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, name, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *HTTPStorage) Stat(name string) (int64, error) {
+	resp, err := s.do(http.MethodHead, name, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+var hrefPattern = regexp.MustCompile(`href="([^"?#]+)"`)
+
+func (s *HTTPStorage) List(dir string) ([]StoredFile, error) {
+	resp, err := s.do(http.MethodGet, dir+"/", nil, 0)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	page, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var files []StoredFile
+	for _, m := range hrefPattern.FindAllSubmatch(page, -1) {
+		link, err := url.PathUnescape(string(m[1]))
+		if err != nil || strings.Contains(link, "/") {
+			continue // subdirectories, parent and absolute links
+		}
+		name := path.Join(dir, link)
+		size, err := s.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, StoredFile{Name: name, Size: size})
+	}
+	return files, nil
+}
+
+func (s *HTTPStorage) Delete(name string) error {
+	resp, err := s.do(http.MethodDelete, name, nil, 0)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,266 @@
+package backup
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Storage is a Storage in a bucket of an S3 compatible object
+// store, like AWS S3 or MinIO. Requests use path style addressing
+// and are signed with AWS Signature Version 4.
+type S3Storage struct {
+	Endpoint  string // e.g. "https://s3.eu-central-1.amazonaws.com"
+	Region    string
+	Bucket    string
+	Prefix    string // prepended to every object name
+	AccessKey string
+	SecretKey string
+	// Client is used for the requests, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// NewS3Storage creates an S3Storage from a URL like
+// "s3://bucket/prefix?endpoint=localhost:9000&region=us-east-1&insecure=1".
+// The endpoint defaults to AWS and the region to us-east-1, the
+// credentials are taken from the AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY environment variables.
+func NewS3Storage(u *url.URL) (*S3Storage, error) {
+	q := u.Query()
+	s := &S3Storage{
+		Region:    q.Get("region"),
+		Bucket:    u.Host,
+		Prefix:    strings.Trim(u.Path, "/"),
+		AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	}
+	if s.Bucket == "" {
+		return nil, fmt.Errorf("missing bucket in %s", u.Redacted())
+	}
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	scheme := "https"
+	if q.Get("insecure") != "" {
+		scheme = "http"
+	}
+	if endpoint := q.Get("endpoint"); endpoint != "" {
+		s.Endpoint = scheme + "://" + endpoint
+	} else {
+		s.Endpoint = scheme + "://s3." + s.Region + ".amazonaws.com"
+	}
+	return s, nil
+}
+
+func (s *S3Storage) client() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+	return s.Client
+}
+
+func (s *S3Storage) key(name string) string {
+	if s.Prefix == "" {
+		return name
+	}
+	return s.Prefix + "/" + name
+}
+
+// do sends a signed request for the object key, or for the bucket if
+// key is empty. The payload is not signed, so uploads can be streamed.
+func (s *S3Storage) do(method, key string, query url.Values, body io.Reader, size int64) (*http.Response, error) {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/" + s.Bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawQuery = canonicalQuery(query)
+	if body != nil && size == 0 {
+		body = http.NoBody // a zero ContentLength would mean unknown otherwise
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	signV4(req, "UNSIGNED-PAYLOAD", s.AccessKey, s.SecretKey, s.Region, "s3", time.Now())
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, s3Error(method, key, resp)
+	}
+	return resp, nil
+}
+
+func s3Error(method, key string, resp *http.Response) error {
+	var e struct {
+		Code    string
+		Message string
+	}
+	if resp.Body != nil {
+		xml.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&e)
+	}
+	if resp.StatusCode == http.StatusNotFound && e.Code != "NoSuchBucket" {
+		return &os.PathError{Op: method, Path: key, Err: os.ErrNotExist}
+	}
+	if e.Code == "" {
+		e.Code = http.StatusText(resp.StatusCode)
+	}
+	return fmt.Errorf("s3 %s %s: %s %s", method, key, e.Code, e.Message)
+}
+
+func (s *S3Storage) Put(name string, r io.Reader, size int64) error {
+	resp, err := s.do(http.MethodPut, s.key(name), nil, io.LimitReader(r, size), size)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3Storage) Get(name string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, s.key(name), nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Storage) Stat(name string) (int64, error) {
+	resp, err := s.do(http.MethodHead, s.key(name), nil, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key  string
+		Size int64
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *S3Storage) List(dir string) ([]StoredFile, error) {
+	prefix := s.key(dir) + "/"
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}, "delimiter": {"/"}}
+	var files []StoredFile
+	for {
+		resp, err := s.do(http.MethodGet, "", query, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range result.Contents {
+			files = append(files, StoredFile{Name: dir + "/" + strings.TrimPrefix(c.Key, prefix), Size: c.Size})
+		}
+		if !result.IsTruncated {
+			return files, nil
+		}
+		if result.NextContinuationToken == "" {
+			return nil, errors.New("s3: truncated listing without continuation token")
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func (s *S3Storage) Delete(name string) error {
+	resp, err := s.do(http.MethodDelete, s.key(name), nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// signV4 adds the X-Amz-Date and Authorization headers of AWS
+// Signature Version 4 to the request. The host and every header
+// already set on the request are signed.
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region, service string, t time.Time) {
+	t = t.UTC()
+	stamp := t.Format("20060102T150405Z")
+	day := stamp[:8]
+	req.Header.Set("X-Amz-Date", stamp)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		stamp,
+		scope,
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes the query sorted by name and with spaces as
+// %20, as SigV4 requires.
+func canonicalQuery(q url.Values) string {
+	return strings.ReplaceAll(q.Encode(), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,153 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTPStorage is a Storage in a directory of an SFTP server.
+type SFTPStorage struct {
+	Client *sftp.Client
+	Dir    string
+	conn   io.Closer // the SSH connection opened by DialSFTP
+}
+
+// DialSFTP connects to the server of a URL like
+// "sftp://user@host:22/backups?key=/home/user/.ssh/id_ed25519".
+// It authenticates with the password of the URL or the private key
+// of the key parameter, by default ~/.ssh/id_ed25519 or ~/.ssh/id_rsa,
+// and checks the host key against ~/.ssh/known_hosts.
+func DialSFTP(u *url.URL) (*SFTPStorage, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ClientConfig{
+		User:            u.User.Username(),
+		HostKeyCallback: hostKeys,
+	}
+	if password, ok := u.User.Password(); ok {
+		config.Auth = append(config.Auth, ssh.Password(password))
+	}
+	keyFiles := []string{filepath.Join(home, ".ssh", "id_ed25519"), filepath.Join(home, ".ssh", "id_rsa")}
+	if key := u.Query().Get("key"); key != "" {
+		keyFiles = []string{key}
+	}
+	for _, file := range keyFiles {
+		pem, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %w", file, err)
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+		break
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+	conn, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &SFTPStorage{Client: client, Dir: u.Path, conn: conn}, nil
+}
+
+func (s *SFTPStorage) path(name string) string {
+	return path.Join(s.Dir, name)
+}
+
+func (s *SFTPStorage) Put(name string, r io.Reader, size int64) error {
+	target := s.path(name)
+	if err := s.Client.MkdirAll(path.Dir(target)); err != nil {
+		return err
+	}
+	tmp := target + ".tmp"
+	f, err := s.Client.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(f, r, size); err != nil {
+		f.Close()
+		s.Client.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		s.Client.Remove(tmp)
+		return err
+	}
+	// PosixRename replaces the target, where the server supports it
+	if err := s.Client.PosixRename(tmp, target); err != nil {
+		s.Client.Remove(target)
+		return s.Client.Rename(tmp, target)
+	}
+	return nil
+}
+
+func (s *SFTPStorage) Get(name string) (io.ReadCloser, error) {
+	return s.Client.Open(s.path(name))
+}
+
+func (s *SFTPStorage) Stat(name string) (int64, error) {
+	info, err := s.Client.Stat(s.path(name))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (s *SFTPStorage) List(dir string) ([]StoredFile, error) {
+	entries, err := s.Client.ReadDir(s.path(dir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []StoredFile
+	for _, e := range entries {
+		if !e.IsDir() {
+			files = append(files, StoredFile{Name: path.Join(dir, e.Name()), Size: e.Size()})
+		}
+	}
+	return files, nil
+}
+
+func (s *SFTPStorage) Delete(name string) error {
+	return s.Client.Remove(s.path(name))
+}
+
+// Close closes the SFTP session and the SSH connection it was
+// opened on by DialSFTP.
+func (s *SFTPStorage) Close() error {
+	err := s.Client.Close()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	return err
+}
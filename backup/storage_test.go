@@ -0,0 +1,333 @@
+package backup_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bukodi/go-playground/backup"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/require"
+)
+
+// testStorage runs the operations every Storage must support.
+func testStorage(t *testing.T, s backup.Storage) {
+	put := func(name, content string) {
+		require.NoError(t, s.Put(name, strings.NewReader(content), int64(len(content))))
+	}
+	put("docs/1.zip", "first")
+	put("docs/2.zip", "second")
+	put("docs/empty.zip", "")
+	put("other/3.zip", "third")
+	put("docs/1.zip", "replaced")
+
+	r, err := s.Get("docs/1.zip")
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, "replaced", string(data))
+
+	size, err := s.Stat("docs/2.zip")
+	require.NoError(t, err)
+	require.Equal(t, int64(6), size)
+
+	files, err := s.List("docs")
+	require.NoError(t, err)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	require.Equal(t, []backup.StoredFile{
+		{Name: "docs/1.zip", Size: 8},
+		{Name: "docs/2.zip", Size: 6},
+		{Name: "docs/empty.zip", Size: 0},
+	}, files)
+
+	files, err = s.List("missing")
+	require.NoError(t, err)
+	require.Empty(t, files)
+
+	require.NoError(t, s.Delete("docs/2.zip"))
+	_, err = s.Stat("docs/2.zip")
+	require.True(t, errors.Is(err, os.ErrNotExist), "%v", err)
+	_, err = s.Get("docs/2.zip")
+	require.True(t, errors.Is(err, os.ErrNotExist), "%v", err)
+}
+
+func TestLocalStorage(t *testing.T) {
+	testStorage(t, backup.LocalStorage(t.TempDir()))
+}
+
+func TestHTTPStorage(t *testing.T) {
+	root := t.TempDir()
+	files := http.FileServer(http.Dir(root))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := filepath.Join(root, filepath.FromSlash(r.URL.Path))
+		switch r.Method {
+		case http.MethodPut:
+			require.NoError(t, os.MkdirAll(filepath.Dir(target), 0777))
+			data, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			require.NoError(t, ioutil.WriteFile(target, data, 0644))
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodDelete:
+			if err := os.Remove(target); err != nil {
+				http.NotFound(w, r)
+			}
+		default:
+			files.ServeHTTP(w, r)
+		}
+	}))
+	defer srv.Close()
+	testStorage(t, &backup.HTTPStorage{URL: srv.URL + "/backups"})
+}
+
+func TestSFTPStorage(t *testing.T) {
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{serverIn, serverOut})
+	require.NoError(t, err)
+	go server.Serve()
+	client, err := sftp.NewClientPipe(clientIn, clientOut)
+	require.NoError(t, err)
+	s := &backup.SFTPStorage{Client: client, Dir: t.TempDir()}
+	defer s.Close()
+	defer server.Close() // first, so the client sees the session end
+	testStorage(t, s)
+}
+
+// fakeS3 is an in-memory stand-in for an S3 compatible object store
+// that checks the request signatures.
+type fakeS3 struct {
+	t         *testing.T
+	secretKey string
+	mu        sync.Mutex
+	objects   map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.validSignature(r) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>")
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	require.Equal(f.t, "bucket", parts[0])
+	if len(parts) == 1 {
+		f.list(w, r.URL.Query())
+		return
+	}
+	key := parts[1]
+	switch r.Method {
+	case http.MethodPut:
+		data, err := ioutil.ReadAll(r.Body)
+		require.NoError(f.t, err)
+		f.objects[key] = data
+	case http.MethodGet, http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "<Error><Code>NoSuchKey</Code></Error>")
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, q url.Values) {
+	require.Equal(f.t, "2", q.Get("list-type"))
+	type content struct {
+		Key  string
+		Size int
+	}
+	var result struct {
+		XMLName  xml.Name `xml:"ListBucketResult"`
+		Contents []content
+	}
+	for key, data := range f.objects {
+		rest := strings.TrimPrefix(key, q.Get("prefix"))
+		if rest != key && !strings.Contains(rest, q.Get("delimiter")) {
+			result.Contents = append(result.Contents, content{key, len(data)})
+		}
+	}
+	require.NoError(f.t, xml.NewEncoder(w).Encode(result))
+}
+
+// validSignature recomputes the AWS Signature Version 4 of the request.
+func (f *fakeS3) validSignature(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	var credential, signedHeaders, signature string
+	for _, field := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ", ") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return false
+		}
+		switch kv[0] {
+		case "Credential":
+			credential = kv[1]
+		case "SignedHeaders":
+			signedHeaders = kv[1]
+		case "Signature":
+			signature = kv[1]
+		}
+	}
+	scope := strings.SplitN(credential, "/", 2)
+	if len(scope) != 2 || scope[0] != "AKID" {
+		return false
+	}
+	var headers strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + value + "\n")
+	}
+	canonical := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		strings.ReplaceAll(r.URL.Query().Encode(), "+", "%20"),
+		headers.String(),
+		signedHeaders,
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + r.Header.Get("X-Amz-Date") + "\n" + scope[1] + "\n" + hex.EncodeToString(sum[:])
+	key := []byte("AWS4" + f.secretKey)
+	for _, part := range strings.Split(scope[1], "/") {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(toSign))
+	return hex.EncodeToString(mac.Sum(nil)) == signature
+}
+
+func TestS3Storage(t *testing.T) {
+	fake := &fakeS3{t: t, secretKey: "secret", objects: make(map[string][]byte)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	s, err := backup.OpenStorage("s3://bucket/host1?insecure=1&endpoint=" + strings.TrimPrefix(srv.URL, "http://"))
+	require.NoError(t, err)
+	testStorage(t, s)
+	require.Contains(t, fake.objects, "host1/docs/1.zip")
+
+	s.(*backup.S3Storage).SecretKey = "wrong"
+	_, err = s.Stat("docs/1.zip")
+	require.Error(t, err)
+	require.False(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestMonitorUploadsAndFetch(t *testing.T) {
+	for _, name := range []string{"zip", "dedup"} {
+		t.Run(name, func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), "src")
+			writeTestFile(t, filepath.Join(src, "a.txt"), "alpha")
+			writeTestFile(t, filepath.Join(src, "sub", "b.txt"), "beta")
+			remote := backup.LocalStorage(t.TempDir())
+			m := &backup.Monitor{
+				Destination: t.TempDir(),
+				Archiver:    backup.Archivers[name],
+				Paths:       map[string]string{src: ""},
+				Storage:     remote,
+			}
+			n, err := m.Now(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, 1, n)
+
+			snaps, err := backup.StoredSnapshots(remote, src)
+			require.NoError(t, err)
+			require.Len(t, snaps, 1)
+			require.True(t, strings.HasPrefix(snaps[0].File, "src/"), snaps[0].File)
+			require.WithinDuration(t, time.Now(), snaps[0].Time, time.Minute)
+
+			// restore on another machine, without the local archives
+			file, err := backup.Fetch(remote, snaps[0].File, t.TempDir())
+			require.NoError(t, err)
+			restored := t.TempDir()
+			require.NoError(t, backup.RestoreSnapshot(file, restored))
+			require.Equal(t, []string{"a.txt", "sub/b.txt"}, restoredFiles(t, restored))
+		})
+	}
+}
+
+func TestFetchRejectsCraftedChunkIDs(t *testing.T) {
+	remote := backup.LocalStorage(t.TempDir())
+	for _, id := range []string{"a", "../../../../outside", strings.Repeat("g", 64)} {
+		snap := `{"source": "docs", "files": [{"path": "a.txt", "mode": 420, "chunks": ["` + id + `"]}]}`
+		require.NoError(t, remote.Put("docs/1.snap", strings.NewReader(snap), int64(len(snap))))
+		dest := t.TempDir()
+		_, err := backup.Fetch(remote, "docs/1.snap", dest)
+		require.Error(t, err, id)
+	}
+}
+
+func TestCollectStoredChunks(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "docs")
+	remote := backup.LocalStorage(t.TempDir())
+	m := &backup.Monitor{
+		Destination: t.TempDir(),
+		Archiver:    backup.DEDUP,
+		Paths:       map[string]string{src: ""},
+		Storage:     remote,
+	}
+	for i := 0; i < 3; i++ {
+		writeTestFile(t, filepath.Join(src, "a.txt"), fmt.Sprint("version ", i))
+		mtime := time.Now().Add(time.Duration(i) * time.Minute)
+		require.NoError(t, os.Chtimes(filepath.Join(src, "a.txt"), mtime, mtime))
+		_, err := m.Now(context.Background())
+		require.NoError(t, err)
+	}
+	store := filepath.Join(string(remote), backup.ChunkDir)
+	require.Equal(t, 3, countChunks(t, store))
+
+	// a snapshot only in the storage keeps its chunks
+	snaps, err := backup.StoredSnapshots(remote, src)
+	require.NoError(t, err)
+	require.Len(t, snaps, 3)
+	pruned, err := backup.Prune(m.Destination, src, backup.Retention{KeepLast: 1}, false)
+	require.NoError(t, err)
+	require.Len(t, pruned, 2)
+	n, err := backup.CollectStoredChunks(remote, m.Destination)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	for _, snap := range snaps[:2] {
+		require.NoError(t, remote.Delete(snap.File))
+	}
+	n, err = backup.CollectStoredChunks(remote, m.Destination)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, 1, countChunks(t, store))
+
+	file, err := backup.Fetch(remote, snaps[2].File, t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, backup.RestoreSnapshot(file, t.TempDir()))
+}
@@ -0,0 +1,330 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type tarball struct {
+	ext        string
+	compress   func(w io.Writer) (io.WriteCloser, error)
+	decompress func(r io.Reader) (io.ReadCloser, error)
+}
+
+func (t *tarball) DestFmt() string {
+	return "%d" + t.ext
+}
+
+func (t *tarball) Archive(ctx context.Context, src, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0777); err != nil {
+		return err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := t.archiveTo(ctx, src, out); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func (t *tarball) archiveTo(ctx context.Context, src string, out io.Writer) error {
+	cw, err := t.compress(out)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(cw)
+	links := make(map[[2]uint64]string)
+	err = walkTree(src, filterOf(ctx), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		var linkname string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if linkname, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, linkname)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if id, ok := hardLinkID(info); ok && info.Mode().IsRegular() {
+			if first, seen := links[id]; seen {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = first
+				hdr.Size = 0
+				if err := tw.WriteHeader(hdr); err != nil {
+					return err
+				}
+				sums := archiveSumsOf(ctx)
+				sums.set(hdr.Name, sums.get(first))
+				return nil
+			}
+			links[id] = hdr.Name
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		r := newArchivedReader(ctx, hdr.Name, in)
+		if _, err := io.CopyN(tw, r, hdr.Size); err != nil {
+			return err
+		}
+		r.archived()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+func (t *tarball) Restore(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, err := t.decompress(in)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := os.MkdirAll(dest, 0777); err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	var dirs []*tar.Header
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		target, err := safeJoin(dest, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			if err := mkdirInside(dest, target, 0700); err != nil {
+				return err
+			}
+			if err := insideRealPath(dest, target); err != nil {
+				return err
+			}
+			dirs = append(dirs, hdr)
+			continue
+		}
+		if err := mkdirInside(dest, filepath.Dir(target), 0777); err != nil {
+			return err
+		}
+		if err := insideRealPath(dest, filepath.Dir(target)); err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			if err := restoreFile(tr, target); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			os.Remove(target)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			first, err := safeJoin(dest, hdr.Linkname)
+			if err != nil {
+				return err
+			}
+			os.Remove(target)
+			if err := os.Link(first, target); err != nil {
+				return err
+			}
+			continue // shares the metadata of the first link
+		default:
+			continue // devices, fifos and the like are not restored
+		}
+		if err := restoreMetadata(target, hdr); err != nil {
+			return err
+		}
+	}
+	// directories last, as restoring their content updates their mtime;
+	// a later entry may have replaced them with a symlink
+	for i := len(dirs) - 1; i >= 0; i-- {
+		target, _ := safeJoin(dest, dirs[i].Name)
+		if err := restoreDirMetadata(target, dirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func restoreFile(r io.Reader, target string) error {
+	os.Remove(target) // do not write through an existing link
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// restoreMetadata restores the ownership, mode and times of the
+// entry. Ownership is only restored when running as root.
+func restoreMetadata(target string, hdr *tar.Header) error {
+	if os.Geteuid() == 0 {
+		if err := os.Lchown(target, hdr.Uid, hdr.Gid); err != nil {
+			return err
+		}
+	}
+	if hdr.Typeflag == tar.TypeSymlink {
+		return nil // symlinks have no mode and their times cannot be set portably
+	}
+	if err := os.Chmod(target, headerMode(hdr)); err != nil {
+		return err
+	}
+	return os.Chtimes(target, headerAtime(hdr), hdr.ModTime)
+}
+
+// headerMode returns the permission bits of the entry.
+func headerMode(hdr *tar.Header) os.FileMode {
+	return hdr.FileInfo().Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+}
+
+// headerAtime returns the access time of the entry, its mtime if the
+// archive has none.
+func headerAtime(hdr *tar.Header) time.Time {
+	if hdr.AccessTime.IsZero() {
+		return hdr.ModTime
+	}
+	return hdr.AccessTime
+}
+
+// mkdirInside creates dir and its missing parents below dest, like
+// os.MkdirAll, but refuses to go through anything but a directory:
+// MkdirAll follows symlinks restored earlier out of dest.
+func mkdirInside(dest, dir string, perm os.FileMode) error {
+	rel, err := filepath.Rel(dest, dir)
+	if err != nil || rel == "." {
+		return err
+	}
+	path := dest
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		path = filepath.Join(path, name)
+		info, err := os.Lstat(path)
+		switch {
+		case os.IsNotExist(err):
+			if err := os.Mkdir(path, perm); err != nil && !os.IsExist(err) {
+				return err
+			}
+		case err != nil:
+			return err
+		case !info.IsDir():
+			return fmt.Errorf("%s is not a directory", path)
+		}
+	}
+	return nil
+}
+
+// safeJoin joins the slash separated archive entry name to dest and
+// rejects names that would escape it.
+func safeJoin(dest, name string) (string, error) {
+	target := filepath.Join(dest, filepath.FromSlash(name))
+	rel, err := filepath.Rel(dest, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(filepath.FromSlash(name)) {
+		return "", fmt.Errorf("archive entry %q escapes the restore directory", name)
+	}
+	return target, nil
+}
+
+// insideRealPath checks that dir, after resolving symlinks restored
+// earlier, is still inside dest.
+func insideRealPath(dest, dir string) error {
+	realDest, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(realDest, realDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s escapes the restore directory through a symlink", dir)
+	}
+	return nil
+}
+
+type zstdReadCloser struct {
+	*zstd.Decoder
+}
+
+func (r zstdReadCloser) Close() error {
+	r.Decoder.Close()
+	return nil
+}
+
+// TarGz is an Archiver that writes gzip compressed tarballs, which
+// keep permissions, ownership, symlinks, hard links and timestamps.
+var TarGz Archiver = &tarball{
+	ext: ".tar.gz",
+	compress: func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	},
+	decompress: func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+}
+
+// TarZstd is like TarGz, but compresses with zstd.
+var TarZstd Archiver = &tarball{
+	ext: ".tar.zst",
+	compress: func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w)
+	},
+	decompress: func(r io.Reader) (io.ReadCloser, error) {
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zstdReadCloser{d}, nil
+	},
+}
@@ -0,0 +1,130 @@
+package backup_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bukodi/go-playground/backup"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTarArchivers(t *testing.T) {
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "private.txt"), "private")
+	require.NoError(t, os.Chmod(filepath.Join(src, "private.txt"), 0600))
+	writeTestFile(t, filepath.Join(src, "bin", "run.sh"), "#!/bin/sh")
+	require.NoError(t, os.Chmod(filepath.Join(src, "bin", "run.sh"), 0755))
+	require.NoError(t, os.Symlink("bin/run.sh", filepath.Join(src, "run")))
+	require.NoError(t, os.Link(filepath.Join(src, "private.txt"), filepath.Join(src, "bin", "hardlink.txt")))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(src, "bin", "run.sh"), mtime, mtime))
+	require.NoError(t, os.Chtimes(filepath.Join(src, "bin"), mtime, mtime))
+
+	for _, a := range []backup.Archiver{backup.TarGz, backup.TarZstd} {
+		t.Run(a.DestFmt(), func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "src", "1"+a.DestFmt()[2:])
+			require.NoError(t, a.Archive(context.Background(), src, archive))
+			dest := t.TempDir()
+			require.NoError(t, a.Restore(archive, dest))
+
+			info, err := os.Stat(filepath.Join(dest, "private.txt"))
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+			info, err = os.Stat(filepath.Join(dest, "bin", "run.sh"))
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0755), info.Mode().Perm())
+			require.True(t, mtime.Equal(info.ModTime()))
+
+			info, err = os.Stat(filepath.Join(dest, "bin"))
+			require.NoError(t, err)
+			require.True(t, mtime.Equal(info.ModTime()))
+
+			link, err := os.Readlink(filepath.Join(dest, "run"))
+			require.NoError(t, err)
+			require.Equal(t, "bin/run.sh", link)
+
+			first, err := os.Stat(filepath.Join(dest, "private.txt"))
+			require.NoError(t, err)
+			second, err := os.Stat(filepath.Join(dest, "bin", "hardlink.txt"))
+			require.NoError(t, err)
+			require.True(t, os.SameFile(first, second), "hard links are preserved")
+			if st, ok := second.Sys().(*syscall.Stat_t); ok {
+				require.Equal(t, uint64(2), uint64(st.Nlink))
+			}
+		})
+	}
+}
+
+func writeTarGz(t *testing.T, path string, entries ...*tar.Header) {
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for _, hdr := range entries {
+		require.NoError(t, tw.WriteHeader(hdr))
+		if hdr.Size > 0 {
+			_, err := tw.Write(make([]byte, hdr.Size))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+}
+
+func TestTarRestoreRejectsEscapes(t *testing.T) {
+	dir := t.TempDir()
+	slip := filepath.Join(dir, "slip.tar.gz")
+	writeTarGz(t, slip, &tar.Header{Name: "../evil.txt", Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+	require.Error(t, backup.TarGz.Restore(slip, filepath.Join(dir, "out")))
+	_, err := os.Stat(filepath.Join(dir, "evil.txt"))
+	require.True(t, os.IsNotExist(err))
+
+	viaLink := filepath.Join(dir, "link.tar.gz")
+	writeTarGz(t, viaLink,
+		&tar.Header{Name: "up", Linkname: "..", Typeflag: tar.TypeSymlink},
+		&tar.Header{Name: "up/evil.txt", Mode: 0644, Size: 1, Typeflag: tar.TypeReg},
+	)
+	require.Error(t, backup.TarGz.Restore(viaLink, filepath.Join(dir, "out2")))
+	_, err = os.Stat(filepath.Join(dir, "evil.txt"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestTarRestoreKeepsDirectoriesInside(t *testing.T) {
+	dir := t.TempDir()
+	outside := filepath.Join(dir, "outside")
+	require.NoError(t, os.Mkdir(outside, 0700))
+	epoch := time.Unix(0, 0)
+
+	for name, entries := range map[string][]*tar.Header{
+		"dirs below a symlink": {
+			{Name: "a", Linkname: outside, Typeflag: tar.TypeSymlink},
+			{Name: "a/", Mode: 0777, ModTime: epoch, Typeflag: tar.TypeDir},
+			{Name: "a/evil/", Mode: 0777, ModTime: epoch, Typeflag: tar.TypeDir},
+		},
+		"dir replaced by a symlink": {
+			{Name: "a/", Mode: 0777, ModTime: epoch, Typeflag: tar.TypeDir},
+			{Name: "a", Linkname: outside, Typeflag: tar.TypeSymlink},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "evil.tar.gz")
+			writeTarGz(t, archive, entries...)
+			require.Error(t, backup.TarGz.Restore(archive, t.TempDir()))
+
+			info, err := os.Stat(outside)
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0700), info.Mode().Perm())
+			require.False(t, info.ModTime().Equal(epoch))
+			_, err = os.Stat(filepath.Join(outside, "evil"))
+			require.True(t, os.IsNotExist(err))
+		})
+	}
+}
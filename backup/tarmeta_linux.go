@@ -0,0 +1,34 @@
+//go:build linux
+// +build linux
+
+package backup
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// restoreDirMetadata restores the metadata of a directory like
+// restoreMetadata, through a descriptor opened without following
+// symlinks.
+func restoreDirMetadata(target string, hdr *tar.Header) error {
+	f, err := os.OpenFile(target, os.O_RDONLY|syscall.O_DIRECTORY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return fmt.Errorf("restoring directory %q: %w", hdr.Name, err)
+	}
+	defer f.Close()
+	if os.Geteuid() == 0 {
+		if err := f.Chown(hdr.Uid, hdr.Gid); err != nil {
+			return err
+		}
+	}
+	if err := f.Chmod(headerMode(hdr)); err != nil {
+		return err
+	}
+	return syscall.Futimes(int(f.Fd()), []syscall.Timeval{
+		syscall.NsecToTimeval(headerAtime(hdr).UnixNano()),
+		syscall.NsecToTimeval(hdr.ModTime.UnixNano()),
+	})
+}
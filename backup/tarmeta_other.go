@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package backup
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+)
+
+// restoreDirMetadata restores the metadata of a directory like
+// restoreMetadata, once it checked the directory was not replaced. It
+// can not open it without following symlinks on this platform.
+func restoreDirMetadata(target string, hdr *tar.Header) error {
+	info, err := os.Lstat(target)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("restoring directory %q: %s is not a directory", hdr.Name, target)
+	}
+	return restoreMetadata(target, hdr)
+}
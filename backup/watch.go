@@ -0,0 +1,212 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watcher checks the paths of a Monitor when the filesystem reports
+// changes in them instead of polling. A path is checked once no event
+// arrived for it during the Debounce window, and every path is
+// rescanned every Rescan as a safety net for missed events.
+type Watcher struct {
+	Monitor  *Monitor
+	Debounce time.Duration
+	Rescan   time.Duration
+	// OnCheck, if set, is called with the result of every check.
+	OnCheck func(counter int, err error)
+	// Trigger, if set, receives paths to check immediately; an
+	// empty list checks every path. Paths added to the Monitor with
+	// AddPath are watched from the next trigger or rescan on.
+	Trigger <-chan []string
+
+	watched map[string]bool
+	dirs    map[string]bool // the directories added to the watcher
+}
+
+// Run watches the paths until ctx is done.
+func (w *Watcher) Run(ctx context.Context) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+	w.watched = make(map[string]bool)
+	w.dirs = make(map[string]bool)
+	if err := w.watchNew(fw); err != nil {
+		return err
+	}
+	var rescan <-chan time.Time
+	if w.Rescan > 0 {
+		ticker := time.NewTicker(w.Rescan)
+		defer ticker.Stop()
+		rescan = ticker.C
+	}
+	settle := time.NewTimer(time.Hour)
+	settle.Stop()
+	defer settle.Stop()
+	dirty := make(map[string]time.Time)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-fw.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 && w.dirs[ev.Name] {
+				// a moved directory keeps its watches, reporting
+				// events under its old name; it is watched again
+				// when created under the new one
+				if _, err := os.Lstat(ev.Name); os.IsNotExist(err) {
+					w.unwatch(fw, ev.Name)
+				}
+			}
+			root := w.rootOf(ev.Name)
+			if root == "" {
+				continue
+			}
+			if ev.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					// the rules of root are relative to it, watching a
+					// directory too many is harmless
+					if err := w.watchTree(fw, ev.Name, nil); err != nil {
+						w.report(0, err)
+					}
+				}
+			}
+			if len(dirty) == 0 {
+				settle.Reset(w.Debounce)
+			}
+			dirty[root] = time.Now()
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return nil
+			}
+			w.report(0, err)
+		case <-settle.C:
+			var settled []string
+			next := w.Debounce
+			for root, last := range dirty {
+				if quiet := time.Since(last); quiet >= w.Debounce {
+					settled = append(settled, root)
+					delete(dirty, root)
+				} else if w.Debounce-quiet < next {
+					next = w.Debounce - quiet
+				}
+			}
+			if len(dirty) > 0 {
+				settle.Reset(next)
+			}
+			if len(settled) > 0 {
+				w.report(w.Monitor.Check(ctx, settled...))
+			}
+		case <-rescan:
+			if err := w.watchNew(fw); err != nil {
+				w.report(0, err)
+			}
+			w.report(w.Monitor.Now(ctx))
+		case paths := <-w.Trigger:
+			if err := w.watchNew(fw); err != nil {
+				w.report(0, err)
+			}
+			if len(paths) == 0 {
+				w.report(w.Monitor.Now(ctx))
+			} else {
+				w.report(w.Monitor.Check(ctx, paths...))
+			}
+		}
+	}
+}
+
+func (w *Watcher) report(counter int, err error) {
+	if w.OnCheck != nil {
+		w.OnCheck(counter, err)
+	}
+}
+
+// watchNew starts watching the paths of the Monitor that are not
+// watched yet and stops watching the ones removed from it.
+func (w *Watcher) watchNew(fw *fsnotify.Watcher) error {
+	paths := w.Monitor.PathList()
+	current := make(map[string]bool)
+	for _, path := range paths {
+		current[path] = true
+	}
+	for path := range w.watched {
+		if current[path] {
+			continue
+		}
+		delete(w.watched, path)
+		if w.rootOf(path) != "" {
+			continue // still watched as part of another path
+		}
+		w.unwatch(fw, filepath.Clean(path))
+		for _, other := range paths {
+			if isBelow(other, path) {
+				w.watched[other] = false // its watches went too
+			}
+		}
+	}
+	for _, path := range paths {
+		if w.watched[path] {
+			continue
+		}
+		if err := w.watchTree(fw, path, w.Monitor.FilterOf(path)); err != nil {
+			return err
+		}
+		w.watched[path] = true
+	}
+	return nil
+}
+
+// rootOf returns the watched path containing name.
+func (w *Watcher) rootOf(name string) string {
+	for _, path := range w.Monitor.PathList() {
+		if isBelow(name, path) {
+			return path
+		}
+	}
+	return ""
+}
+
+// isBelow tells whether name is dir or inside it.
+func isBelow(name, dir string) bool {
+	name, dir = filepath.Clean(name), filepath.Clean(dir)
+	return name == dir || strings.HasPrefix(name, dir+string(filepath.Separator))
+}
+
+// watchTree adds root and every directory below it not left out by f
+// to the watcher, as inotify watches are not recursive.
+func (w *Watcher) watchTree(fw *fsnotify.Watcher, root string, f *Filter) error {
+	return walkTree(root, f, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if err := fw.Add(path); err != nil {
+			return err
+		}
+		w.dirs[filepath.Clean(path)] = true
+		return nil
+	})
+}
+
+// unwatch removes dir and the directories below it from the watcher.
+// The watches of deleted directories are gone already, so the errors
+// of Remove are not reported.
+func (w *Watcher) unwatch(fw *fsnotify.Watcher, dir string) {
+	for d := range w.dirs {
+		if isBelow(d, dir) {
+			fw.Remove(d)
+			delete(w.dirs, d)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package backup_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bukodi/go-playground/backup"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "alpha")
+	hash, err := backup.DirHash(dir, nil)
+	require.NoError(t, err)
+	a := &TestArchiver{}
+	m := &backup.Monitor{
+		Destination: t.TempDir(),
+		Paths:       map[string]string{dir: hash},
+		Archiver:    a,
+	}
+	checks := make(chan int, 10)
+	w := &backup.Watcher{
+		Monitor:  m,
+		Debounce: 100 * time.Millisecond,
+		OnCheck: func(counter int, err error) {
+			require.NoError(t, err)
+			checks <- counter
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+	time.Sleep(50 * time.Millisecond) // let the watches be set up
+
+	// a burst of writes, including a new sub directory, is archived once
+	for i := 0; i < 5; i++ {
+		writeTestFile(t, filepath.Join(dir, "a.txt"), fmt.Sprint("alpha ", i))
+		time.Sleep(10 * time.Millisecond)
+	}
+	writeTestFile(t, filepath.Join(dir, "sub", "b.txt"), "beta")
+	select {
+	case n := <-checks:
+		require.Equal(t, 1, n)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no check after changes")
+	}
+	select {
+	case n := <-checks:
+		t.Fatalf("unexpected second check archiving %d", n)
+	case <-time.After(300 * time.Millisecond):
+	}
+	require.Len(t, a.Archives, 1)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestWatcherFollowsMovedDirs(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "sub", "deep", "a.txt"), "alpha")
+	hash, err := backup.DirHash(dir, nil)
+	require.NoError(t, err)
+	m := &backup.Monitor{
+		Destination: t.TempDir(),
+		Paths:       map[string]string{dir: hash},
+		Archiver:    &TestArchiver{},
+	}
+	checks := make(chan int, 10)
+	w := &backup.Watcher{
+		Monitor:  m,
+		Debounce: 100 * time.Millisecond,
+		OnCheck: func(counter int, err error) {
+			require.NoError(t, err)
+			checks <- counter
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+	time.Sleep(50 * time.Millisecond) // let the watches be set up
+
+	// the watches of the old name are dropped, the new name is watched
+	require.NoError(t, os.Rename(filepath.Join(dir, "sub"), filepath.Join(dir, "moved")))
+	for _, name := range []string{"b.txt", "c.txt"} {
+		select {
+		case n := <-checks:
+			require.Equal(t, 1, n)
+		case <-time.After(2 * time.Second):
+			t.Fatal("no check after changes")
+		}
+		writeTestFile(t, filepath.Join(dir, "moved", "deep", name), "beta")
+	}
+	select {
+	case n := <-checks:
+		require.Equal(t, 1, n)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no check after a change in a moved directory")
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+}
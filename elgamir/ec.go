@@ -0,0 +1,153 @@
+package elgamir
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/group/edwards25519"
+	"go.dedis.ch/kyber/v3/group/nist"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+// ECPara runs the scheme of ElgamalPara over an elliptic curve group:
+// public key shares and cipher shares are points, private key shares
+// scalars, and the message is embedded into a point. The groups are
+// fixed, there is no slow Setup.
+type ECPara struct {
+	Group kyber.Group
+}
+
+// P256 returns the parameters over the NIST P-256 curve.
+func P256() ECPara {
+	return ECPara{Group: nist.NewBlakeSHA256P256()}
+}
+
+// Ed25519 returns the parameters over the edwards25519 curve.
+func Ed25519() ECPara {
+	return ECPara{Group: edwards25519.NewBlakeSHA256Ed25519()}
+}
+
+type ECKeyShare struct {
+	ecPrivKeyShare
+	ECPubKeyShare
+}
+
+type ecPrivKeyShare struct {
+	X *big.Int
+	Y kyber.Scalar
+}
+
+type ECPubKeyShare struct {
+	X *big.Int
+	Y kyber.Point
+}
+
+type ECCipher struct {
+	C1 kyber.Point
+	C2 kyber.Point
+	C3 []ECPubKeyShare
+}
+
+// MaxMessageLen is the longest message a point of the group can hold.
+func (para ECPara) MaxMessageLen() int {
+	return para.Group.Point().EmbedLen()
+}
+
+// scalar returns x, a share index, as a scalar of the group.
+func (para ECPara) scalar(x *big.Int) kyber.Scalar {
+	return para.Group.Scalar().SetInt64(x.Int64())
+}
+
+func (para ECPara) interpolate(shareX *big.Int, shares []ECPubKeyShare) ECPubKeyShare {
+	shareY := para.Group.Point().Null()
+	for _, sharei := range shares {
+		xa := para.scalar(sharei.X)
+		weight := para.Group.Scalar().One()
+		for _, sharej := range shares {
+			if sharei.X.Cmp(sharej.X) != 0 {
+				xb := para.scalar(sharej.X)
+				top := para.Group.Scalar().Sub(para.scalar(shareX), xb)
+				bottom := para.Group.Scalar().Sub(xa, xb)
+				weight.Mul(weight, para.Group.Scalar().Div(top, bottom))
+			}
+		}
+		shareY.Add(shareY, para.Group.Point().Mul(weight, sharei.Y))
+	}
+
+	return ECPubKeyShare{X: shareX, Y: shareY}
+}
+
+func (para ECPara) ShareKeyGen(shareX *big.Int) (ECKeyShare, error) {
+	if !shareX.IsInt64() {
+		return ECKeyShare{}, fmt.Errorf("elgamir: share index %v too large", shareX)
+	}
+	share := para.Group.Scalar().Pick(random.New())
+	gshare := para.Group.Point().Mul(share, nil)
+
+	return ECKeyShare{ecPrivKeyShare{X: shareX, Y: share}, ECPubKeyShare{X: shareX, Y: gshare}}, nil
+}
+
+func (para ECPara) getPubkey(shares []ECPubKeyShare) (kyber.Point, []ECPubKeyShare, error) {
+	secret := para.Group.Scalar().Pick(random.New())
+	shareLen := len(shares)
+
+	share0X := big.NewInt(0)
+	share0Y := para.Group.Point().Mul(secret, nil)
+	shares = append(shares[:shareLen:shareLen], ECPubKeyShare{X: share0X, Y: share0Y})
+
+	newShares := make([]ECPubKeyShare, 0)
+	for i := 0; i < shareLen; i++ {
+		newShares = append(newShares, para.interpolate(big.NewInt(int64(ReserveIdx+i)), shares))
+	}
+
+	recovershares := append(newShares[:shareLen:shareLen], shares[0])
+	recover := para.interpolate(big.NewInt(0x00), recovershares)
+	if !recover.Y.Equal(share0Y) {
+		return nil, []ECPubKeyShare{}, errors.New("getPubkey: recover secret failed.")
+	}
+
+	return share0Y, newShares, nil
+}
+
+func (para ECPara) getPrivkey(privShare ecPrivKeyShare, c ECCipher) kyber.Point {
+	y := para.Group.Point().Mul(privShare.Y, c.C1)
+	points := append(c.C3[:len(c.C3):len(c.C3)], ECPubKeyShare{X: privShare.X, Y: y})
+	secret := para.interpolate(big.NewInt(0x00), points)
+
+	return secret.Y
+}
+
+// Encrypt encrypts msg, of at most MaxMessageLen bytes, for any one of
+// the holders of shares.
+func (para ECPara) Encrypt(shares []ECPubKeyShare, msg []byte) (ECCipher, error) {
+	if len(msg) > para.MaxMessageLen() {
+		return ECCipher{}, ErrMessageRange
+	}
+	pubkey, newShares, err := para.getPubkey(shares)
+	if err != nil {
+		return ECCipher{}, errors.New("genPubkey error")
+	}
+	y := para.Group.Scalar().Pick(random.New())
+
+	c := ECCipher{}
+	c.C1 = para.Group.Point().Mul(y, nil)
+	s := para.Group.Point().Mul(y, pubkey)
+	m := para.Group.Point().Embed(msg, random.New())
+	c.C2 = para.Group.Point().Add(s, m)
+	c.C3 = make([]ECPubKeyShare, 0)
+	for _, share := range newShares {
+		cshare := para.Group.Point().Mul(y, share.Y)
+		c.C3 = append(c.C3, ECPubKeyShare{X: share.X, Y: cshare})
+	}
+
+	return c, nil
+}
+
+func (para ECPara) Decrypt(privShare ecPrivKeyShare, c ECCipher) ([]byte, error) {
+	s := para.getPrivkey(privShare, c)
+	m := para.Group.Point().Sub(c.C2, s)
+
+	return m.Data()
+}
@@ -0,0 +1,70 @@
+package elgamir
+
+import (
+	"bytes"
+	"math/big"
+	mrand "math/rand"
+	"testing"
+	"time"
+)
+
+func TestECElgamir(t *testing.T) {
+	for name, para := range map[string]ECPara{"P256": P256(), "Ed25519": Ed25519()} {
+		t.Run(name, func(t *testing.T) {
+			_, dealer, shares := setupEC(para, 100, 10)
+			for _, msg := range [][]byte{[]byte("Hello"), {0, 0, 1}, {}, bytes.Repeat([]byte{0xff}, para.MaxMessageLen())} {
+				c, err := para.Encrypt(shares, msg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				m, err := para.Decrypt(dealer.ecPrivKeyShare, c)
+				if err != nil || !bytes.Equal(m, msg) {
+					t.Errorf("Decrypt() = %x, %v, want %x", m, err, msg)
+				}
+				other, _ := para.ShareKeyGen(dealer.ECPubKeyShare.X)
+				if m, _ := para.Decrypt(other.ecPrivKeyShare, c); bytes.Equal(m, msg) && len(msg) > 0 {
+					t.Errorf("decrypted with a key share not encrypted for")
+				}
+			}
+			if _, err := para.Encrypt(shares, make([]byte, para.MaxMessageLen()+1)); err != ErrMessageRange {
+				t.Errorf("Encrypt() of a long message = %v", err)
+			}
+		})
+	}
+}
+
+func BenchmarkElgamirP256(b *testing.B)    { benchmarkEC(b, P256()) }
+func BenchmarkElgamirEd25519(b *testing.B) { benchmarkEC(b, Ed25519()) }
+
+func benchmarkEC(b *testing.B, para ECPara) {
+	para, dealer, shares := setupEC(para, 100, 10)
+	msg := []byte("Hello")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c, _ := para.Encrypt(shares, msg)
+		para.Decrypt(dealer.ecPrivKeyShare, c)
+	}
+}
+
+// setupEC picks n of N key share holders, one of them the dealer, as
+// setup does.
+func setupEC(para ECPara, N, n int) (ECPara, ECKeyShare, []ECPubKeyShare) {
+	r := mrand.New(mrand.NewSource(time.Now().UnixNano()))
+	AllShares := make([]ECKeyShare, 0)
+	for k := 1; k <= N; k++ {
+		share, err := para.ShareKeyGen(big.NewInt(int64(UserIdx + k)))
+		if err != nil {
+			panic(err)
+		}
+		AllShares = append(AllShares, share)
+	}
+
+	perm := r.Perm(N)
+	dealer := AllShares[perm[0]]
+	shares := make([]ECPubKeyShare, 0)
+	for _, index := range perm[:n] {
+		shares = append(shares, AllShares[index].ECPubKeyShare)
+	}
+
+	return para, dealer, shares
+}
@@ -3,10 +3,9 @@ package elgamir
 import (
 	"crypto/rand"
 	"errors"
+	"fmt"
 	"io"
 	"math/big"
-	mrand "math/rand"
-	"time"
 )
 
 var (
@@ -31,8 +30,16 @@ type ElCipher struct {
 	C1 *big.Int
 	C2 *big.Int
 	C3 []PubKeyShare
+	// Holders are the key shares the cipher was encrypted for. They
+	// come with the cipher, so partial decryptions are checked against
+	// the shares the decrypting party knows instead.
+	Holders []PubKeyShare
 }
 
+// ErrMessageRange is the error of encrypting a message that is not a
+// number between 1 and P-1.
+var ErrMessageRange = errors.New("elgamir: message out of range")
+
 type ElgamalPara struct {
 	ElgamalP *big.Int
 	ElgamalG *big.Int
@@ -43,7 +50,10 @@ type ElgamalPara struct {
 func Setup(ParamLen int) (ElgamalPara, error) {
 	para := ElgamalPara{}
 	for {
-		para.ElgamalP, _ = rand.Prime(rand.Reader, ParamLen*8)
+		var err error
+		if para.ElgamalP, err = rand.Prime(rand.Reader, ParamLen*8); err != nil {
+			return ElgamalPara{}, err
+		}
 		para.ElgamalQ = new(big.Int).Sub(para.ElgamalP, big.NewInt(1))
 		para.ElgamalQ = new(big.Int).Div(para.ElgamalQ, big.NewInt(2))
 		ok := para.ElgamalQ.ProbablyPrime(50)
@@ -73,6 +83,39 @@ func Setup(ParamLen int) (ElgamalPara, error) {
 	return para, nil
 }
 
+// Validate checks that P is a safe prime 2Q+1, that G generates the
+// subgroup of order Q and, if ParamLen is set, that P has ParamLen
+// bytes, so messages of up to ParamLen-1 bytes are in range.
+func (para *ElgamalPara) Validate() error {
+	if para.ElgamalP == nil || para.ElgamalQ == nil || para.ElgamalG == nil {
+		return errors.New("elgamir: missing parameter")
+	}
+	p := new(big.Int).Lsh(para.ElgamalQ, 1)
+	if p.Add(p, big.NewInt(1)).Cmp(para.ElgamalP) != 0 {
+		return errors.New("elgamir: P is not 2Q+1")
+	}
+	if !para.ElgamalQ.ProbablyPrime(20) || !para.ElgamalP.ProbablyPrime(20) {
+		return errors.New("elgamir: P is not a safe prime")
+	}
+	if para.ElgamalG.Cmp(big.NewInt(1)) <= 0 || para.ElgamalG.Cmp(para.ElgamalP) >= 0 ||
+		new(big.Int).Exp(para.ElgamalG, para.ElgamalQ, para.ElgamalP).Cmp(big.NewInt(1)) != 0 {
+		return errors.New("elgamir: G does not generate the subgroup of order Q")
+	}
+	if para.ParamLen != 0 && para.ParamLen*8 != para.ElgamalP.BitLen() {
+		return fmt.Errorf("elgamir: P does not have ParamLen %d bytes", para.ParamLen)
+	}
+	return nil
+}
+
+// randomExponent returns a secret exponent, between 1 and Q-1.
+func (para *ElgamalPara) randomExponent() (*big.Int, error) {
+	k, err := rand.Int(rand.Reader, new(big.Int).Sub(para.ElgamalQ, big.NewInt(1)))
+	if err != nil {
+		return nil, err
+	}
+	return k.Add(k, big.NewInt(1)), nil
+}
+
 func (para *ElgamalPara) interpolate(shareX *big.Int, shares []PubKeyShare) PubKeyShare {
 	shareY := big.NewInt(1)
 	for _, sharei := range shares {
@@ -100,17 +143,21 @@ func (para *ElgamalPara) interpolate(shareX *big.Int, shares []PubKeyShare) PubK
 	return PubKeyShare{X: shareX, Y: shareY}
 }
 
-func (para *ElgamalPara) ShareKeyGen(shareX *big.Int) KeyShare {
-	r := mrand.New(mrand.NewSource(time.Now().UnixNano()))
-	share := new(big.Int).Rand(r, para.ElgamalQ)
+func (para *ElgamalPara) ShareKeyGen(shareX *big.Int) (KeyShare, error) {
+	share, err := para.randomExponent()
+	if err != nil {
+		return KeyShare{}, err
+	}
 	gshare := new(big.Int).Exp(para.ElgamalG, share, para.ElgamalP)
 
-	return KeyShare{privKeyShare{X: shareX, Y: share}, PubKeyShare{X: shareX, Y: gshare}}
+	return KeyShare{privKeyShare{X: shareX, Y: share}, PubKeyShare{X: shareX, Y: gshare}}, nil
 }
 
 func (para *ElgamalPara) getPubkey(shares []PubKeyShare) (*big.Int, []PubKeyShare, error) {
-	r := mrand.New(mrand.NewSource(time.Now().UnixNano()))
-	secret := new(big.Int).Rand(r, para.ElgamalQ)
+	secret, err := para.randomExponent()
+	if err != nil {
+		return nil, []PubKeyShare{}, err
+	}
 	shareLen := len(shares)
 
 	share0X := big.NewInt(0)
@@ -139,24 +186,33 @@ func (para *ElgamalPara) getPrivkey(privShare privKeyShare, c ElCipher) *big.Int
 	return secret.Y
 }
 
+// Encrypt encrypts msg, a number between 1 and P-1 in big-endian
+// bytes, for any one of the holders of shares.
 func (para *ElgamalPara) Encrypt(shares []PubKeyShare, msg []byte) (ElCipher, error) {
+	m := new(big.Int).SetBytes(msg)
+	if m.Sign() == 0 || m.Cmp(para.ElgamalP) >= 0 {
+		return ElCipher{}, ErrMessageRange
+	}
 	pubkey, newShares, err := para.getPubkey(shares)
 	if err != nil {
 		return ElCipher{}, errors.New("genPubkey error")
 	}
-	r := mrand.New(mrand.NewSource(time.Now().UnixNano()))
-	y := new(big.Int).Rand(r, para.ElgamalQ)
+	y, err := para.randomExponent()
+	if err != nil {
+		return ElCipher{}, err
+	}
 
 	c := ElCipher{}
 	c.C1 = new(big.Int).Exp(para.ElgamalG, y, para.ElgamalP)
 	s := new(big.Int).Exp(pubkey, y, para.ElgamalP)
-	c.C2 = new(big.Int).Mul(s, new(big.Int).SetBytes(msg))
+	c.C2 = new(big.Int).Mul(s, m)
 	c.C2 = new(big.Int).Mod(c.C2, para.ElgamalP)
 	c.C3 = make([]PubKeyShare, 0)
 	for _, share := range newShares {
 		cshare := new(big.Int).Exp(share.Y, y, para.ElgamalP)
 		c.C3 = append(c.C3, PubKeyShare{X: share.X, Y: cshare})
 	}
+	c.Holders = append([]PubKeyShare(nil), shares...)
 
 	return c, nil
 }
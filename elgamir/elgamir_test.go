@@ -41,13 +41,14 @@ func BenchmarkElgamir(b *testing.B) {
 func setup(keylen, N, n int) (ElgamalPara, KeyShare, []PubKeyShare) {
 	r := mrand.New(mrand.NewSource(time.Now().UnixNano()))
 	//	para, _ := Setup(keylen)
-	para := ElgamalPara{}
-	para.ElgamalP, _ = new(big.Int).SetString("28706579328304107441157390960522516745991328987267169907213238450202556097050268798931456180029000306395920868596709135397849226662813103502469766662758538110975099501099052626153653451212433856686668297636228101951175623648962902359899151779811654298227306927301177760981527404883586478179201056326998695026626273983096328388390121895455142569756309313343662916200070757320147700110739019605524602059258364589574081170904741560685444345267738234723219200159596710232461473008859111244479445417890841916489644861189868796991588594738043928870199236401834835729554321765924198333617759270240215068784940659854030879563", 10)
-	para.ElgamalG, _ = new(big.Int).SetString("14009101129438775102184556184153012228558421520025637101641843300958316362751565259685156962131597104772165464054598383826555070507993549230873097420101869952655612727656037655228637493720110211155695533759046221097415505806959605718942056919707332893772880626702656932581522488192647146234300229364851314962898715236308569194498729907621456800882827547995224799553713308544518886608541782289554230872263846805522260454561978123848243623169285015904556573134807040851325561204048280366304397250706170527830779313939951673370322645217788249244407660281011694858047372355624011098642693715667920742960934800525133037161", 10)
-	para.ElgamalQ, _ = new(big.Int).SetString("14353289664152053720578695480261258372995664493633584953606619225101278048525134399465728090014500153197960434298354567698924613331406551751234883331379269055487549750549526313076826725606216928343334148818114050975587811824481451179949575889905827149113653463650588880490763702441793239089600528163499347513313136991548164194195060947727571284878154656671831458100035378660073850055369509802762301029629182294787040585452370780342722172633869117361609600079798355116230736504429555622239722708945420958244822430594934398495794297369021964435099618200917417864777160882962099166808879635120107534392470329927015439781", 10)
+	para := testPara()
 	AllShares := make([]KeyShare, 0)
 	for k := 1; k <= N; k++ {
-		AllShares = append(AllShares, para.ShareKeyGen(big.NewInt(int64(UserIdx+k))))
+		share, err := para.ShareKeyGen(big.NewInt(int64(UserIdx + k)))
+		if err != nil {
+			panic(err)
+		}
+		AllShares = append(AllShares, share)
 	}
 
 	dealer := AllShares[r.Intn(N)]
@@ -83,3 +84,68 @@ func testDecrypt(para ElgamalPara, c ElCipher, shares privKeyShare) []byte {
 	m := para.Decrypt(shares, c)
 	return m
 }
+
+// testPara returns fixed parameters, as Setup takes long.
+func testPara() ElgamalPara {
+	para := ElgamalPara{}
+	para.ElgamalP, _ = new(big.Int).SetString("28706579328304107441157390960522516745991328987267169907213238450202556097050268798931456180029000306395920868596709135397849226662813103502469766662758538110975099501099052626153653451212433856686668297636228101951175623648962902359899151779811654298227306927301177760981527404883586478179201056326998695026626273983096328388390121895455142569756309313343662916200070757320147700110739019605524602059258364589574081170904741560685444345267738234723219200159596710232461473008859111244479445417890841916489644861189868796991588594738043928870199236401834835729554321765924198333617759270240215068784940659854030879563", 10)
+	para.ElgamalG, _ = new(big.Int).SetString("14009101129438775102184556184153012228558421520025637101641843300958316362751565259685156962131597104772165464054598383826555070507993549230873097420101869952655612727656037655228637493720110211155695533759046221097415505806959605718942056919707332893772880626702656932581522488192647146234300229364851314962898715236308569194498729907621456800882827547995224799553713308544518886608541782289554230872263846805522260454561978123848243623169285015904556573134807040851325561204048280366304397250706170527830779313939951673370322645217788249244407660281011694858047372355624011098642693715667920742960934800525133037161", 10)
+	para.ElgamalQ, _ = new(big.Int).SetString("14353289664152053720578695480261258372995664493633584953606619225101278048525134399465728090014500153197960434298354567698924613331406551751234883331379269055487549750549526313076826725606216928343334148818114050975587811824481451179949575889905827149113653463650588880490763702441793239089600528163499347513313136991548164194195060947727571284878154656671831458100035378660073850055369509802762301029629182294787040585452370780342722172633869117361609600079798355116230736504429555622239722708945420958244822430594934398495794297369021964435099618200917417864777160882962099166808879635120107534392470329927015439781", 10)
+	return para
+}
+
+func TestValidate(t *testing.T) {
+	para := testPara()
+	if err := para.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	generated, err := Setup(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := generated.Validate(); err != nil {
+		t.Errorf("Validate() of Setup = %v", err)
+	}
+	for name, f := range map[string]func(p *ElgamalPara){
+		"missing G":  func(p *ElgamalPara) { p.ElgamalG = nil },
+		"P not 2Q+1": func(p *ElgamalPara) { p.ElgamalP = new(big.Int).Add(p.ElgamalP, big.NewInt(2)) },
+		"Q not prime": func(p *ElgamalPara) {
+			p.ElgamalQ = new(big.Int).Add(p.ElgamalQ, big.NewInt(1))
+			p.ElgamalP = new(big.Int).Add(p.ElgamalP, big.NewInt(2))
+		},
+		"G is 1":       func(p *ElgamalPara) { p.ElgamalG = big.NewInt(1) },
+		"G above P":    func(p *ElgamalPara) { p.ElgamalG = new(big.Int).Add(p.ElgamalP, big.NewInt(4)) },
+		"G order 2Q":   func(p *ElgamalPara) { p.ElgamalG = new(big.Int).Sub(p.ElgamalP, p.ElgamalG) },
+		"G order 2":    func(p *ElgamalPara) { p.ElgamalG = new(big.Int).Sub(p.ElgamalP, big.NewInt(1)) },
+		"wrong length": func(p *ElgamalPara) { p.ParamLen = 128 },
+	} {
+		p := testPara()
+		f(&p)
+		if err := p.Validate(); err == nil {
+			t.Errorf("%s: Validate() accepted the parameters", name)
+		}
+	}
+}
+
+func TestEncryptRange(t *testing.T) {
+	para, dealer, shares := setup(2, 100, 10)
+	for _, msg := range []*big.Int{big.NewInt(0), para.ElgamalP, new(big.Int).Add(para.ElgamalP, big.NewInt(1))} {
+		if _, err := para.Encrypt(shares, msg.Bytes()); err != ErrMessageRange {
+			t.Errorf("Encrypt(%v) error = %v", msg, err)
+		}
+	}
+	msg := new(big.Int).Sub(para.ElgamalP, big.NewInt(1))
+	c, err := para.Encrypt(shares, msg.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := para.Decrypt(dealer.privKeyShare, c); msg.Cmp(new(big.Int).SetBytes(m)) != 0 {
+		t.Errorf("P-1 not decrypted")
+	}
+
+	a, _ := para.ShareKeyGen(big.NewInt(1))
+	b, _ := para.ShareKeyGen(big.NewInt(1))
+	if a.privKeyShare.Y.Cmp(b.privKeyShare.Y) == 0 {
+		t.Errorf("ShareKeyGen made the same key twice")
+	}
+}
@@ -0,0 +1,250 @@
+package elgamir
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// In hybrid mode the ElGamal cipher only carries a random element of
+// the group, the key material; the message itself, of any length, is
+// sealed with AES-256-GCM under a key derived from it with HKDF.
+
+// HybridVersion is the version of the hybrid ciphers made.
+const HybridVersion = 1
+
+var ErrAuthentication = errors.New("elgamir: message authentication failed")
+
+// nonceSize is the length of the nonces of AES-GCM.
+const nonceSize = 12
+
+// hybridInfo binds the derived keys to their use.
+var hybridInfo = []byte("elgamir hybrid v1 aes-256-gcm")
+
+// HybridCipher is a message sealed under a key encapsulated in Key.
+// Its binary form starts with the version and authenticates all but
+// the sealed data as well.
+type HybridCipher struct {
+	Version byte
+	Key     ElCipher
+	Nonce   []byte
+	Data    []byte // the sealed message and its tag
+}
+
+// EncryptHybrid encrypts msg for the holders of shares, t of whom are
+// needed to decrypt it.
+func (para *ElgamalPara) EncryptHybrid(shares []PubKeyShare, t int, msg []byte) (HybridCipher, error) {
+	k, err := para.randomExponent()
+	if err != nil {
+		return HybridCipher{}, err
+	}
+	secret := new(big.Int).Exp(para.ElgamalG, k, para.ElgamalP)
+	key, err := para.EncryptThreshold(shares, t, secret.Bytes())
+	if err != nil {
+		return HybridCipher{}, err
+	}
+	c := HybridCipher{Version: HybridVersion, Key: key, Nonce: make([]byte, nonceSize)}
+	if _, err := io.ReadFull(rand.Reader, c.Nonce); err != nil {
+		return HybridCipher{}, err
+	}
+	aead, err := para.hybridAEAD(secret)
+	if err != nil {
+		return HybridCipher{}, err
+	}
+	c.Data = aead.Seal(nil, c.Nonce, msg, c.header())
+	return c, nil
+}
+
+// DecryptHybrid decrypts c as the holder of share, if one holder is
+// enough.
+func (para *ElgamalPara) DecryptHybrid(share KeyShare, c HybridCipher) ([]byte, error) {
+	if c.Version != HybridVersion {
+		return nil, fmt.Errorf("elgamir: unknown hybrid cipher version %d", c.Version)
+	}
+	if err := para.checkCipher(c.Key, []PubKeyShare{share.PubKeyShare}); err != nil {
+		return nil, err
+	}
+	secret := new(big.Int).SetBytes(para.Decrypt(share.privKeyShare, c.Key))
+	return para.open(secret, c)
+}
+
+// CombineHybrid decrypts c with t partial decryptions of c.Key by
+// holders, as Combine does.
+func (para *ElgamalPara) CombineHybrid(holders []PubKeyShare, c HybridCipher, partials []PartialDecryption, t int) ([]byte, error) {
+	if c.Version != HybridVersion {
+		return nil, fmt.Errorf("elgamir: unknown hybrid cipher version %d", c.Version)
+	}
+	secret, err := para.Combine(holders, c.Key, partials, t)
+	if err != nil {
+		return nil, err
+	}
+	return para.open(new(big.Int).SetBytes(secret), c)
+}
+
+func (para *ElgamalPara) open(secret *big.Int, c HybridCipher) ([]byte, error) {
+	if len(c.Nonce) != nonceSize {
+		return nil, fmt.Errorf("elgamir: nonce of %d bytes", len(c.Nonce))
+	}
+	aead, err := para.hybridAEAD(secret)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := aead.Open(nil, c.Nonce, c.Data, c.header())
+	if err != nil {
+		return nil, ErrAuthentication
+	}
+	return msg, nil
+}
+
+// hybridAEAD returns the AES-GCM of the key derived from secret,
+// padded to the size of P.
+func (para *ElgamalPara) hybridAEAD(secret *big.Int) (cipher.AEAD, error) {
+	if secret.Sign() <= 0 || secret.Cmp(para.ElgamalP) >= 0 {
+		return nil, ErrAuthentication
+	}
+	ikm := secret.FillBytes(make([]byte, (para.ElgamalP.BitLen()+7)/8))
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, nil, hybridInfo), key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// MarshalBinary encodes c as its version followed by the fields, each
+// number and byte string prefixed with its length.
+func (c HybridCipher) MarshalBinary() ([]byte, error) {
+	b := bytes.NewBuffer(c.header())
+	putBytes(b, c.Data)
+	return b.Bytes(), nil
+}
+
+// UnmarshalBinary decodes c from the form of MarshalBinary.
+func (c *HybridCipher) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("elgamir: empty hybrid cipher")
+	}
+	if data[0] != HybridVersion {
+		return fmt.Errorf("elgamir: unknown hybrid cipher version %d", data[0])
+	}
+	r := &decoder{data: data[1:]}
+	d := HybridCipher{Version: data[0]}
+	d.Key.C1 = r.int()
+	d.Key.C2 = r.int()
+	d.Key.C3 = r.shares()
+	d.Key.Holders = r.shares()
+	d.Nonce = r.bytes()
+	d.Data = r.bytes()
+	if r.err == nil && len(r.data) > 0 {
+		r.err = errors.New("trailing data")
+	}
+	if r.err == nil && len(d.Nonce) != nonceSize {
+		r.err = fmt.Errorf("nonce of %d bytes", len(d.Nonce))
+	}
+	if r.err != nil {
+		return fmt.Errorf("elgamir: invalid hybrid cipher: %w", r.err)
+	}
+	*c = d
+	return nil
+}
+
+// header encodes all but the sealed data.
+func (c HybridCipher) header() []byte {
+	var b bytes.Buffer
+	b.WriteByte(c.Version)
+	putInt(&b, c.Key.C1)
+	putInt(&b, c.Key.C2)
+	putShares(&b, c.Key.C3)
+	putShares(&b, c.Key.Holders)
+	putBytes(&b, c.Nonce)
+	return b.Bytes()
+}
+
+func putBytes(b *bytes.Buffer, v []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(v)))
+	b.Write(n[:])
+	b.Write(v)
+}
+
+func putInt(b *bytes.Buffer, v *big.Int) {
+	if v == nil {
+		v = new(big.Int)
+	}
+	putBytes(b, v.Bytes())
+}
+
+func putShares(b *bytes.Buffer, shares []PubKeyShare) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(shares)))
+	b.Write(n[:])
+	for _, share := range shares {
+		putInt(b, share.X)
+		putInt(b, share.Y)
+	}
+}
+
+// decoder reads the fields of MarshalBinary, keeping the first error.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (r *decoder) uint32() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) < 4 {
+		r.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	n := binary.BigEndian.Uint32(r.data)
+	r.data = r.data[4:]
+	return n
+}
+
+func (r *decoder) bytes() []byte {
+	n := r.uint32()
+	if r.err != nil {
+		return nil
+	}
+	if uint32(len(r.data)) < n {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	v := append([]byte{}, r.data[:n]...)
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *decoder) int() *big.Int {
+	return new(big.Int).SetBytes(r.bytes())
+}
+
+func (r *decoder) shares() []PubKeyShare {
+	n := r.uint32()
+	// every share takes at least 8 bytes
+	if r.err == nil && uint32(len(r.data))/8 < n {
+		r.err = io.ErrUnexpectedEOF
+	}
+	if r.err != nil {
+		return nil
+	}
+	shares := make([]PubKeyShare, 0, n)
+	for i := uint32(0); i < n; i++ {
+		shares = append(shares, PubKeyShare{X: r.int(), Y: r.int()})
+	}
+	return shares
+}
@@ -0,0 +1,118 @@
+package elgamir
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestHybrid(t *testing.T) {
+	para := testPara()
+	keys, shares := holders(para, 3)
+	dealer := keys[1]
+	large := make([]byte, 1<<20)
+	rand.Read(large)
+	for _, msg := range [][]byte{nil, {0}, []byte("\x00\x00leading zeros"), large} {
+		c, err := para.EncryptHybrid(shares, 1, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := c.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded HybridCipher
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if again, _ := decoded.MarshalBinary(); !bytes.Equal(again, data) {
+			t.Errorf("encoding of %d bytes changed by a round trip", len(msg))
+		}
+		got, err := para.DecryptHybrid(dealer, decoded)
+		if err != nil || !bytes.Equal(got, msg) {
+			t.Errorf("DecryptHybrid() of %d bytes = %d bytes, %v", len(msg), len(got), err)
+		}
+	}
+}
+
+func TestHybridThreshold(t *testing.T) {
+	para := testPara()
+	keys, pubs := holders(para, 3)
+	msg := []byte("\x00secret of two")
+	c, err := para.EncryptHybrid(pubs, 2, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := para.DecryptHybrid(keys[0], c); err != ErrAuthentication {
+		t.Errorf("DecryptHybrid() by one of two = %v", err)
+	}
+	var partials []PartialDecryption
+	for _, key := range keys[1:] {
+		p, err := para.PartialDecrypt(key, c.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		partials = append(partials, p)
+	}
+	if got, err := para.CombineHybrid(pubs, c, partials, 2); err != nil || !bytes.Equal(got, msg) {
+		t.Errorf("CombineHybrid() = %q, %v", got, err)
+	}
+}
+
+func TestHybridTampered(t *testing.T) {
+	para := testPara()
+	keys, shares := holders(para, 3)
+	dealer := keys[1]
+	c, err := para.EncryptHybrid(shares, 1, []byte("message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := c.MarshalBinary()
+	for i := 1; i < len(data); i += 97 {
+		tampered := append([]byte{}, data...)
+		tampered[i] ^= 1
+		var d HybridCipher
+		if err := d.UnmarshalBinary(tampered); err != nil {
+			continue // a length was hit
+		}
+		if _, err := para.DecryptHybrid(dealer, d); err == nil {
+			t.Errorf("tampered byte %d of %d not detected", i, len(data))
+		}
+	}
+	for name, data := range map[string][]byte{
+		"empty":     {},
+		"version":   append([]byte{HybridVersion + 1}, data[1:]...),
+		"truncated": data[:len(data)-1],
+		"trailing":  append(append([]byte{}, data...), 0),
+	} {
+		var d HybridCipher
+		if err := d.UnmarshalBinary(data); err == nil {
+			t.Errorf("%s: UnmarshalBinary() accepted it", name)
+		}
+	}
+	zero := c
+	zero.Key.C1 = new(big.Int)
+	if _, err := para.DecryptHybrid(dealer, zero); err == nil {
+		t.Errorf("DecryptHybrid() accepted C1 = 0")
+	}
+	short := c
+	short.Nonce = nil
+	if _, err := para.DecryptHybrid(dealer, short); err == nil {
+		t.Errorf("DecryptHybrid() accepted an empty nonce")
+	}
+	if data, _ := short.MarshalBinary(); new(HybridCipher).UnmarshalBinary(data) == nil {
+		t.Errorf("UnmarshalBinary() accepted an empty nonce")
+	}
+	congruent := c
+	congruent.Key.C3 = append([]PubKeyShare(nil), c.Key.C3...)
+	congruent.Key.C3[1].X = new(big.Int).Add(c.Key.C3[0].X, para.ElgamalQ)
+	if _, err := para.DecryptHybrid(dealer, congruent); err == nil {
+		t.Errorf("DecryptHybrid() accepted shares congruent mod Q")
+	}
+	c.Version = HybridVersion + 1
+	if _, err := para.DecryptHybrid(dealer, c); err == nil || errors.Is(err, ErrAuthentication) {
+		t.Errorf("DecryptHybrid() of version %d = %v", c.Version, err)
+	}
+}
@@ -0,0 +1,187 @@
+package elgamir
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// A cipher of EncryptThreshold with threshold t carries n+1-t points
+// of the polynomial through the n share holders, so that any t of the
+// holders can add theirs and interpolate the decryption key, while
+// fewer can not. Encrypt is the threshold 1.
+
+var (
+	ErrNotEnoughPartials = errors.New("elgamir: not enough partial decryptions")
+	ErrInvalidPartial    = errors.New("elgamir: invalid partial decryption")
+)
+
+// PartialDecryption is the part of a share holder in decrypting a
+// cipher: C1 raised to its private key share, and the proof of that.
+type PartialDecryption struct {
+	X     *big.Int
+	D     *big.Int
+	Proof DLEQProof
+}
+
+// DLEQProof is a non-interactive Chaum-Pedersen proof that two values
+// are the powers of ElgamalG and of C1 to the same exponent.
+type DLEQProof struct {
+	E, Z *big.Int
+}
+
+// EncryptThreshold encrypts msg for the holders of shares, t of whom
+// are needed to decrypt it.
+func (para *ElgamalPara) EncryptThreshold(shares []PubKeyShare, t int, msg []byte) (ElCipher, error) {
+	if t < 1 || t > len(shares) {
+		return ElCipher{}, fmt.Errorf("elgamir: threshold %d out of 1..%d", t, len(shares))
+	}
+	c, err := para.Encrypt(shares, msg)
+	if err != nil {
+		return ElCipher{}, err
+	}
+	c.C3 = c.C3[:len(shares)+1-t]
+	return c, nil
+}
+
+// PartialDecrypt computes the partial decryption of c by the holder of
+// share.
+func (para *ElgamalPara) PartialDecrypt(share KeyShare, c ElCipher) (PartialDecryption, error) {
+	d := new(big.Int).Exp(c.C1, share.privKeyShare.Y, para.ElgamalP)
+	w, err := para.randomExponent()
+	if err != nil {
+		return PartialDecryption{}, err
+	}
+	a := new(big.Int).Exp(para.ElgamalG, w, para.ElgamalP)
+	b := new(big.Int).Exp(c.C1, w, para.ElgamalP)
+	e := para.challenge(share.PubKeyShare.Y, c.C1, d, a, b)
+	z := new(big.Int).Mul(e, share.privKeyShare.Y)
+	z.Add(z, w)
+	z.Mod(z, para.ElgamalQ)
+	return PartialDecryption{X: share.PubKeyShare.X, D: d, Proof: DLEQProof{E: e, Z: z}}, nil
+}
+
+// VerifyPartial checks that p was computed by one of holders, the
+// public key shares c was encrypted for as known to the caller, with
+// its private key share. The Holders of c can not be trusted for
+// that: whoever made the cipher would choose the keys the proofs are
+// checked against.
+func (para *ElgamalPara) VerifyPartial(holders []PubKeyShare, c ElCipher, p PartialDecryption) error {
+	var h *big.Int
+	for _, holder := range holders {
+		if holder.X.Cmp(p.X) == 0 {
+			h = holder.Y
+		}
+	}
+	if h == nil {
+		return fmt.Errorf("%w: %v is not a share holder", ErrInvalidPartial, p.X)
+	}
+	// the proof only binds elements of the order Q subgroup: -D passes
+	// for D half of the time
+	if !para.inGroup(h) || !para.inGroup(c.C1) {
+		return fmt.Errorf("%w: cipher of share %v is malformed", ErrInvalidPartial, p.X)
+	}
+	if !para.inGroup(p.D) ||
+		!inRange(p.Proof.E, big.NewInt(0), para.ElgamalQ) || !inRange(p.Proof.Z, big.NewInt(0), para.ElgamalQ) {
+		return fmt.Errorf("%w: of share %v is malformed", ErrInvalidPartial, p.X)
+	}
+	// a = g^z / h^e and b = C1^z / D^e are the commitments of the
+	// prover, if it knew the exponent of both h and D
+	a := para.divExp(para.ElgamalG, p.Proof.Z, h, p.Proof.E)
+	b := para.divExp(c.C1, p.Proof.Z, p.D, p.Proof.E)
+	if para.challenge(h, c.C1, p.D, a, b).Cmp(p.Proof.E) != 0 {
+		return fmt.Errorf("%w: wrong proof of share %v", ErrInvalidPartial, p.X)
+	}
+	return nil
+}
+
+// Combine decrypts c with t partial decryptions of distinct holders,
+// after checking their proofs against holders as VerifyPartial does.
+// A cipher of threshold t can not be decrypted with fewer.
+func (para *ElgamalPara) Combine(holders []PubKeyShare, c ElCipher, partials []PartialDecryption, t int) ([]byte, error) {
+	if err := para.checkCipher(c, holders); err != nil {
+		return nil, err
+	}
+	if need := len(holders) + 1 - len(c.C3); t < need {
+		return nil, fmt.Errorf("%w: the threshold of the cipher is %d", ErrNotEnoughPartials, need)
+	}
+	if len(partials) < t {
+		return nil, fmt.Errorf("%w: %d of %d", ErrNotEnoughPartials, len(partials), t)
+	}
+	points := append([]PubKeyShare(nil), c.C3...)
+	for _, p := range partials[:t] {
+		if err := para.VerifyPartial(holders, c, p); err != nil {
+			return nil, err
+		}
+		for _, point := range points {
+			if point.X.Cmp(p.X) == 0 {
+				return nil, fmt.Errorf("%w: share %v given twice", ErrInvalidPartial, p.X)
+			}
+		}
+		points = append(points, PubKeyShare{X: p.X, Y: p.D})
+	}
+	s := para.interpolate(big.NewInt(0x00), points).Y
+	sinv := new(big.Int).ModInverse(s, para.ElgamalP)
+	msg := new(big.Int).Mul(c.C2, sinv)
+	msg = new(big.Int).Mod(msg, para.ElgamalP)
+
+	return msg.Bytes(), nil
+}
+
+// challenge hashes the statement and the commitments of a proof into
+// its challenge.
+func (para *ElgamalPara) challenge(h, c1, d, a, b *big.Int) *big.Int {
+	hash := sha256.New()
+	for _, v := range []*big.Int{para.ElgamalP, para.ElgamalG, h, c1, d, a, b} {
+		buf := v.Bytes()
+		hash.Write([]byte{byte(len(buf) >> 24), byte(len(buf) >> 16), byte(len(buf) >> 8), byte(len(buf))})
+		hash.Write(buf)
+	}
+	e := new(big.Int).SetBytes(hash.Sum(nil))
+	return e.Mod(e, para.ElgamalQ)
+}
+
+// checkCipher checks that the numbers of a cipher, as decoded from
+// untrusted data, are elements of the group, and that its points and
+// those of holders, interpolated together, are of distinct indexes mod
+// Q, as interpolation divides by their differences.
+func (para *ElgamalPara) checkCipher(c ElCipher, holders []PubKeyShare) error {
+	one := big.NewInt(1)
+	valid := inRange(c.C1, one, para.ElgamalP) && inRange(c.C2, one, para.ElgamalP)
+	seen := make(map[string]bool)
+	for _, share := range append(append([]PubKeyShare(nil), c.C3...), holders...) {
+		valid = valid && share.X != nil && inRange(share.Y, one, para.ElgamalP)
+		if !valid {
+			break
+		}
+		x := new(big.Int).Mod(share.X, para.ElgamalQ).String()
+		valid = !seen[x]
+		seen[x] = true
+	}
+	if !valid {
+		return errors.New("elgamir: invalid cipher")
+	}
+	return nil
+}
+
+// inRange tells if min <= v < max.
+func inRange(v, min, max *big.Int) bool {
+	return v != nil && v.Cmp(min) >= 0 && v.Cmp(max) < 0
+}
+
+// inGroup tells if v is an element of the subgroup of order Q, the one
+// generated by ElgamalG.
+func (para *ElgamalPara) inGroup(v *big.Int) bool {
+	return inRange(v, big.NewInt(1), para.ElgamalP) &&
+		new(big.Int).Exp(v, para.ElgamalQ, para.ElgamalP).Cmp(big.NewInt(1)) == 0
+}
+
+// divExp returns x^z / y^e mod P.
+func (para *ElgamalPara) divExp(x, z, y, e *big.Int) *big.Int {
+	num := new(big.Int).Exp(x, z, para.ElgamalP)
+	den := new(big.Int).Exp(y, e, para.ElgamalP)
+	den.ModInverse(den, para.ElgamalP)
+	num.Mul(num, den)
+	return num.Mod(num, para.ElgamalP)
+}
@@ -0,0 +1,175 @@
+package elgamir
+
+import (
+	"errors"
+	"math/big"
+	mrand "math/rand"
+	"testing"
+	"time"
+)
+
+// holders returns the key shares of n share holders.
+func holders(para ElgamalPara, n int) ([]KeyShare, []PubKeyShare) {
+	keys := make([]KeyShare, 0)
+	pubs := make([]PubKeyShare, 0)
+	for k := 1; k <= n; k++ {
+		key, err := para.ShareKeyGen(big.NewInt(int64(UserIdx + k)))
+		if err != nil {
+			panic(err)
+		}
+		keys = append(keys, key)
+		pubs = append(pubs, key.PubKeyShare)
+	}
+	return keys, pubs
+}
+
+func TestThreshold(t *testing.T) {
+	para := testPara()
+	keys, pubs := holders(para, 5)
+	r := mrand.New(mrand.NewSource(time.Now().UnixNano()))
+	msg := new(big.Int).Rand(r, para.ElgamalQ)
+	c, err := para.EncryptThreshold(pubs, 3, msg.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	partials := make([]PartialDecryption, 0)
+	for _, key := range keys {
+		p, err := para.PartialDecrypt(key, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := para.VerifyPartial(pubs, c, p); err != nil {
+			t.Errorf("VerifyPartial() = %v", err)
+		}
+		partials = append(partials, p)
+	}
+
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		some := make([]PartialDecryption, 0)
+		for _, i := range subset {
+			some = append(some, partials[i])
+		}
+		m, err := para.Combine(pubs, c, some, len(some))
+		if err != nil || msg.Cmp(new(big.Int).SetBytes(m)) != 0 {
+			t.Errorf("Combine(%v) = %v, not the message", subset, err)
+		}
+	}
+
+	if _, err := para.Combine(pubs, c, partials[:2], 2); !errors.Is(err, ErrNotEnoughPartials) {
+		t.Errorf("Combine() of 2 = %v, want %v", err, ErrNotEnoughPartials)
+	}
+	if _, err := para.Combine(pubs, c, partials[:2], 3); !errors.Is(err, ErrNotEnoughPartials) {
+		t.Errorf("Combine() of 2 = %v, want %v", err, ErrNotEnoughPartials)
+	}
+	// the cipher does not give more away: two partials and the points of
+	// the cipher do not interpolate the key
+	points := append(append([]PubKeyShare(nil), c.C3...),
+		PubKeyShare{X: partials[0].X, Y: partials[0].D}, PubKeyShare{X: partials[1].X, Y: partials[1].D})
+	s := para.interpolate(big.NewInt(0x00), points).Y
+	m := new(big.Int).Mul(c.C2, new(big.Int).ModInverse(s, para.ElgamalP))
+	if m.Mod(m, para.ElgamalP).Cmp(msg) == 0 {
+		t.Errorf("decrypted with 2 of 3 partials")
+	}
+}
+
+func TestCheatingHolder(t *testing.T) {
+	para := testPara()
+	keys, pubs := holders(para, 3)
+	c, err := para.EncryptThreshold(pubs, 2, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	honest, _ := para.PartialDecrypt(keys[0], c)
+	cheat := func(f func(p *PartialDecryption)) PartialDecryption {
+		p, _ := para.PartialDecrypt(keys[1], c)
+		f(&p)
+		return p
+	}
+	outsider, err := para.ShareKeyGen(big.NewInt(int64(UserIdx + 10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, _ := para.PartialDecrypt(outsider, c)
+	for name, p := range map[string]PartialDecryption{
+		"wrong value": cheat(func(p *PartialDecryption) { p.D = new(big.Int).Mul(p.D, para.ElgamalG) }),
+		"wrong proof": cheat(func(p *PartialDecryption) { p.Proof.Z = new(big.Int).Sub(p.Proof.Z, big.NewInt(1)) }),
+		"other share": cheat(func(p *PartialDecryption) { p.X = honest.X }),
+		"no value":    cheat(func(p *PartialDecryption) { p.D = nil }),
+		"outsider":    forged,
+	} {
+		if err := para.VerifyPartial(pubs, c, p); !errors.Is(err, ErrInvalidPartial) {
+			t.Errorf("%s: VerifyPartial() = %v", name, err)
+		}
+		if _, err := para.Combine(pubs, c, []PartialDecryption{honest, p}, 2); !errors.Is(err, ErrInvalidPartial) {
+			t.Errorf("%s: Combine() = %v", name, err)
+		}
+	}
+	// P-D is outside the subgroup, yet a proof made for it passes when
+	// its challenge is even, as C1^z / (P-D)^e = C1^z / D^e then
+	for {
+		x := keys[1].privKeyShare.Y
+		d := new(big.Int).Sub(para.ElgamalP, new(big.Int).Exp(c.C1, x, para.ElgamalP))
+		w, _ := para.randomExponent()
+		a := new(big.Int).Exp(para.ElgamalG, w, para.ElgamalP)
+		b := new(big.Int).Exp(c.C1, w, para.ElgamalP)
+		e := para.challenge(pubs[1].Y, c.C1, d, a, b)
+		if e.Bit(0) != 0 {
+			continue
+		}
+		z := new(big.Int).Mul(e, x)
+		z.Add(z, w).Mod(z, para.ElgamalQ)
+		p := PartialDecryption{X: pubs[1].X, D: d, Proof: DLEQProof{E: e, Z: z}}
+		if err := para.VerifyPartial(pubs, c, p); !errors.Is(err, ErrInvalidPartial) {
+			t.Errorf("P-D: VerifyPartial() = %v", err)
+		}
+		if _, err := para.Combine(pubs, c, []PartialDecryption{honest, p}, 2); !errors.Is(err, ErrInvalidPartial) {
+			t.Errorf("P-D: Combine() = %v", err)
+		}
+		break
+	}
+	if _, err := para.Combine(pubs, c, []PartialDecryption{honest, honest}, 2); !errors.Is(err, ErrInvalidPartial) {
+		t.Errorf("Combine() with a partial twice = %v", err)
+	}
+
+	// whoever alters the cipher can put their own key among its holders,
+	// the proofs are checked against the trusted ones
+	swapped := c
+	swapped.Holders = append([]PubKeyShare(nil), c.Holders...)
+	swapped.Holders[1] = outsider.PubKeyShare
+	if err := para.VerifyPartial(swapped.Holders, swapped, forged); err != nil {
+		t.Fatalf("VerifyPartial() against the holders of the cipher = %v", err)
+	}
+	if err := para.VerifyPartial(pubs, swapped, forged); !errors.Is(err, ErrInvalidPartial) {
+		t.Errorf("swapped holder: VerifyPartial() = %v", err)
+	}
+	if _, err := para.Combine(pubs, swapped, []PartialDecryption{honest, forged}, 2); !errors.Is(err, ErrInvalidPartial) {
+		t.Errorf("swapped holder: Combine() = %v", err)
+	}
+
+	// interpolation divides by the differences of the indexes mod Q
+	congruent := c
+	congruent.C3 = append([]PubKeyShare(nil), c.C3...)
+	congruent.C3[0].X = new(big.Int).Add(pubs[0].X, para.ElgamalQ)
+	if _, err := para.Combine(pubs, congruent, []PartialDecryption{honest, cheat(func(*PartialDecryption) {})}, 2); err == nil {
+		t.Errorf("Combine() accepted an index congruent to a holder's")
+	}
+}
+
+func TestCombineEncrypt(t *testing.T) {
+	para, dealer, shares := setup(2, 100, 10)
+	c, err := para.Encrypt(shares, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := para.PartialDecrypt(dealer, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := para.Combine(shares, c, []PartialDecryption{p}, 1)
+	if err != nil || string(m) != "secret" || string(para.Decrypt(dealer.privKeyShare, c)) != "secret" {
+		t.Errorf("Combine() = %q, %v", m, err)
+	}
+	if _, err := para.EncryptThreshold(shares, 11, []byte("secret")); err == nil {
+		t.Errorf("EncryptThreshold() accepted a threshold above the holders")
+	}
+}
@@ -0,0 +1,68 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Client makes calls on a connection to a Server.
+type Client struct {
+	conn *conn
+	next uint64 // id of the last call
+}
+
+// Dial connects to the Server at address.
+func Dial(network, address string) (*Client, error) {
+	nc, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(nc), nil
+}
+
+// NewClient makes calls on nc.
+func NewClient(nc net.Conn) *Client {
+	c := &Client{conn: newConn(nc)}
+	go c.conn.read(nil)
+	return c
+}
+
+// Close closes the connection, failing the calls in progress.
+func (c *Client) Close() error {
+	c.conn.close(ErrClosed)
+	return nil
+}
+
+// Open starts a call of method. The server gets the deadline of ctx
+// and is told once ctx is done; the call then fails with ctx.Err().
+func (c *Client) Open(ctx context.Context, method string) (*Stream, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s := newStream(c.conn, atomic.AddUint64(&c.next, 1), ctx)
+	f := &frame{Stream: s.id, Kind: kindOpen, Method: method}
+	if deadline, ok := ctx.Deadline(); ok {
+		if f.Timeout = time.Until(deadline); f.Timeout <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+	}
+	c.conn.add(s)
+	if err := c.conn.write(f); err != nil {
+		c.conn.remove(s)
+		return nil, err
+	}
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				c.conn.remove(s)
+				c.conn.write(&frame{Stream: s.id, Kind: kindCancel})
+			case <-s.done:
+			case <-c.conn.closed:
+			}
+		}()
+	}
+	return s, nil
+}
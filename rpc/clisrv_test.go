@@ -1,16 +1,279 @@
 package rpc
 
 import (
-	"net/rpc"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/bukodi/go-playground/async"
+	"github.com/bukodi/go-playground/async/asynctest"
 )
 
+const latency = 10 * time.Millisecond
+
+// serve starts a server on a local port and returns a client of it.
+func serve(t *testing.T, register func(srv *Server)) *Client {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer()
+	register(srv)
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(l) }()
+	c, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+		srv.Close()
+		if err := <-served; err != ErrClosed {
+			t.Errorf("Serve() = %v, want %v", err, ErrClosed)
+		}
+	})
+	return c
+}
 
 func TestRPC(t *testing.T) {
-	listener :=
+	c := serve(t, func(srv *Server) {
+		RegisterGreeter(srv, async.NewAsyncGreeter(latency, 2))
+	})
+	greeter := async.WrapToSyncGreeter(context.Background(), NewGreeterClient(c))
+
+	if msg := greeter.SayHello("Alice"); msg != "Hello Alice!" {
+		t.Errorf("SayHello() = %q", msg)
+	}
+	if msg, err := greeter.SayLocaleHello("Alice", "hu"); msg != "Szia Alice!" || err != nil {
+		t.Errorf("SayLocaleHello(hu) = %q, %v", msg, err)
+	}
+	if _, err := greeter.SayLocaleHello("Alice", "xx"); err == nil || err.Error() != "unsupported lang: xx" {
+		t.Errorf("SayLocaleHello(xx) error = %v", err)
+	}
+	greetings, errs := greeter.SayMultiLangHello("Alice", "en", "xx", "fr", "es")
+	if len(greetings) != 3 || len(errs) != 1 || errs[0].Error() != "unsupported lang: xx" {
+		t.Errorf("SayMultiLangHello() = %v, %v", greetings, errs)
+	}
+}
+
+func TestRPCGreeterHarness(t *testing.T) {
+	c := serve(t, func(srv *Server) {
+		RegisterGreeter(srv, async.NewAsyncGreeter(latency, 2))
+	})
+	asynctest.TestGreeter(t, NewGreeterClient(c), latency)
+}
+
+func TestRPCDeadline(t *testing.T) {
+	deadlines := make(chan time.Duration, 1)
+	c := serve(t, func(srv *Server) {
+		HandleUnary(srv, "wait", func(ctx context.Context, args struct{}) (struct{}, error) {
+			deadline, _ := ctx.Deadline()
+			deadlines <- time.Until(deadline)
+			<-ctx.Done()
+			return struct{}{}, ctx.Err()
+		})
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if _, err := Call[struct{}, struct{}](ctx, c, "wait", struct{}{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Call() error = %v, want deadline exceeded", err)
+	}
+	if left := <-deadlines; left <= 0 || left > time.Millisecond*50 {
+		t.Errorf("server deadline in %v, want the client's", left)
+	}
+}
+
+func TestRPCCancel(t *testing.T) {
+	cancelled := make(chan error, 1)
+	started := make(chan struct{})
+	c := serve(t, func(srv *Server) {
+		HandleUnary(srv, "wait", func(ctx context.Context, args struct{}) (struct{}, error) {
+			close(started)
+			<-ctx.Done()
+			cancelled <- ctx.Err()
+			return struct{}{}, ctx.Err()
+		})
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	f := async.Go(ctx, func(ctx context.Context) (struct{}, error) {
+		return Call[struct{}, struct{}](ctx, c, "wait", struct{}{})
+	})
+	<-started
+	cancel()
+	if _, err := f.Result(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Call() error = %v, want canceled", err)
+	}
+	select {
+	case err := <-cancelled:
+		if err != context.Canceled {
+			t.Errorf("server context error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("server call not cancelled")
+	}
+}
+
+func TestRPCStreaming(t *testing.T) {
+	c := serve(t, func(srv *Server) {
+		HandleClientStream(srv, "sum", func(ctx context.Context, base int, nums <-chan int) (int, error) {
+			sum := base
+			for n := range nums {
+				sum += n
+			}
+			return sum, nil
+		})
+		HandleServerStream(srv, "count", func(ctx context.Context, n int) *async.Stream[int] {
+			return async.NewStream(ctx, func(ctx context.Context, e async.Emitter[int]) error {
+				for i := 1; i <= n; i++ {
+					if err := e.Send(i); err != nil {
+						return err
+					}
+				}
+				return fmt.Errorf("counted to %d", n)
+			})
+		})
+		HandleBidi(srv, "scale", func(ctx context.Context, factor int, nums <-chan int) *async.Stream[int] {
+			return async.Map(func(ctx context.Context, n int) (int, error) {
+				return n * factor, nil
+			})(ctx, nums)
+		})
+	})
+	ctx := context.Background()
+
+	sum, err := ClientStream[int, int, int](ctx, c, "sum", 100, async.FromSlice(ctx, []int{1, 2, 3}))
+	if sum != 106 || err != nil {
+		t.Errorf("sum = %v, %v", sum, err)
+	}
+
+	vals, errs := ServerStream[int, int](ctx, c, "count", 3).Collect()
+	if fmt.Sprint(vals) != "[1 2 3]" || len(errs) != 1 || errs[0].Error() != "counted to 3" {
+		t.Errorf("count = %v, %v", vals, errs)
+	}
+
+	nums := make(chan int)
+	valCh, _ := Bidi[int, int, int](ctx, c, "scale", 10, nums).Chans()
+	for _, n := range []int{1, 2, 3} {
+		nums <- n
+		if got := <-valCh; got != n*10 {
+			t.Errorf("scale %d = %d, want a response before the next request", n, got)
+		}
+	}
+	close(nums)
+	if _, ok := <-valCh; ok {
+		t.Errorf("stream not ended with the requests")
+	}
+}
+
+func TestRPCErrors(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer()
+	go srv.Serve(l)
+	c, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = Call[struct{}, struct{}](context.Background(), c, "missing", struct{}{})
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != Unimplemented {
+		t.Errorf("error = %v, want unimplemented", err)
+	}
+
+	srv.Close()
+	_, err = Call[struct{}, struct{}](context.Background(), c, "missing", struct{}{})
+	if !errors.Is(err, ErrClosed) || !async.IsTransient(&Error{Code: Unavailable}) {
+		t.Errorf("error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestRPCFlowControl(t *testing.T) {
+	var sent int32
+	c := serve(t, func(srv *Server) {
+		srv.Handle("flood", func(ctx context.Context, s *Stream) error {
+			for i := 0; i < window*10; i++ {
+				if err := s.Send(i); err != nil {
+					return err
+				}
+				atomic.AddInt32(&sent, 1)
+			}
+			return nil
+		})
+	})
+	s, err := c.Open(context.Background(), "flood")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 50)
+	s.mu.Lock()
+	queued := len(s.queue)
+	s.mu.Unlock()
+	if n := atomic.LoadInt32(&sent); n != window || queued != window {
+		t.Errorf("sent %d, queued %d before reading, want the window %d", n, queued, window)
+	}
+	for i := 0; i < window*10; i++ {
+		var n int
+		if err := s.Recv(&n); n != i || err != nil {
+			t.Fatalf("Recv() = %d, %v, want %d", n, err, i)
+		}
+	}
+	if err := s.Recv(nil); err != io.EOF {
+		t.Errorf("Recv() error = %v, want EOF", err)
+	}
+}
 
-	srv := rpc.NewServer()
-	srv.Register( impl )
-	srv.Accept()
+func TestRPCProtocolErrors(t *testing.T) {
+	for name, frames := range map[string][]frame{
+		"stream opened twice": {
+			{Stream: 1, Kind: kindOpen, Method: "wait"},
+			{Stream: 1, Kind: kindOpen, Method: "wait"},
+		},
+		"stream sent past its window": append([]frame{{Stream: 1, Kind: kindOpen, Method: "wait"}},
+			make([]frame, window+1)...),
+	} {
+		t.Run(name, func(t *testing.T) {
+			cancelled := make(chan error, 1)
+			srv := NewServer()
+			srv.Handle("wait", func(ctx context.Context, s *Stream) error {
+				<-ctx.Done()
+				cancelled <- ctx.Err()
+				return ctx.Err()
+			})
+			nc, sc := net.Pipe()
+			defer nc.Close()
+			served := make(chan struct{})
+			go func() {
+				srv.ServeConn(sc)
+				close(served)
+			}()
 
+			enc := json.NewEncoder(nc)
+			for i, f := range frames {
+				if f.Kind == 0 {
+					f = frame{Stream: 1, Kind: kindData, Payload: json.RawMessage(fmt.Sprint(i))}
+				}
+				if err := enc.Encode(&f); err != nil {
+					break
+				}
+			}
+			select {
+			case <-served:
+			case <-time.After(time.Second):
+				t.Fatal("connection not closed")
+			}
+			if err := <-cancelled; err != context.Canceled {
+				t.Errorf("call in progress ended with %v, want canceled", err)
+			}
+		})
+	}
 }
@@ -0,0 +1,302 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// conn is a connection shared by the calls of a client or a server.
+type conn struct {
+	nc  net.Conn
+	wmu sync.Mutex
+	enc *json.Encoder
+	dec *json.Decoder
+
+	mu      sync.Mutex
+	streams map[uint64]*Stream
+	closed  chan struct{}
+	err     error // why the connection closed
+}
+
+func newConn(nc net.Conn) *conn {
+	return &conn{
+		nc:      nc,
+		enc:     json.NewEncoder(nc),
+		dec:     json.NewDecoder(nc),
+		streams: make(map[uint64]*Stream),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (c *conn) write(f *frame) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	select {
+	case <-c.closed:
+		return ErrClosed
+	default:
+	}
+	if err := c.enc.Encode(f); err != nil {
+		c.close(err)
+		return ErrClosed
+	}
+	return nil
+}
+
+// read hands the frames received to their streams, and those opening
+// a call to open, until the connection fails.
+func (c *conn) read(open func(f *frame)) {
+	for {
+		f := new(frame)
+		if err := c.dec.Decode(f); err != nil {
+			c.close(err)
+			return
+		}
+		if f.Kind == kindOpen {
+			if open != nil {
+				open(f)
+			}
+			continue
+		}
+		c.mu.Lock()
+		s := c.streams[f.Stream]
+		c.mu.Unlock()
+		if s != nil {
+			s.deliver(f)
+		}
+	}
+}
+
+// add registers s, unless a stream of its id is still in progress.
+func (c *conn) add(s *Stream) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.streams[s.id] != nil {
+		return false
+	}
+	c.streams[s.id] = s
+	return true
+}
+
+func (c *conn) remove(s *Stream) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.streams, s.id)
+}
+
+// close closes the connection, failing all its calls.
+func (c *conn) close(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	if err == nil || errors.Is(err, io.EOF) {
+		err = ErrClosed
+	}
+	c.err = err
+	close(c.closed)
+	c.nc.Close()
+}
+
+// Stream is a call in progress. The client sends messages and ends
+// them with CloseSend; the server sends messages and ends the call
+// with its status, which the client receives as the error of Recv:
+// io.EOF if the call succeeded.
+type Stream struct {
+	conn   *conn
+	id     uint64
+	ctx    context.Context
+	cancel context.CancelFunc // of the server side
+
+	mu    sync.Mutex
+	queue []*frame
+	ready chan struct{} // signals a frame queued
+	final error         // returned by Recv once the queue is empty
+	done  chan struct{} // closed once the status was received
+
+	// flow control, under mu as well
+	unread  int           // messages queued
+	read    int           // messages read since the last grant
+	credit  int           // messages Send may write before a grant
+	granted chan struct{} // signals credit granted
+}
+
+func newStream(c *conn, id uint64, ctx context.Context) *Stream {
+	return &Stream{
+		conn:  c,
+		id:    id,
+		ctx:   ctx,
+		ready: make(chan struct{}, 1),
+		done:  make(chan struct{}),
+
+		credit:  window,
+		granted: make(chan struct{}, 1),
+	}
+}
+
+// Context is the context of the call; on the server it carries the
+// deadline of the client and is cancelled when the client gives up.
+func (s *Stream) Context() context.Context {
+	return s.ctx
+}
+
+// deliver queues a frame received for the stream.
+func (s *Stream) deliver(f *frame) {
+	if f.Kind == kindCancel {
+		if s.cancel != nil {
+			s.cancel()
+		}
+		return
+	}
+	s.mu.Lock()
+	switch f.Kind {
+	case kindWindow:
+		s.credit += f.Window
+		s.mu.Unlock()
+		signal(s.granted)
+		return
+	case kindData:
+		if s.unread >= window {
+			s.mu.Unlock()
+			s.conn.close(fmt.Errorf("rpc: stream %d sent past its window", s.id))
+			return
+		}
+		s.unread++
+	}
+	s.queue = append(s.queue, f)
+	s.mu.Unlock()
+	if f.Kind == kindStatus {
+		s.conn.remove(s)
+		close(s.done)
+	}
+	signal(s.ready)
+}
+
+// signal wakes up the one waiting on ch, if any.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// Send sends a message, encoded as JSON.
+func (s *Stream) Send(msg any) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if err := s.acquire(); err != nil {
+		return err
+	}
+	return s.conn.write(&frame{Stream: s.id, Kind: kindData, Payload: payload})
+}
+
+// acquire takes a message of the window, waiting for the other side to
+// grant more if it is used up. It returns io.EOF once the server ended
+// the call, as it reads no more.
+func (s *Stream) acquire() error {
+	for {
+		s.mu.Lock()
+		if s.credit > 0 {
+			s.credit--
+			if s.credit > 0 {
+				signal(s.granted)
+			}
+			s.mu.Unlock()
+			return nil
+		}
+		s.mu.Unlock()
+		select {
+		case <-s.granted:
+		case <-s.done:
+			return io.EOF
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		case <-s.conn.closed:
+			return ErrClosed
+		}
+	}
+}
+
+// CloseSend tells the server that the client sends no more messages.
+func (s *Stream) CloseSend() error {
+	return s.conn.write(&frame{Stream: s.id, Kind: kindEnd})
+}
+
+// Recv receives the next message into msg. It returns io.EOF once the
+// other side ended its messages, or the error the call failed with.
+func (s *Stream) Recv(msg any) error {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			f := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			switch f.Kind {
+			case kindData:
+				s.grant()
+				if msg == nil {
+					return &Error{Code: Unknown, Message: "unexpected message"}
+				}
+				return json.Unmarshal(f.Payload, msg)
+			case kindStatus:
+				s.setFinal(io.EOF)
+				if f.Code != OK {
+					s.setFinal(&Error{Code: f.Code, Message: f.Message})
+				}
+			case kindEnd:
+				s.setFinal(io.EOF)
+			}
+			continue
+		}
+		final := s.final
+		s.mu.Unlock()
+		if final != nil {
+			return final
+		}
+		select {
+		case <-s.ready:
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		case <-s.conn.closed:
+			s.mu.Lock()
+			empty := len(s.queue) == 0
+			s.mu.Unlock()
+			if empty {
+				return ErrClosed
+			}
+		}
+	}
+}
+
+// grant lets the other side send the messages read, once they make
+// half the window.
+func (s *Stream) grant() {
+	s.mu.Lock()
+	s.unread--
+	s.read++
+	n := s.read
+	if n < window/2 {
+		s.mu.Unlock()
+		return
+	}
+	s.read = 0
+	s.mu.Unlock()
+	s.conn.write(&frame{Stream: s.id, Kind: kindWindow, Window: n})
+}
+
+func (s *Stream) setFinal(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.final = err
+}
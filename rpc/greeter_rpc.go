@@ -0,0 +1,71 @@
+// Code generated by asyncgen -type Greeter -rpc. DO NOT EDIT.
+
+package rpc
+
+import (
+	"context"
+
+	"github.com/bukodi/go-playground/async"
+)
+
+// greeterSayHelloArgs carries the arguments of Greeter.SayHello.
+type greeterSayHelloArgs struct {
+	Name string `json:"name"`
+}
+
+// greeterSayLocaleHelloArgs carries the arguments of Greeter.SayLocaleHello.
+type greeterSayLocaleHelloArgs struct {
+	Name string `json:"name"`
+	Lang string `json:"lang"`
+}
+
+// greeterSayMultiLangHelloArgs carries the arguments of Greeter.SayMultiLangHello.
+type greeterSayMultiLangHelloArgs struct {
+	Name string `json:"name"`
+}
+
+// NewGreeterClient returns an async.AsyncGreeter making its calls on c, to a
+// server serving them with RegisterGreeter.
+func NewGreeterClient(c *Client) async.AsyncGreeter {
+	return &greeterClient{c: c}
+}
+
+var _ async.AsyncGreeter = &greeterClient{}
+
+type greeterClient struct {
+	c *Client
+}
+
+func (cl greeterClient) SayHello(ctx context.Context, name string) (greetingCh <-chan string) {
+	return async.Go(ctx, func(ctx context.Context) (string, error) {
+		return Call[greeterSayHelloArgs, string](ctx, cl.c, "Greeter.SayHello", greeterSayHelloArgs{Name: name})
+	}).Chan()
+}
+
+func (cl greeterClient) SayLocaleHello(ctx context.Context, name string, lang string) (greetingCh <-chan string, errCh <-chan error) {
+	return async.Go(ctx, func(ctx context.Context) (string, error) {
+		return Call[greeterSayLocaleHelloArgs, string](ctx, cl.c, "Greeter.SayLocaleHello", greeterSayLocaleHelloArgs{Name: name, Lang: lang})
+	}).Chans()
+}
+
+func (cl greeterClient) SayMultiLangHello(ctx context.Context, name string, langCh <-chan string) (greetingCh <-chan string, errCh <-chan error) {
+	return Bidi[greeterSayMultiLangHelloArgs, string, string](ctx, cl.c, "Greeter.SayMultiLangHello", greeterSayMultiLangHelloArgs{Name: name}, langCh).Chans()
+}
+
+// RegisterGreeter serves the calls of a client made by NewGreeterClient
+// with impl.
+func RegisterGreeter(srv *Server, impl async.AsyncGreeter) {
+	HandleUnary(srv, "Greeter.SayHello", func(ctx context.Context, args greeterSayHelloArgs) (string, error) {
+		return async.FutureOf(ctx, impl.SayHello(ctx, args.Name), nil).Result()
+	})
+
+	HandleUnary(srv, "Greeter.SayLocaleHello", func(ctx context.Context, args greeterSayLocaleHelloArgs) (string, error) {
+		valCh, errCh := impl.SayLocaleHello(ctx, args.Name, args.Lang)
+		return async.FutureOf(ctx, valCh, errCh).Result()
+	})
+
+	HandleBidi(srv, "Greeter.SayMultiLangHello", func(ctx context.Context, args greeterSayMultiLangHelloArgs, langCh <-chan string) *async.Stream[string] {
+		valCh, errCh := impl.SayMultiLangHello(ctx, args.Name, langCh)
+		return async.StreamOf(ctx, valCh, errCh)
+	})
+}
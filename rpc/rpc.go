@@ -0,0 +1,129 @@
+// Package rpc makes calls over a network connection in the style of
+// gRPC: every call is a stream of its own, multiplexed with the others
+// on one connection, carrying the deadline of the caller's context and
+// its cancellation to the server. On top of the raw Stream, the typed
+// helpers make unary, client streaming, server streaming and
+// bidirectional streaming calls, and asyncgen -rpc generates clients
+// implementing the asynchronous interfaces of the async package.
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+//go:generate go run ../async/cmds/asyncgen -type Greeter -dir ../async -rpc -output greeter_rpc.go
+
+// ErrClosed is the error of calls on a closed connection.
+var ErrClosed = errors.New("rpc: connection closed")
+
+// kind is the kind of a frame.
+type kind uint8
+
+const (
+	kindOpen   kind = iota + 1 // client starts a call of Method
+	kindData                   // a message of the call
+	kindEnd                    // client sends no more messages
+	kindCancel                 // client gave up the call
+	kindStatus                 // server ended the call with Code
+	kindWindow                 // receiver read Window more messages
+)
+
+// window is the number of messages a side may send on a stream ahead
+// of the other reading them. The receiver grants more as it reads, so
+// a stream not read holds up its sender, and not the connection.
+const window = 64
+
+// frame is the unit written on the connection, one JSON object each.
+type frame struct {
+	Stream  uint64          `json:"s"`
+	Kind    kind            `json:"k"`
+	Method  string          `json:"m,omitempty"`
+	Timeout time.Duration   `json:"t,omitempty"` // left of the caller's deadline
+	Payload json.RawMessage `json:"p,omitempty"`
+	Code    Code            `json:"c,omitempty"`
+	Message string          `json:"e,omitempty"`
+	Window  int             `json:"w,omitempty"` // messages granted
+}
+
+// Code classifies the outcome of a call.
+type Code int
+
+const (
+	OK Code = iota
+	Unknown
+	Canceled
+	DeadlineExceeded
+	Unimplemented
+	Unavailable
+)
+
+func (c Code) String() string {
+	switch c {
+	case OK:
+		return "ok"
+	case Canceled:
+		return "canceled"
+	case DeadlineExceeded:
+		return "deadline exceeded"
+	case Unimplemented:
+		return "unimplemented"
+	case Unavailable:
+		return "unavailable"
+	}
+	return "unknown"
+}
+
+// Error is a failed call as reported by the server. Errors of the
+// server's context match their context counterparts with errors.Is,
+// so a call cancelled on the far side fails as it would locally.
+type Error struct {
+	Code    Code
+	Message string
+}
+
+// Error returns the message of errors returned by handlers as is.
+func (e *Error) Error() string {
+	if e.Code == Unknown {
+		return e.Message
+	}
+	return fmt.Sprintf("rpc: %s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Is(target error) bool {
+	switch e.Code {
+	case Canceled:
+		return target == context.Canceled
+	case DeadlineExceeded:
+		return target == context.DeadlineExceeded
+	case Unavailable:
+		return target == ErrClosed
+	}
+	return false
+}
+
+// Temporary reports an unavailable server, worth calling again.
+func (e *Error) Temporary() bool {
+	return e.Code == Unavailable
+}
+
+// status returns the code and message sent for err.
+func status(err error) (Code, string) {
+	var e *Error
+	switch {
+	case err == nil:
+		return OK, ""
+	case errors.As(err, &e):
+		return e.Code, e.Message
+	case errors.Is(err, context.Canceled):
+		return Canceled, err.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		return DeadlineExceeded, err.Error()
+	case errors.Is(err, ErrClosed):
+		return Unavailable, err.Error()
+	}
+	return Unknown, err.Error()
+}
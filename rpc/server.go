@@ -0,0 +1,154 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// Handler serves a call on the server. The error it returns is the
+// status of the call.
+type Handler func(ctx context.Context, s *Stream) error
+
+// Server serves calls on the connections it accepts.
+type Server struct {
+	mu        sync.Mutex
+	handlers  map[string]Handler
+	listeners map[net.Listener]bool
+	conns     map[*conn]bool
+	closed    bool
+	wg        sync.WaitGroup // of the connections served
+}
+
+func NewServer() *Server {
+	return &Server{
+		handlers:  make(map[string]Handler),
+		listeners: make(map[net.Listener]bool),
+		conns:     make(map[*conn]bool),
+	}
+}
+
+// Handle serves the calls of method with h.
+func (srv *Server) Handle(method string, h Handler) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.handlers[method] = h
+}
+
+// Serve serves the connections accepted on l until it fails or the
+// server is closed.
+func (srv *Server) Serve(l net.Listener) error {
+	srv.mu.Lock()
+	if srv.closed {
+		srv.mu.Unlock()
+		return ErrClosed
+	}
+	srv.listeners[l] = true
+	srv.mu.Unlock()
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			delete(srv.listeners, l)
+			if srv.closed {
+				return ErrClosed
+			}
+			return err
+		}
+		go srv.ServeConn(nc)
+	}
+}
+
+// ServeConn serves the calls on nc until the connection fails. The
+// calls in progress are then cancelled.
+func (srv *Server) ServeConn(nc net.Conn) {
+	c := newConn(nc)
+	srv.mu.Lock()
+	if srv.closed {
+		srv.mu.Unlock()
+		nc.Close()
+		return
+	}
+	srv.conns[c] = true
+	srv.wg.Add(1)
+	srv.mu.Unlock()
+	defer srv.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls sync.WaitGroup
+	c.read(func(f *frame) {
+		// registered before reading on, the frames following the
+		// opening one must find the stream
+		s := accept(ctx, c, f)
+		if s == nil {
+			// as in HTTP/2, reusing the id of a live stream is an error
+			// of the connection: the client lost track of its calls
+			c.close(fmt.Errorf("rpc: stream %d opened twice", f.Stream))
+			return
+		}
+		calls.Add(1)
+		go func() {
+			defer calls.Done()
+			srv.serve(s, f.Method)
+		}()
+	})
+	cancel()
+	calls.Wait()
+
+	srv.mu.Lock()
+	delete(srv.conns, c)
+	srv.mu.Unlock()
+}
+
+// accept registers the server side of the call opened by f, with the
+// deadline of the client. It returns nil if a call of the same stream
+// is in progress.
+func accept(ctx context.Context, c *conn, f *frame) *Stream {
+	var cancel context.CancelFunc
+	if f.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	s := newStream(c, f.Stream, ctx)
+	s.cancel = cancel
+	if !c.add(s) {
+		cancel()
+		return nil
+	}
+	return s
+}
+
+// serve runs the handler of a call and sends its status.
+func (srv *Server) serve(s *Stream, method string) {
+	defer s.cancel()
+	defer s.conn.remove(s)
+
+	srv.mu.Lock()
+	h := srv.handlers[method]
+	srv.mu.Unlock()
+	var err error = &Error{Code: Unimplemented, Message: fmt.Sprintf("unknown method %s", method)}
+	if h != nil {
+		err = h(s.ctx, s)
+	}
+	code, msg := status(err)
+	s.conn.write(&frame{Stream: s.id, Kind: kindStatus, Code: code, Message: msg})
+}
+
+// Close stops accepting connections and closes those being served,
+// cancelling their calls, and waits for the handlers to return.
+func (srv *Server) Close() error {
+	srv.mu.Lock()
+	srv.closed = true
+	for l := range srv.listeners {
+		l.Close()
+	}
+	for c := range srv.conns {
+		c.close(ErrClosed)
+	}
+	srv.mu.Unlock()
+	srv.wg.Wait()
+	return nil
+}
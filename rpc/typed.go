@@ -0,0 +1,239 @@
+package rpc
+
+import (
+	"context"
+	"io"
+
+	"github.com/bukodi/go-playground/async"
+)
+
+// Every call starts with the arguments, sent as the first message by
+// the client. The messages of streams are wrapped in envelopes, so
+// errors not ending the stream get through as well.
+
+type envelope[T any] struct {
+	Val T      `json:"v"`
+	Err *Error `json:"e,omitempty"`
+}
+
+// Call makes a unary call: it sends args and receives the result.
+func Call[Args, Resp any](ctx context.Context, c *Client, method string, args Args) (Resp, error) {
+	var resp Resp
+	s, err := open(ctx, c, method, args)
+	if err != nil {
+		return resp, err
+	}
+	if err := s.CloseSend(); err != nil {
+		return resp, err
+	}
+	return recvResult[Resp](s)
+}
+
+// ClientStream makes a client streaming call: it sends args, then the
+// requests received until reqs is closed, and receives the result.
+func ClientStream[Args, Req, Resp any](ctx context.Context, c *Client, method string, args Args, reqs <-chan Req) (Resp, error) {
+	var resp Resp
+	s, err := open(ctx, c, method, args)
+	if err != nil {
+		return resp, err
+	}
+	if err := sendAll(ctx, s, reqs); err != nil {
+		return resp, err
+	}
+	return recvResult[Resp](s)
+}
+
+// ServerStream makes a server streaming call: it sends args and
+// streams the responses.
+func ServerStream[Args, Resp any](ctx context.Context, c *Client, method string, args Args) *async.Stream[Resp] {
+	return async.NewStream(ctx, func(ctx context.Context, e async.Emitter[Resp]) error {
+		s, err := open(ctx, c, method, args)
+		if err != nil {
+			return err
+		}
+		if err := s.CloseSend(); err != nil {
+			return err
+		}
+		return recvAll(s, e)
+	})
+}
+
+// Bidi makes a bidirectional streaming call: it sends args, then the
+// requests as they are received from reqs, while streaming the
+// responses.
+func Bidi[Args, Req, Resp any](ctx context.Context, c *Client, method string, args Args, reqs <-chan Req) *async.Stream[Resp] {
+	return async.NewStream(ctx, func(ctx context.Context, e async.Emitter[Resp]) error {
+		s, err := open(ctx, c, method, args)
+		if err != nil {
+			return err
+		}
+		// ends with ctx once the call is over
+		go sendAll(ctx, s, reqs)
+		return recvAll(s, e)
+	})
+}
+
+// HandleUnary serves the unary calls of method with fn.
+func HandleUnary[Args, Resp any](srv *Server, method string, fn func(ctx context.Context, args Args) (Resp, error)) {
+	srv.Handle(method, func(ctx context.Context, s *Stream) error {
+		var args Args
+		if err := s.Recv(&args); err != nil {
+			return err
+		}
+		resp, err := fn(ctx, args)
+		if err != nil {
+			return err
+		}
+		return s.Send(resp)
+	})
+}
+
+// HandleClientStream serves the client streaming calls of method with
+// fn; reqs is closed once the client sent all the requests.
+func HandleClientStream[Args, Req, Resp any](srv *Server, method string, fn func(ctx context.Context, args Args, reqs <-chan Req) (Resp, error)) {
+	srv.Handle(method, func(ctx context.Context, s *Stream) error {
+		var args Args
+		if err := s.Recv(&args); err != nil {
+			return err
+		}
+		resp, err := fn(ctx, args, recvChan[Req](ctx, s))
+		if err != nil {
+			return err
+		}
+		return s.Send(resp)
+	})
+}
+
+// HandleServerStream serves the server streaming calls of method with
+// fn, sending the values and errors of the stream it returns.
+func HandleServerStream[Args, Resp any](srv *Server, method string, fn func(ctx context.Context, args Args) *async.Stream[Resp]) {
+	srv.Handle(method, func(ctx context.Context, s *Stream) error {
+		var args Args
+		if err := s.Recv(&args); err != nil {
+			return err
+		}
+		return sendStream(s, fn(ctx, args))
+	})
+}
+
+// HandleBidi serves the bidirectional streaming calls of method with
+// fn; reqs is closed once the client sent all the requests.
+func HandleBidi[Args, Req, Resp any](srv *Server, method string, fn func(ctx context.Context, args Args, reqs <-chan Req) *async.Stream[Resp]) {
+	srv.Handle(method, func(ctx context.Context, s *Stream) error {
+		var args Args
+		if err := s.Recv(&args); err != nil {
+			return err
+		}
+		return sendStream(s, fn(ctx, args, recvChan[Req](ctx, s)))
+	})
+}
+
+func open[Args any](ctx context.Context, c *Client, method string, args Args) (*Stream, error) {
+	s, err := c.Open(ctx, method)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Send(args); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// recvResult receives the single message of the server and its status.
+func recvResult[Resp any](s *Stream) (Resp, error) {
+	var resp Resp
+	if err := s.Recv(&resp); err == io.EOF {
+		return resp, async.ErrNoResult
+	} else if err != nil {
+		return resp, err
+	}
+	if err := s.Recv(nil); err != io.EOF {
+		return resp, err
+	}
+	return resp, nil
+}
+
+func recvAll[T any](s *Stream, e async.Emitter[T]) error {
+	for {
+		var env envelope[T]
+		err := s.Recv(&env)
+		switch {
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		case env.Err != nil:
+			err = e.Fail(env.Err)
+		default:
+			err = e.Send(env.Val)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// recvChan receives the requests of the client on a channel, closed
+// once all of them arrived or the call is over.
+func recvChan[T any](ctx context.Context, s *Stream) <-chan T {
+	ch := make(chan T)
+	go func() {
+		defer close(ch)
+		for {
+			var req T
+			if err := s.Recv(&req); err != nil {
+				return
+			}
+			select {
+			case ch <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func sendAll[T any](ctx context.Context, s *Stream, reqs <-chan T) error {
+	for {
+		select {
+		case req, ok := <-reqs:
+			if !ok {
+				return s.CloseSend()
+			}
+			if err := s.Send(req); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// sendStream sends the values and errors of the stream in envelopes.
+func sendStream[T any](s *Stream, stream *async.Stream[T]) error {
+	defer stream.Stop()
+	valCh, errCh := stream.Chans()
+	for valCh != nil || errCh != nil {
+		var env envelope[T]
+		select {
+		case val, ok := <-valCh:
+			if !ok {
+				valCh = nil
+				continue
+			}
+			env.Val = val
+		case err, ok := <-errCh:
+			if !ok {
+				errCh = nil
+				continue
+			}
+			code, msg := status(err)
+			env.Err = &Error{Code: code, Message: msg}
+		}
+		if err := s.Send(env); err != nil {
+			return err
+		}
+	}
+	return nil
+}